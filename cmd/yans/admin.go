@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ChronosX88/yans/internal/admin"
+	"github.com/ChronosX88/yans/internal/auth"
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/server"
+	"github.com/ChronosX88/yans/internal/utils"
+)
+
+const adminUsage = `Usage: yans admin -config <path> <command> [arguments]
+
+Commands:
+  group list
+  group create <name> [description]
+  group rename <name> <new name>
+  group describe <name> <description>
+  group moderated <name> yes|no
+  group delete <name>
+  article list <group>
+  article delete <message-id>
+  user list
+  user add <username> [password]
+  user passwd <username> [password]
+  user delete <username>
+  acl list <group>
+  acl set <group> <username> [read] [post] [moderate]
+  acl delete <group> <username>
+  stats
+
+ACL username "*" means any authenticated client and "" means anonymous clients.
+If the password is omitted, it is read from the standard input.
+`
+
+type adminCommand struct {
+	ctx context.Context
+	b   backend.StorageBackend
+	cfg config.Config
+}
+
+func runAdmin(args []string) error {
+	fs := flag.NewFlagSet("admin", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), adminUsage)
+	}
+	fs.Parse(args)
+
+	if *configPath == "" || fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.ParseConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	b, err := server.NewBackend(cfg)
+	if err != nil {
+		return err
+	}
+	ac := &adminCommand{ctx: context.Background(), b: b, cfg: cfg}
+
+	args = fs.Args()
+	var sub []string
+	if len(args) > 1 {
+		sub = args[2:]
+	}
+	switch args[0] {
+	case "group":
+		err = ac.group(subcommand(args), sub)
+	case "article":
+		err = ac.article(subcommand(args), sub)
+	case "user":
+		err = ac.user(subcommand(args), sub)
+	case "acl":
+		err = ac.acl(subcommand(args), sub)
+	case "stats":
+		err = ac.stats()
+	default:
+		err = errUsage
+	}
+	if err == errUsage {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return err
+}
+
+var errUsage = fmt.Errorf("invalid usage")
+
+// creator returns the address of the local user who runs the command, groups are created on their behalf.
+func (ac *adminCommand) creator() string {
+	name := "admin"
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		name = u.Username
+	}
+	return name + "@" + ac.cfg.Domain
+}
+
+func subcommand(args []string) string {
+	if len(args) < 2 {
+		return ""
+	}
+	return args[1]
+}
+
+func (ac *adminCommand) getGroup(name string) (models.Group, error) {
+	g, err := ac.b.GetGroup(ac.ctx, name)
+	if err == backend.ErrNoSuchGroup {
+		return g, fmt.Errorf("no such group: %s", name)
+	}
+	return g, err
+}
+
+func (ac *adminCommand) group(cmd string, args []string) error {
+	switch {
+	case cmd == "list" && len(args) == 0:
+		groups, err := ac.b.ListGroups(ac.ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tMODERATED\tDESCRIPTION")
+		for _, v := range groups {
+			description := ""
+			if v.Description != nil {
+				description = *v.Description
+			}
+			fmt.Fprintf(w, "%s\t%t\t%s\n", v.GroupName, v.Moderated, description)
+		}
+		return w.Flush()
+	case cmd == "create" && (len(args) == 1 || len(args) == 2):
+		if !utils.IsValidGroupName(args[0]) {
+			return fmt.Errorf("invalid group name: %s", args[0])
+		}
+		g := models.Group{GroupName: args[0], Creator: ac.creator()}
+		if len(args) == 2 {
+			g.Description = &args[1]
+		}
+		return ac.b.CreateGroup(ac.ctx, g)
+	case cmd == "rename" && len(args) == 2:
+		g, err := ac.getGroup(args[0])
+		if err != nil {
+			return err
+		}
+		if !utils.IsValidGroupName(args[1]) {
+			return fmt.Errorf("invalid group name: %s", args[1])
+		}
+		g.GroupName = args[1]
+		return ac.b.UpdateGroup(ac.ctx, g)
+	case cmd == "describe" && len(args) == 2:
+		g, err := ac.getGroup(args[0])
+		if err != nil {
+			return err
+		}
+		g.Description = &args[1]
+		return ac.b.UpdateGroup(ac.ctx, g)
+	case cmd == "moderated" && len(args) == 2:
+		g, err := ac.getGroup(args[0])
+		if err != nil {
+			return err
+		}
+		switch args[1] {
+		case "yes":
+			g.Moderated = true
+		case "no":
+			g.Moderated = false
+		default:
+			return errUsage
+		}
+		return ac.b.UpdateGroup(ac.ctx, g)
+	case cmd == "delete" && len(args) == 1:
+		g, err := ac.getGroup(args[0])
+		if err != nil {
+			return err
+		}
+		return admin.RemoveGroup(ac.ctx, ac.b, ac.cfg.UploadPath, &g)
+	}
+	return errUsage
+}
+
+func (ac *adminCommand) article(cmd string, args []string) error {
+	switch {
+	case cmd == "list" && len(args) == 1:
+		g, err := ac.getGroup(args[0])
+		if err != nil {
+			return err
+		}
+		info, err := ac.b.GetGroupArticleInfo(ac.ctx, &g)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NUMBER\tMESSAGE-ID\tDATE\tSIZE")
+		for _, v := range info {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\n", v.Number, v.MessageID, v.CreatedAt.Format("2006-01-02 15:04:05"), v.Size)
+		}
+		return w.Flush()
+	case cmd == "delete" && len(args) == 1:
+		_, err := admin.RemoveArticle(ac.ctx, ac.b, ac.cfg.UploadPath, args[0])
+		if err == backend.ErrNoSuchArticle {
+			return fmt.Errorf("no such article: %s", args[0])
+		}
+		return err
+	}
+	return errUsage
+}
+
+func (ac *adminCommand) user(cmd string, args []string) error {
+	switch {
+	case cmd == "list" && len(args) == 0:
+		users, err := ac.b.ListUsers(ac.ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "USERNAME\tCREATED")
+		for _, v := range users {
+			fmt.Fprintf(w, "%s\t%s\n", v.Username, v.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+		return w.Flush()
+	case (cmd == "add" || cmd == "passwd") && (len(args) == 1 || len(args) == 2):
+		_, err := ac.b.GetUser(ac.ctx, args[0])
+		if err != nil && err != backend.ErrNotFound {
+			return err
+		}
+		if cmd == "add" && err == nil {
+			return fmt.Errorf("user %s already exists", args[0])
+		}
+		if cmd == "passwd" && err == backend.ErrNotFound {
+			return fmt.Errorf("no such user: %s", args[0])
+		}
+
+		var password string
+		if len(args) == 2 {
+			password = args[1]
+		} else {
+			fmt.Fprint(os.Stderr, "Password: ")
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil {
+				return err
+			}
+			password = strings.TrimRight(line, "\r\n")
+		}
+		if password == "" {
+			return fmt.Errorf("empty password")
+		}
+
+		u, err := auth.NewUser(args[0], password)
+		if err != nil {
+			return err
+		}
+		return ac.b.SaveUser(ac.ctx, u)
+	case cmd == "delete" && len(args) == 1:
+		return ac.b.DeleteUser(ac.ctx, args[0])
+	}
+	return errUsage
+}
+
+func (ac *adminCommand) acl(cmd string, args []string) error {
+	switch {
+	case cmd == "list" && len(args) == 1:
+		g, err := ac.getGroup(args[0])
+		if err != nil {
+			return err
+		}
+		entries, err := ac.b.GetGroupACL(ac.ctx, &g)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "USERNAME\tREAD\tPOST\tMODERATE")
+		for _, v := range entries {
+			username := v.Username
+			if username == models.ACLAnonymous {
+				username = `""`
+			}
+			fmt.Fprintf(w, "%s\t%t\t%t\t%t\n", username, v.CanRead, v.CanPost, v.CanModerate)
+		}
+		return w.Flush()
+	case cmd == "set" && len(args) >= 2:
+		g, err := ac.getGroup(args[0])
+		if err != nil {
+			return err
+		}
+		e := models.ACLEntry{GroupID: g.ID, Username: args[1]}
+		for _, v := range args[2:] {
+			switch v {
+			case "read":
+				e.CanRead = true
+			case "post":
+				e.CanPost = true
+			case "moderate":
+				e.CanModerate = true
+			default:
+				return errUsage
+			}
+		}
+		return ac.b.SaveACLEntry(ac.ctx, e)
+	case cmd == "delete" && len(args) == 2:
+		g, err := ac.getGroup(args[0])
+		if err != nil {
+			return err
+		}
+		return ac.b.DeleteACLEntry(ac.ctx, &g, args[1])
+	}
+	return errUsage
+}
+
+func (ac *adminCommand) stats() error {
+	groups, err := ac.b.ListGroups(ac.ctx)
+	if err != nil {
+		return err
+	}
+	users, err := ac.b.ListUsers(ac.ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "GROUP\tARTICLES\tLOW\tHIGH\tPENDING")
+	articles, pending := 0, 0
+	for _, v := range groups {
+		count, err := ac.b.GetArticlesCount(ac.ctx, &v)
+		if err != nil {
+			return err
+		}
+		low, err := ac.b.GetGroupLowWaterMark(ac.ctx, &v)
+		if err != nil {
+			return err
+		}
+		high, err := ac.b.GetGroupHighWaterMark(ac.ctx, &v)
+		if err != nil {
+			return err
+		}
+		p, err := ac.b.GetPendingArticles(ac.ctx, &v)
+		if err != nil {
+			return err
+		}
+		articles += count
+		pending += len(p)
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", v.GroupName, count, low, high, len(p))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nGroups: %d\nArticles in groups: %d\nPending articles: %d\nUsers: %d\n", len(groups), articles, pending, len(users))
+	return nil
+}
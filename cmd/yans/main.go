@@ -11,6 +11,12 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		if err := runAdmin(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	configPath := flag.String("config", "", "Path to config")
 	flag.Parse()
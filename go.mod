@@ -1,28 +1,36 @@
 module github.com/ChronosX88/yans
 
-go 1.17
+go 1.19
 
 require (
 	github.com/BurntSushi/toml v1.0.0
+	github.com/ProtonMail/go-crypto v1.1.6
 	github.com/dlclark/regexp2 v1.4.0
 	github.com/google/uuid v1.3.0
+	github.com/jhillyerd/enmime v0.9.3
 	github.com/jmoiron/sqlx v1.3.4
-	github.com/mattn/go-sqlite3 v1.14.10
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.12
 	github.com/pressly/goose/v3 v3.5.0
+	github.com/xdg-go/scram v1.1.0
+	golang.org/x/crypto v0.17.0
+	nhooyr.io/websocket v1.8.7
 )
 
 require (
 	github.com/cention-sany/utf7 v0.0.0-20170124080048-26cad61bd60a // indirect
+	github.com/cloudflare/circl v1.3.7 // indirect
 	github.com/gogs/chardet v0.0.0-20191104214054-4b6791f73a28 // indirect
 	github.com/jaytaylor/html2text v0.0.0-20200412013138-3577fbdbcff7 // indirect
-	github.com/jhillyerd/enmime v0.9.3 // indirect
 	github.com/klauspost/compress v1.10.3 // indirect
 	github.com/mattn/go-runewidth v0.0.12 // indirect
 	github.com/olekukonko/tablewriter v0.0.5 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
 	github.com/ssor/bom v0.0.0-20170718123548-6386211fdfcf // indirect
-	golang.org/x/net v0.0.0-20211015210444-4f30a5c0130f // indirect
-	golang.org/x/text v0.3.6 // indirect
-	nhooyr.io/websocket v1.8.7 // indirect
+	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
+	github.com/xdg-go/stringprep v1.0.2 // indirect
+	golang.org/x/net v0.10.0 // indirect
+	golang.org/x/sys v0.16.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
 )
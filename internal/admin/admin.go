@@ -0,0 +1,51 @@
+// Package admin implements management operations on the storage which are shared by the admin tools,
+// the expiry job and control messages.
+package admin
+
+import (
+	"context"
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/moderation"
+	"github.com/ChronosX88/yans/internal/utils"
+)
+
+// RemoveArticle deletes the article from all its groups together with its attachment files.
+func RemoveArticle(ctx context.Context, b backend.StorageBackend, uploadPath, messageID string) (models.Article, error) {
+	a, err := b.GetArticle(ctx, messageID)
+	if err != nil {
+		return a, err
+	}
+	if err := b.DeleteArticle(ctx, messageID); err != nil {
+		return a, err
+	}
+	return a, utils.RemoveAttachments(a.Attachments, uploadPath)
+}
+
+// RemoveGroup deletes the group, its pending articles and articles which aren't posted to other groups.
+func RemoveGroup(ctx context.Context, b backend.StorageBackend, uploadPath string, g *models.Group) error {
+	pending, err := b.GetPendingArticles(ctx, g)
+	if err != nil {
+		return err
+	}
+	for _, v := range pending {
+		if _, err := moderation.Reject(ctx, b, uploadPath, v.ID); err != nil {
+			return err
+		}
+	}
+
+	info, err := b.GetGroupArticleInfo(ctx, g)
+	if err != nil {
+		return err
+	}
+	for _, v := range info {
+		if v.Groups > 1 {
+			continue
+		}
+		if _, err := RemoveArticle(ctx, b, uploadPath, v.MessageID); err != nil {
+			return err
+		}
+	}
+
+	return b.DeleteGroup(ctx, g)
+}
@@ -0,0 +1,123 @@
+package adminapi
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/models"
+)
+
+type banResponse struct {
+	ID        int       `json:"id"`
+	Type      string    `json:"type"`
+	Value     string    `json:"value"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type banRequest struct {
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+// handleBans serves /api/bans[/<id>].
+func (s *Server) handleBans(w http.ResponseWriter, r *http.Request, parts []string) error {
+	switch {
+	case len(parts) == 0 || parts[0] == "":
+		switch r.Method {
+		case http.MethodGet:
+			bans, err := s.backend.ListBans(r.Context())
+			if err != nil {
+				return err
+			}
+			resp := []banResponse{}
+			for _, v := range bans {
+				resp = append(resp, banResponse(v))
+			}
+			return writeJSON(w, http.StatusOK, resp)
+		case http.MethodPost:
+			return s.createBan(w, r)
+		}
+		return errMethodNotAllowed
+	case len(parts) == 1:
+		if r.Method != http.MethodDelete {
+			return errMethodNotAllowed
+		}
+		id, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return errNotFound
+		}
+		if err := s.backend.DeleteBan(r.Context(), id); err != nil {
+			if err == backend.ErrNotFound {
+				return notFound("no such ban: %d", id)
+			}
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return errNotFound
+}
+
+func (s *Server) createBan(w http.ResponseWriter, r *http.Request) error {
+	var req banRequest
+	if err := readJSON(r, &req); err != nil {
+		return err
+	}
+	switch req.Type {
+	case models.BanTypeAddress:
+		if _, _, err := net.ParseCIDR(req.Value); err != nil && net.ParseIP(req.Value) == nil {
+			return badRequest("invalid IP address or network: %s", req.Value)
+		}
+	case models.BanTypeUser:
+		if req.Value == "" {
+			return badRequest("username is required")
+		}
+	default:
+		return badRequest("ban type must be %q or %q", models.BanTypeAddress, models.BanTypeUser)
+	}
+
+	b := models.Ban{Type: req.Type, Value: req.Value, Reason: req.Reason}
+	id, err := s.backend.SaveBan(r.Context(), b)
+	if err != nil {
+		return err
+	}
+	b.ID = id
+
+	// the ban is checked on connection and authentication, so the clients it covers are disconnected now
+	for _, v := range s.sessions.Sessions() {
+		if b.Type == models.BanTypeUser && v.Username != b.Value {
+			continue
+		}
+		if b.Type == models.BanTypeAddress && !b.MatchesAddress(remoteIP(v.RemoteAddr)) {
+			continue
+		}
+		if s.sessions.KickSession(v.ID) {
+			log.Printf("admin API: client %s has been kicked due to the ban %d", v.RemoteAddr, b.ID)
+		}
+	}
+
+	bans, err := s.backend.ListBans(r.Context())
+	if err != nil {
+		return err
+	}
+	for _, v := range bans {
+		if v.ID == id {
+			b = v
+		}
+	}
+	return writeJSON(w, http.StatusCreated, banResponse(b))
+}
+
+func remoteIP(remoteAddr string) net.IP {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return net.ParseIP(host)
+}
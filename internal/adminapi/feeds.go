@@ -0,0 +1,108 @@
+package adminapi
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/feed"
+)
+
+type peerResponse struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Groups  string `json:"groups"`
+	Mode    string `json:"mode"`
+	Queued  int    `json:"queued"` // articles waiting to be sent
+}
+
+type upstreamResponse struct {
+	Name    string         `json:"name"`
+	Address string         `json:"address"`
+	Groups  string         `json:"groups"`
+	Pulled  map[string]int `json:"pulled"` // the last pulled article number of the upstream per group
+}
+
+type feedsResponse struct {
+	Peers     []peerResponse     `json:"peers"`
+	Upstreams []upstreamResponse `json:"upstreams"`
+}
+
+// handleFeeds serves /api/feeds and /api/feeds/<peer>/queue.
+func (s *Server) handleFeeds(w http.ResponseWriter, r *http.Request, parts []string) error {
+	switch {
+	case len(parts) == 0 || parts[0] == "":
+		if r.Method != http.MethodGet {
+			return errMethodNotAllowed
+		}
+		return s.listFeeds(r.Context(), w)
+	case len(parts) == 2 && parts[1] == "queue":
+		if r.Method != http.MethodDelete {
+			return errMethodNotAllowed
+		}
+		peer, ok := s.findPeer(parts[0])
+		if !ok {
+			return notFound("no such peer: %s", parts[0])
+		}
+		if err := s.backend.ClearFeedQueue(r.Context(), peer.Name); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return errNotFound
+}
+
+func (s *Server) findPeer(name string) (config.PeerConfig, bool) {
+	for _, v := range s.cfg.Feed.Peers {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return config.PeerConfig{}, false
+}
+
+func (s *Server) listFeeds(ctx context.Context, w http.ResponseWriter) error {
+	resp := feedsResponse{Peers: []peerResponse{}, Upstreams: []upstreamResponse{}}
+	for _, v := range s.cfg.Feed.Peers {
+		queued, err := s.backend.GetFeedQueueSize(ctx, v.Name)
+		if err != nil {
+			return err
+		}
+		mode := v.Mode
+		if mode == "" {
+			mode = config.IHaveFeedMode
+		}
+		resp.Peers = append(resp.Peers, peerResponse{
+			Name:    v.Name,
+			Address: v.Address,
+			Groups:  v.Groups,
+			Mode:    mode,
+			Queued:  queued,
+		})
+	}
+
+	groups, err := s.backend.ListGroups(ctx)
+	if err != nil {
+		return err
+	}
+	for _, v := range s.cfg.Feed.Upstreams {
+		ur := upstreamResponse{Name: v.Name, Address: v.Address, Groups: v.Groups, Pulled: map[string]int{}}
+		for _, g := range groups {
+			value, err := s.backend.GetState(ctx, feed.PullStateKey(v.Name, g.GroupName))
+			if err != nil {
+				if err == backend.ErrNotFound {
+					continue
+				}
+				return err
+			}
+			if n, err := strconv.Atoi(value); err == nil {
+				ur.Pulled[g.GroupName] = n
+			}
+		}
+		resp.Upstreams = append(resp.Upstreams, ur)
+	}
+	return writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,297 @@
+package adminapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ChronosX88/yans/internal/admin"
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/moderation"
+	"github.com/ChronosX88/yans/internal/utils"
+)
+
+type groupResponse struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Moderated   bool      `json:"moderated"`
+	Creator     string    `json:"creator"`
+	CreatedAt   time.Time `json:"created_at"`
+	Articles    int       `json:"articles"`
+	Low         int       `json:"low"`
+	High        int       `json:"high"`
+	Pending     int       `json:"pending"`
+}
+
+type groupRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Moderated   *bool   `json:"moderated"`
+	Creator     *string `json:"creator"`
+}
+
+type pendingArticleResponse struct {
+	ID        int                 `json:"id"`
+	Group     string              `json:"group"`
+	Submitter string              `json:"submitter"`
+	CreatedAt time.Time           `json:"created_at"`
+	MessageID string              `json:"message_id"`
+	From      string              `json:"from"`
+	Subject   string              `json:"subject"`
+	Header    map[string][]string `json:"header,omitempty"`
+	Body      string              `json:"body,omitempty"`
+}
+
+// handleGroups serves /api/groups[/<name>[/pending]].
+func (s *Server) handleGroups(w http.ResponseWriter, r *http.Request, parts []string) error {
+	switch {
+	case len(parts) == 0 || parts[0] == "":
+		switch r.Method {
+		case http.MethodGet:
+			return s.listGroups(r.Context(), w)
+		case http.MethodPost:
+			return s.createGroup(w, r)
+		}
+		return errMethodNotAllowed
+	case len(parts) == 1:
+		g, err := s.getGroup(r.Context(), parts[0])
+		if err != nil {
+			return err
+		}
+		switch r.Method {
+		case http.MethodGet:
+			gr, err := s.groupResponse(r.Context(), g)
+			if err != nil {
+				return err
+			}
+			return writeJSON(w, http.StatusOK, gr)
+		case http.MethodPatch:
+			return s.updateGroup(w, r, g)
+		case http.MethodDelete:
+			if err := admin.RemoveGroup(r.Context(), s.backend, s.cfg.UploadPath, &g); err != nil {
+				return err
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+		return errMethodNotAllowed
+	case len(parts) == 2 && parts[1] == "pending":
+		if r.Method != http.MethodGet {
+			return errMethodNotAllowed
+		}
+		g, err := s.getGroup(r.Context(), parts[0])
+		if err != nil {
+			return err
+		}
+		articles, err := s.backend.GetPendingArticles(r.Context(), &g)
+		if err != nil {
+			return err
+		}
+		resp := []pendingArticleResponse{}
+		for _, v := range articles {
+			resp = append(resp, newPendingArticleResponse(v, g.GroupName, false))
+		}
+		return writeJSON(w, http.StatusOK, resp)
+	}
+	return errNotFound
+}
+
+func (s *Server) getGroup(ctx context.Context, name string) (models.Group, error) {
+	g, err := s.backend.GetGroup(ctx, name)
+	if err == backend.ErrNoSuchGroup {
+		return g, notFound("no such group: %s", name)
+	}
+	return g, err
+}
+
+func (s *Server) groupResponse(ctx context.Context, g models.Group) (groupResponse, error) {
+	gr := groupResponse{
+		Name:      g.GroupName,
+		Moderated: g.Moderated,
+		Creator:   g.Creator,
+		CreatedAt: g.CreatedAt,
+	}
+	if g.Description != nil {
+		gr.Description = *g.Description
+	}
+
+	var err error
+	if gr.Articles, err = s.backend.GetArticlesCount(ctx, &g); err != nil {
+		return gr, err
+	}
+	if gr.Low, err = s.backend.GetGroupLowWaterMark(ctx, &g); err != nil {
+		return gr, err
+	}
+	if gr.High, err = s.backend.GetGroupHighWaterMark(ctx, &g); err != nil {
+		return gr, err
+	}
+	pending, err := s.backend.GetPendingArticles(ctx, &g)
+	if err != nil {
+		return gr, err
+	}
+	gr.Pending = len(pending)
+	return gr, nil
+}
+
+func (s *Server) listGroups(ctx context.Context, w http.ResponseWriter) error {
+	groups, err := s.backend.ListGroups(ctx)
+	if err != nil {
+		return err
+	}
+	resp := []groupResponse{}
+	for _, v := range groups {
+		gr, err := s.groupResponse(ctx, v)
+		if err != nil {
+			return err
+		}
+		resp = append(resp, gr)
+	}
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) createGroup(w http.ResponseWriter, r *http.Request) error {
+	var req groupRequest
+	if err := readJSON(r, &req); err != nil {
+		return err
+	}
+	if req.Name == nil || !utils.IsValidGroupName(*req.Name) {
+		return badRequest("invalid group name")
+	}
+	if _, err := s.backend.GetGroup(r.Context(), *req.Name); err == nil {
+		return &apiError{http.StatusConflict, "group already exists"}
+	} else if err != backend.ErrNoSuchGroup {
+		return err
+	}
+
+	g := models.Group{GroupName: *req.Name, Description: req.Description, Creator: "admin@" + s.cfg.Domain}
+	if req.Creator != nil && *req.Creator != "" {
+		g.Creator = *req.Creator
+	}
+	if req.Moderated != nil {
+		g.Moderated = *req.Moderated
+	}
+	if err := s.backend.CreateGroup(r.Context(), g); err != nil {
+		return err
+	}
+
+	g, err := s.backend.GetGroup(r.Context(), g.GroupName)
+	if err != nil {
+		return err
+	}
+	gr, err := s.groupResponse(r.Context(), g)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusCreated, gr)
+}
+
+func (s *Server) updateGroup(w http.ResponseWriter, r *http.Request, g models.Group) error {
+	var req groupRequest
+	if err := readJSON(r, &req); err != nil {
+		return err
+	}
+	if req.Name != nil {
+		if !utils.IsValidGroupName(*req.Name) {
+			return badRequest("invalid group name")
+		}
+		g.GroupName = *req.Name
+	}
+	if req.Description != nil {
+		g.Description = req.Description
+	}
+	if req.Moderated != nil {
+		g.Moderated = *req.Moderated
+	}
+	if err := s.backend.UpdateGroup(r.Context(), g); err != nil {
+		return err
+	}
+
+	gr, err := s.groupResponse(r.Context(), g)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, gr)
+}
+
+func newPendingArticleResponse(pa models.PendingArticle, group string, full bool) pendingArticleResponse {
+	resp := pendingArticleResponse{
+		ID:        pa.ID,
+		Group:     group,
+		Submitter: pa.Submitter,
+		CreatedAt: pa.CreatedAt,
+		MessageID: pa.Header.Get("Message-ID"),
+		From:      pa.Header.Get("From"),
+		Subject:   pa.Header.Get("Subject"),
+	}
+	if full {
+		resp.Header = pa.Header
+		resp.Body = pa.Body
+	}
+	return resp
+}
+
+// handlePending serves /api/pending/<id>[/approve|/reject].
+func (s *Server) handlePending(w http.ResponseWriter, r *http.Request, parts []string) error {
+	if len(parts) == 0 || len(parts) > 2 {
+		return errNotFound
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return errNotFound
+	}
+	pa, err := s.backend.GetPendingArticle(r.Context(), id)
+	if err != nil {
+		if err == backend.ErrNotFound {
+			return notFound("no such pending article: %d", id)
+		}
+		return err
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			return errMethodNotAllowed
+		}
+		return writeJSON(w, http.StatusOK, newPendingArticleResponse(pa, pa.Header.Get("Newsgroups"), true))
+	}
+
+	if r.Method != http.MethodPost {
+		return errMethodNotAllowed
+	}
+	switch parts[1] {
+	case "approve":
+		var req struct {
+			Approver string `json:"approver"`
+		}
+		if r.ContentLength != 0 {
+			if err := readJSON(r, &req); err != nil {
+				return err
+			}
+		}
+		if req.Approver == "" {
+			req.Approver = "moderator@" + s.cfg.Domain
+		}
+		a, err := moderation.Approve(r.Context(), s.backend, s.cfg.UploadPath, id, req.Approver)
+		if err != nil {
+			switch {
+			case errors.Is(err, backend.ErrNotFound):
+				return notFound("no such pending article: %d", id)
+			case errors.Is(err, backend.ErrNoSuchGroup):
+				return &apiError{http.StatusConflict, "none of the groups of the article can be published to"}
+			case errors.Is(err, backend.ErrDuplicate):
+				return &apiError{http.StatusConflict, "article has already been published"}
+			}
+			return err
+		}
+		return writeJSON(w, http.StatusOK, map[string]string{"message_id": a.Header.Get("Message-ID")})
+	case "reject":
+		if _, err := moderation.Reject(r.Context(), s.backend, s.cfg.UploadPath, id); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return errNotFound
+}
@@ -0,0 +1,156 @@
+package adminapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/config"
+)
+
+// SessionInfo describes a connected client.
+type SessionInfo struct {
+	ID          string    `json:"id"`
+	RemoteAddr  string    `json:"remote_addr"`
+	Username    string    `json:"username"`
+	Group       string    `json:"group"`
+	TLS         bool      `json:"tls"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+// SessionManager gives access to the sessions of connected clients.
+type SessionManager interface {
+	Sessions() []SessionInfo
+	// KickSession closes the connection of the session, it returns false if there is no such session.
+	KickSession(id string) bool
+}
+
+// Server serves the JSON REST API for server administration under /api/ path.
+// Requests are authenticated with the token from the config sent as "Authorization: Bearer <token>".
+type Server struct {
+	backend  backend.StorageBackend
+	cfg      config.Config
+	sessions SessionManager
+	srv      *http.Server
+}
+
+func NewServer(b backend.StorageBackend, cfg config.Config, sm SessionManager) (*Server, error) {
+	if cfg.AdminAPI.Token == "" {
+		return nil, fmt.Errorf("admin API is enabled, but no token is configured")
+	}
+	s := &Server{
+		backend:  b,
+		cfg:      cfg,
+		sessions: sm,
+	}
+	s.srv = &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", cfg.AdminAPI.Address, cfg.AdminAPI.Port),
+		Handler: s,
+	}
+	return s, nil
+}
+
+func (s *Server) Start(ctx context.Context) {
+	go func() {
+		log.Printf("Admin API is listening on %s...", s.srv.Addr)
+		if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("admin API: %v", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		s.srv.Close()
+	}()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	if path != "api" && !strings.HasPrefix(path, "api/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(strings.TrimPrefix(path, "api"), "/"), "/")
+
+	var err error
+	switch parts[0] {
+	case "groups":
+		err = s.handleGroups(w, r, parts[1:])
+	case "pending":
+		err = s.handlePending(w, r, parts[1:])
+	case "users":
+		err = s.handleUsers(w, r, parts[1:])
+	case "bans":
+		err = s.handleBans(w, r, parts[1:])
+	case "feeds":
+		err = s.handleFeeds(w, r, parts[1:])
+	case "sessions":
+		err = s.handleSessions(w, r, parts[1:])
+	default:
+		err = errNotFound
+	}
+	if err != nil {
+		if e, ok := err.(*apiError); ok {
+			writeError(w, e.status, e.message)
+			return
+		}
+		// internal errors may reveal details of the storage, they are only logged
+		log.Printf("admin API: %s %s: %v", r.Method, r.URL.Path, err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminAPI.Token)) == 1
+}
+
+// apiError is an error which is returned to the client as is.
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+var (
+	errNotFound         = &apiError{http.StatusNotFound, "not found"}
+	errMethodNotAllowed = &apiError{http.StatusMethodNotAllowed, "method not allowed"}
+)
+
+func badRequest(format string, args ...interface{}) error {
+	return &apiError{http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
+
+func notFound(format string, args ...interface{}) error {
+	return &apiError{http.StatusNotFound, fmt.Sprintf(format, args...)}
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return badRequest("invalid request body: %v", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,30 @@
+package adminapi
+
+import (
+	"net/http"
+)
+
+// handleSessions serves /api/sessions[/<id>].
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request, parts []string) error {
+	switch {
+	case len(parts) == 0 || parts[0] == "":
+		if r.Method != http.MethodGet {
+			return errMethodNotAllowed
+		}
+		sessions := s.sessions.Sessions()
+		if sessions == nil {
+			sessions = []SessionInfo{}
+		}
+		return writeJSON(w, http.StatusOK, sessions)
+	case len(parts) == 1:
+		if r.Method != http.MethodDelete {
+			return errMethodNotAllowed
+		}
+		if !s.sessions.KickSession(parts[0]) {
+			return notFound("no such session: %s", parts[0])
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return errNotFound
+}
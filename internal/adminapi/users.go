@@ -0,0 +1,106 @@
+package adminapi
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ChronosX88/yans/internal/auth"
+	"github.com/ChronosX88/yans/internal/backend"
+)
+
+type userResponse struct {
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type userRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// handleUsers serves /api/users[/<username>[/password]].
+func (s *Server) handleUsers(w http.ResponseWriter, r *http.Request, parts []string) error {
+	switch {
+	case len(parts) == 0 || parts[0] == "":
+		switch r.Method {
+		case http.MethodGet:
+			users, err := s.backend.ListUsers(r.Context())
+			if err != nil {
+				return err
+			}
+			resp := []userResponse{}
+			for _, v := range users {
+				resp = append(resp, userResponse{Username: v.Username, CreatedAt: v.CreatedAt})
+			}
+			return writeJSON(w, http.StatusOK, resp)
+		case http.MethodPost:
+			var req userRequest
+			if err := readJSON(r, &req); err != nil {
+				return err
+			}
+			if req.Username == "" || req.Password == "" {
+				return badRequest("username and password are required")
+			}
+			if _, err := s.backend.GetUser(r.Context(), req.Username); err == nil {
+				return &apiError{http.StatusConflict, "user already exists"}
+			} else if err != backend.ErrNotFound {
+				return err
+			}
+			return s.saveUser(r.Context(), w, http.StatusCreated, req)
+		}
+		return errMethodNotAllowed
+	case len(parts) == 1:
+		if r.Method != http.MethodDelete {
+			return errMethodNotAllowed
+		}
+		if err := s.checkUser(r.Context(), parts[0]); err != nil {
+			return err
+		}
+		if err := s.backend.DeleteUser(r.Context(), parts[0]); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	case len(parts) == 2 && parts[1] == "password":
+		if r.Method != http.MethodPut {
+			return errMethodNotAllowed
+		}
+		if err := s.checkUser(r.Context(), parts[0]); err != nil {
+			return err
+		}
+		var req userRequest
+		if err := readJSON(r, &req); err != nil {
+			return err
+		}
+		if req.Password == "" {
+			return badRequest("password is required")
+		}
+		req.Username = parts[0]
+		return s.saveUser(r.Context(), w, http.StatusOK, req)
+	}
+	return errNotFound
+}
+
+func (s *Server) checkUser(ctx context.Context, username string) error {
+	_, err := s.backend.GetUser(ctx, username)
+	if err == backend.ErrNotFound {
+		return notFound("no such user: %s", username)
+	}
+	return err
+}
+
+func (s *Server) saveUser(ctx context.Context, w http.ResponseWriter, status int, req userRequest) error {
+	u, err := auth.NewUser(req.Username, req.Password)
+	if err != nil {
+		return err
+	}
+	if err := s.backend.SaveUser(ctx, u); err != nil {
+		return err
+	}
+	u, err = s.backend.GetUser(ctx, req.Username)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, status, userResponse{Username: u.Username, CreatedAt: u.CreatedAt})
+}
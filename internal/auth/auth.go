@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/xdg-go/scram"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	scramSaltLength = 16
+	scramIterations = 4096
+)
+
+// CredentialProvider verifies the credentials supplied by a client through AUTHINFO.
+type CredentialProvider interface {
+	Authenticate(ctx context.Context, username, password string) (bool, error)
+}
+
+// SCRAMCredentials holds the values derived from the user password which are needed to verify
+// a SCRAM-SHA-256 exchange without knowing the password itself.
+type SCRAMCredentials struct {
+	Salt       []byte
+	Iterations int
+	StoredKey  []byte
+	ServerKey  []byte
+}
+
+// SCRAMCredentialProvider is implemented by credential providers which keep SCRAM credentials
+// alongside the password hash.
+type SCRAMCredentialProvider interface {
+	CredentialProvider
+	LookupSCRAM(ctx context.Context, username string) (SCRAMCredentials, bool, error)
+}
+
+// HashPassword returns a bcrypt hash of password suitable for storing in a credential store.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// NewSCRAMCredentials derives SCRAM-SHA-256 credentials from password using a random salt.
+func NewSCRAMCredentials(password string) (SCRAMCredentials, error) {
+	salt := make([]byte, scramSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return SCRAMCredentials{}, err
+	}
+	client, err := scram.SHA256.NewClient("", password, "")
+	if err != nil {
+		return SCRAMCredentials{}, err
+	}
+	sc := client.GetStoredCredentials(scram.KeyFactors{Salt: string(salt), Iters: scramIterations})
+	return SCRAMCredentials{
+		Salt:       salt,
+		Iterations: scramIterations,
+		StoredKey:  sc.StoredKey,
+		ServerKey:  sc.ServerKey,
+	}, nil
+}
+
+// fakeSaltKey makes salts of unknown users, it is random so they can't be told from the real ones
+var fakeSaltKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// FakeSCRAMCredentials returns credentials for a user who doesn't exist, so the exchange goes on
+// as for a known user and fails only at the proof. The salt is the same for each request of the user.
+func FakeSCRAMCredentials(username string) SCRAMCredentials {
+	mac := hmac.New(sha256.New, fakeSaltKey)
+	mac.Write([]byte(username))
+	key := make([]byte, sha256.Size)
+	rand.Read(key)
+	return SCRAMCredentials{
+		Salt:       mac.Sum(nil)[:scramSaltLength],
+		Iterations: scramIterations,
+		StoredKey:  key,
+		ServerKey:  key,
+	}
+}
+
+// NewUser creates a user with all credentials derived from password.
+func NewUser(username, password string) (models.User, error) {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return models.User{}, err
+	}
+	sc, err := NewSCRAMCredentials(password)
+	if err != nil {
+		return models.User{}, err
+	}
+	return models.User{
+		Username:        username,
+		PasswordHash:    hash,
+		ScramSalt:       base64.StdEncoding.EncodeToString(sc.Salt),
+		ScramIterations: sc.Iterations,
+		ScramStoredKey:  base64.StdEncoding.EncodeToString(sc.StoredKey),
+		ScramServerKey:  base64.StdEncoding.EncodeToString(sc.ServerKey),
+	}, nil
+}
+
+func checkPassword(hash, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err != nil {
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+
+	"github.com/ChronosX88/yans/internal/backend"
+)
+
+// BackendProvider verifies credentials against users kept by the storage backend.
+type BackendProvider struct {
+	backend backend.StorageBackend
+}
+
+func NewBackendProvider(b backend.StorageBackend) *BackendProvider {
+	return &BackendProvider{backend: b}
+}
+
+func (bp *BackendProvider) Authenticate(ctx context.Context, username, password string) (bool, error) {
+	u, err := bp.backend.GetUser(ctx, username)
+	if err != nil {
+		if errors.Is(err, backend.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return checkPassword(u.PasswordHash, password)
+}
+
+func (bp *BackendProvider) LookupSCRAM(ctx context.Context, username string) (SCRAMCredentials, bool, error) {
+	u, err := bp.backend.GetUser(ctx, username)
+	if err != nil {
+		if errors.Is(err, backend.ErrNotFound) {
+			return SCRAMCredentials{}, false, nil
+		}
+		return SCRAMCredentials{}, false, err
+	}
+	if u.ScramStoredKey == "" {
+		// user was created before SCRAM credentials were introduced
+		return SCRAMCredentials{}, false, nil
+	}
+
+	var sc SCRAMCredentials
+	if sc.Salt, err = base64.StdEncoding.DecodeString(u.ScramSalt); err != nil {
+		return SCRAMCredentials{}, false, err
+	}
+	if sc.StoredKey, err = base64.StdEncoding.DecodeString(u.ScramStoredKey); err != nil {
+		return SCRAMCredentials{}, false, err
+	}
+	if sc.ServerKey, err = base64.StdEncoding.DecodeString(u.ScramServerKey); err != nil {
+		return SCRAMCredentials{}, false, err
+	}
+	sc.Iterations = u.ScramIterations
+	return sc, true, nil
+}
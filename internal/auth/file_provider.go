@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FileProvider verifies credentials against a static file. Each non-empty line of the file
+// has the form "username:bcrypt-hash", lines starting with '#' are ignored.
+type FileProvider struct {
+	users map[string]string
+}
+
+func NewFileProvider(path string) (*FileProvider, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fp := &FileProvider{users: map[string]string{}}
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("%s:%d: malformed line", path, lineNum)
+		}
+		fp.users[parts[0]] = parts[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return fp, nil
+}
+
+func (fp *FileProvider) Authenticate(ctx context.Context, username, password string) (bool, error) {
+	hash, ok := fp.users[username]
+	if !ok {
+		return false, nil
+	}
+	return checkPassword(hash, password)
+}
@@ -0,0 +1,48 @@
+package sasl
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/ChronosX88/yans/internal/auth"
+)
+
+// PLAIN mechanism (RFC 4616)
+type plainMechanism struct {
+	provider auth.CredentialProvider
+	username string
+}
+
+func init() {
+	Register("PLAIN", func(p auth.CredentialProvider) (Mechanism, bool) {
+		return &plainMechanism{provider: p}, true
+	})
+}
+
+func (m *plainMechanism) Next(ctx context.Context, response []byte) ([]byte, bool, error) {
+	// message = [authzid] NUL authcid NUL passwd
+	parts := bytes.Split(response, []byte{0})
+	if len(parts) != 3 {
+		return nil, false, ErrAuthFailed
+	}
+	authzID, username, password := string(parts[0]), string(parts[1]), string(parts[2])
+	if authzID != "" && authzID != username {
+		// acting on behalf of another user is not supported
+		return nil, false, ErrAuthFailed
+	}
+
+	ok, err := m.provider.Authenticate(ctx, username, password)
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok {
+		return nil, false, ErrAuthFailed
+	}
+
+	m.username = username
+	return nil, true, nil
+}
+
+func (m *plainMechanism) Username() string {
+	return m.username
+}
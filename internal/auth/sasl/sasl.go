@@ -0,0 +1,65 @@
+package sasl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ChronosX88/yans/internal/auth"
+)
+
+// ErrAuthFailed is returned by a mechanism when the client has supplied wrong credentials.
+var ErrAuthFailed = errors.New("authentication failed")
+
+// Mechanism is the server side of a single SASL exchange. All registered mechanisms are
+// client-first, so the exchange is always driven by client responses.
+type Mechanism interface {
+	// Next processes a client response and returns the data to send back. done is set when
+	// the exchange has finished and the client has been authenticated.
+	Next(ctx context.Context, response []byte) (challenge []byte, done bool, err error)
+	// Username returns the identity of the authenticated client.
+	Username() string
+}
+
+// Factory creates a new exchange for the mechanism. It reports false if the mechanism can't be
+// used with the given credential provider.
+type Factory func(p auth.CredentialProvider) (Mechanism, bool)
+
+var (
+	factories = map[string]Factory{}
+	names     []string
+)
+
+// Register makes a mechanism available under name. It is meant to be called from init functions.
+func Register(name string, f Factory) {
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("sasl: mechanism %s is already registered", name))
+	}
+	factories[name] = f
+	names = append(names, name)
+}
+
+// Mechanisms returns names of the registered mechanisms usable with the provider, in the order
+// of registration.
+func Mechanisms(p auth.CredentialProvider) []string {
+	var res []string
+	for _, v := range names {
+		if _, ok := factories[v](p); ok {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// New starts a new exchange of the named mechanism.
+func New(name string, p auth.CredentialProvider) (Mechanism, error) {
+	f, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown mechanism %s", name)
+	}
+	m, ok := f(p)
+	if !ok {
+		return nil, fmt.Errorf("mechanism %s isn't supported by the credential provider", name)
+	}
+	return m, nil
+}
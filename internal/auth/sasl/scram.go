@@ -0,0 +1,74 @@
+package sasl
+
+import (
+	"context"
+
+	"github.com/ChronosX88/yans/internal/auth"
+	"github.com/xdg-go/scram"
+)
+
+// SCRAM-SHA-256 mechanism (RFC 7677)
+type scramMechanism struct {
+	conv *scram.ServerConversation
+	// context of the current step, used by the credential lookup
+	ctx context.Context
+	// error from the credential provider, which must not be reported as failed authentication
+	lookupErr error
+}
+
+func init() {
+	Register("SCRAM-SHA-256", newSCRAMMechanism)
+}
+
+func newSCRAMMechanism(p auth.CredentialProvider) (Mechanism, bool) {
+	sp, ok := p.(auth.SCRAMCredentialProvider)
+	if !ok {
+		return nil, false
+	}
+
+	m := &scramMechanism{}
+	server, err := scram.SHA256.NewServer(func(username string) (scram.StoredCredentials, error) {
+		sc, found, err := sp.LookupSCRAM(m.ctx, username)
+		if err != nil {
+			m.lookupErr = err
+			return scram.StoredCredentials{}, err
+		}
+		if !found {
+			// refusing at once would tell that the user doesn't exist
+			sc = auth.FakeSCRAMCredentials(username)
+		}
+		return scram.StoredCredentials{
+			KeyFactors: scram.KeyFactors{Salt: string(sc.Salt), Iters: sc.Iterations},
+			StoredKey:  sc.StoredKey,
+			ServerKey:  sc.ServerKey,
+		}, nil
+	})
+	if err != nil {
+		return nil, false
+	}
+	m.conv = server.NewConversation()
+
+	return m, true
+}
+
+func (m *scramMechanism) Next(ctx context.Context, response []byte) ([]byte, bool, error) {
+	m.ctx = ctx
+	msg, err := m.conv.Step(string(response))
+	if err != nil {
+		if m.lookupErr != nil {
+			return nil, false, m.lookupErr
+		}
+		return nil, false, ErrAuthFailed
+	}
+	if !m.conv.Done() {
+		return []byte(msg), false, nil
+	}
+	if !m.conv.Valid() || (m.conv.AuthzID() != "" && m.conv.AuthzID() != m.conv.Username()) {
+		return nil, false, ErrAuthFailed
+	}
+	return []byte(msg), true, nil
+}
+
+func (m *scramMechanism) Username() string {
+	return m.conv.Username()
+}
@@ -0,0 +1,1306 @@
+// Package backendtest is the conformance suite for implementations of backend.StorageBackend.
+// A backend runs it from its own test with a constructor of empty backends:
+//
+//	func TestConformance(t *testing.T) {
+//		backendtest.Run(t, func(t *testing.T) backend.StorageBackend {
+//			return memory.NewMemoryBackend()
+//		})
+//	}
+package backendtest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/utils"
+)
+
+// ctx is passed to all calls, none of the cases cancels it
+var ctx = context.Background()
+
+// Run runs every case of the suite against a new backend returned by newBackend,
+// the backend must be empty and mustn't share its data with the other ones.
+func Run(t *testing.T, newBackend func(t *testing.T) backend.StorageBackend) {
+	cases := []struct {
+		name string
+		run  func(t *testing.T, b backend.StorageBackend)
+	}{
+		{"Groups", testGroups},
+		{"ListGroupsByPattern", testListGroupsByPattern},
+		{"UpdateGroup", testUpdateGroup},
+		{"DeleteGroup", testDeleteGroup},
+		{"WaterMarks", testWaterMarks},
+		{"SaveArticle", testSaveArticle},
+		{"Crosspost", testCrosspost},
+		{"GetArticleNumbers", testGetArticleNumbers},
+		{"GetArticlesByRange", testGetArticlesByRange},
+		{"Overview", testOverview},
+		{"Search", testSearch},
+		{"LastNextArticle", testLastNextArticle},
+		{"GetNewArticlesSince", testGetNewArticlesSince},
+		{"GetArticlesSinceID", testGetArticlesSinceID},
+		{"Threads", testThreads},
+		{"ThreadTree", testThreadTree},
+		{"OrphanReplies", testOrphanReplies},
+		{"History", testHistory},
+		{"Users", testUsers},
+		{"ACL", testACL},
+		{"PendingArticles", testPendingArticles},
+		{"PublishPendingArticle", testPublishPendingArticle},
+		{"State", testState},
+		{"FeedQueue", testFeedQueue},
+		{"Bans", testBans},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			c.run(t, newBackend(t))
+		})
+	}
+}
+
+func createGroup(t *testing.T, b backend.StorageBackend, name string) models.Group {
+	t.Helper()
+	if err := b.CreateGroup(ctx, models.Group{GroupName: name}); err != nil {
+		t.Fatalf("CreateGroup(%s): %v", name, err)
+	}
+	g, err := b.GetGroup(ctx, name)
+	if err != nil {
+		t.Fatalf("GetGroup(%s): %v", name, err)
+	}
+	return g
+}
+
+// newArticle returns an article like the server builds it, the subject is the message id.
+func newArticle(t *testing.T, messageID string, header ...string) models.Article {
+	t.Helper()
+	a := models.Article{
+		Header: textproto.MIMEHeader{},
+		Body:   fmt.Sprintf("Body of %s\nsecond line\n", messageID),
+	}
+	a.Header.Set("Message-ID", messageID)
+	a.Header.Set("Subject", messageID)
+	a.Header.Set("From", "tester@example.com")
+	a.Header.Set("Date", "Mon, 02 Jan 2006 15:04:05 +0000")
+	for i := 0; i+1 < len(header); i += 2 {
+		a.Header.Set(header[i], header[i+1])
+	}
+	headerJson, err := json.Marshal(a.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.HeaderRaw = string(headerJson)
+	return a
+}
+
+func reply(t *testing.T, messageID, thread string) models.Article {
+	t.Helper()
+	return nestedReply(t, messageID, thread, thread)
+}
+
+func nestedReply(t *testing.T, messageID, thread, parent string) models.Article {
+	t.Helper()
+	a := newArticle(t, messageID, "References", parent)
+	a.Thread = sql.NullString{String: thread, Valid: true}
+	a.Parent = sql.NullString{String: parent, Valid: true}
+	return a
+}
+
+func post(t *testing.T, b backend.StorageBackend, a models.Article, groups ...string) {
+	t.Helper()
+	if err := b.SaveArticle(ctx, a, groups); err != nil {
+		t.Fatalf("SaveArticle(%s): %v", a.Header.Get("Message-ID"), err)
+	}
+}
+
+// postN posts articles <1@test>...<n@test> to the group.
+func postN(t *testing.T, b backend.StorageBackend, group string, n int) {
+	t.Helper()
+	for i := 1; i <= n; i++ {
+		post(t, b, newArticle(t, fmt.Sprintf("<%d@test>", i)), group)
+	}
+}
+
+func deleteArticle(t *testing.T, b backend.StorageBackend, messageID string) {
+	t.Helper()
+	if err := b.DeleteArticle(ctx, messageID); err != nil {
+		t.Fatalf("DeleteArticle(%s): %v", messageID, err)
+	}
+}
+
+func expectErr(t *testing.T, what string, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Errorf("%s: expected %v, got %v", what, want, err)
+	}
+}
+
+// equal compares slices treating nil and empty ones as equal.
+func equal(t *testing.T, what string, got, want interface{}) {
+	t.Helper()
+	gv, wv := reflect.ValueOf(got), reflect.ValueOf(want)
+	if gv.Len() == 0 && wv.Len() == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+func groupNames(groups []models.Group) []string {
+	var names []string
+	for _, v := range groups {
+		names = append(names, v.GroupName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func testGroups(t *testing.T, b backend.StorageBackend) {
+	for _, v := range []string{"comp.lang.go", "comp.lang.c", "misc.test"} {
+		createGroup(t, b, v)
+	}
+	if err := b.CreateGroup(ctx, models.Group{GroupName: "misc.test"}); err == nil {
+		t.Error("CreateGroup of existing group succeeded")
+	}
+	_, err := b.GetGroup(ctx, "no.such.group")
+	expectErr(t, "GetGroup of missing group", err, backend.ErrNoSuchGroup)
+
+	groups, err := b.ListGroups(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "ListGroups", groupNames(groups), []string{"comp.lang.c", "comp.lang.go", "misc.test"})
+
+	g, err := b.GetGroup(ctx, "comp.lang.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.ID == 0 || g.Moderated || g.HighWaterMark != 0 || g.CreatedAt.IsZero() || g.Creator != "" {
+		t.Errorf("GetGroup returned unexpected group %+v", g)
+	}
+
+	if err := b.CreateGroup(ctx, models.Group{GroupName: "misc.created", Creator: "admin@example.org"}); err != nil {
+		t.Fatal(err)
+	}
+	created, err := b.GetGroup(ctx, "misc.created")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Creator != "admin@example.org" {
+		t.Errorf("GetGroup: got creator %q, want admin@example.org", created.Creator)
+	}
+	if err := b.DeleteGroup(ctx, &created); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		since time.Time
+		want  []string
+	}{
+		{time.Now().Add(-time.Hour), []string{"comp.lang.c", "comp.lang.go", "misc.test"}},
+		{time.Now().Add(time.Hour), nil},
+	}
+	for _, c := range cases {
+		groups, err := b.GetNewGroupsSince(ctx, c.since.Unix())
+		if err != nil {
+			t.Fatal(err)
+		}
+		equal(t, fmt.Sprintf("GetNewGroupsSince(%s)", c.since), groupNames(groups), c.want)
+	}
+}
+
+func testListGroupsByPattern(t *testing.T, b backend.StorageBackend) {
+	for _, v := range []string{"comp.lang.go", "comp.lang.c", "comp.os.linux", "misc.test"} {
+		createGroup(t, b, v)
+	}
+
+	cases := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*", []string{"comp.lang.c", "comp.lang.go", "comp.os.linux", "misc.test"}},
+		{"comp.lang.*", []string{"comp.lang.c", "comp.lang.go"}},
+		{"comp.*,!comp.lang.c", []string{"comp.lang.go", "comp.os.linux"}},
+		{"misc.test", []string{"misc.test"}},
+		{"comp.lang.?", []string{"comp.lang.c"}},
+		{"alt.*", nil},
+	}
+	for _, c := range cases {
+		groups, err := b.ListGroupsByPattern(ctx, c.pattern)
+		if err != nil {
+			t.Fatalf("ListGroupsByPattern(%s): %v", c.pattern, err)
+		}
+		equal(t, fmt.Sprintf("ListGroupsByPattern(%s)", c.pattern), groupNames(groups), c.want)
+	}
+}
+
+func testUpdateGroup(t *testing.T, b backend.StorageBackend) {
+	g := createGroup(t, b, "misc.test")
+	post(t, b, newArticle(t, "<1@test>"), "misc.test")
+
+	description := "Testing"
+	g.GroupName = "misc.testing"
+	g.Description = &description
+	g.Moderated = true
+	if err := b.UpdateGroup(ctx, g); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := b.GetGroup(ctx, "misc.test")
+	expectErr(t, "GetGroup of the old name", err, backend.ErrNoSuchGroup)
+	updated, err := b.GetGroup(ctx, "misc.testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.ID != g.ID || !updated.Moderated || updated.Description == nil || *updated.Description != description || updated.HighWaterMark != 1 {
+		t.Errorf("GetGroup returned unexpected group %+v", updated)
+	}
+
+	a, err := b.GetArticleByNumber(ctx, &updated, 1)
+	if err != nil {
+		t.Fatalf("GetArticleByNumber in the renamed group: %v", err)
+	}
+	if a.Header.Get("Message-ID") != "<1@test>" {
+		t.Errorf("GetArticleByNumber in the renamed group returned %s", a.Header.Get("Message-ID"))
+	}
+	groups, err := b.GetArticleGroups(ctx, "<1@test>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "GetArticleGroups after the rename", groupNames(groups), []string{"misc.testing"})
+}
+
+func testDeleteGroup(t *testing.T, b backend.StorageBackend) {
+	g := createGroup(t, b, "misc.test")
+	other := createGroup(t, b, "misc.other")
+	post(t, b, newArticle(t, "<1@test>"), "misc.test")
+	post(t, b, newArticle(t, "<2@test>"), "misc.test", "misc.other")
+	if err := b.SaveACLEntry(ctx, models.ACLEntry{GroupID: g.ID, Username: "alice", CanRead: true}); err != nil {
+		t.Fatal(err)
+	}
+	id, err := b.SavePendingArticle(ctx, newArticle(t, "<3@test>"), &g, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.DeleteGroup(ctx, &g); err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.GetGroup(ctx, "misc.test")
+	expectErr(t, "GetGroup of deleted group", err, backend.ErrNoSuchGroup)
+	_, err = b.GetPendingArticle(ctx, id)
+	expectErr(t, "GetPendingArticle of deleted group", err, backend.ErrNotFound)
+	entries, err := b.GetGroupACL(ctx, &g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "GetGroupACL of deleted group", entries, []models.ACLEntry(nil))
+	_, err = b.GetArticle(ctx, "<1@test>")
+	expectErr(t, "GetArticle of article only in deleted group", err, backend.ErrNoSuchArticle)
+
+	a, err := b.GetArticleByNumber(ctx, &other, 1)
+	if err != nil {
+		t.Fatalf("crossposted article is gone from the other group: %v", err)
+	}
+	if a.Header.Get("Message-ID") != "<2@test>" {
+		t.Errorf("GetArticleByNumber returned %s", a.Header.Get("Message-ID"))
+	}
+	if count, err := b.GetArticlesCount(ctx, &other); err != nil || count != 1 {
+		t.Errorf("GetArticlesCount of the other group: got %d, %v", count, err)
+	}
+
+	// a group created under the same name starts afresh
+	g = createGroup(t, b, "misc.test")
+	if count, err := b.GetArticlesCount(ctx, &g); err != nil || count != 0 {
+		t.Errorf("GetArticlesCount of the recreated group: got %d, %v", count, err)
+	}
+}
+
+func expectWaterMarks(t *testing.T, b backend.StorageBackend, g *models.Group, count, low, high int) {
+	t.Helper()
+	if v, err := b.GetArticlesCount(ctx, g); err != nil || v != count {
+		t.Errorf("GetArticlesCount: got %d, %v, want %d", v, err, count)
+	}
+	if v, err := b.GetGroupLowWaterMark(ctx, g); err != nil || v != low {
+		t.Errorf("GetGroupLowWaterMark: got %d, %v, want %d", v, err, low)
+	}
+	if v, err := b.GetGroupHighWaterMark(ctx, g); err != nil || v != high {
+		t.Errorf("GetGroupHighWaterMark: got %d, %v, want %d", v, err, high)
+	}
+}
+
+func testWaterMarks(t *testing.T, b backend.StorageBackend) {
+	g := createGroup(t, b, "misc.test")
+	// RFC 3977 6.1.1.2: the low water mark of an empty group is greater than the high one
+	expectWaterMarks(t, b, &g, 0, 1, 0)
+
+	postN(t, b, "misc.test", 3)
+	expectWaterMarks(t, b, &g, 3, 1, 3)
+
+	deleteArticle(t, b, "<1@test>")
+	expectWaterMarks(t, b, &g, 2, 2, 3)
+
+	// numbers of removed articles are never reused
+	deleteArticle(t, b, "<3@test>")
+	expectWaterMarks(t, b, &g, 1, 2, 3)
+	deleteArticle(t, b, "<2@test>")
+	expectWaterMarks(t, b, &g, 0, 4, 3)
+
+	post(t, b, newArticle(t, "<4@test>"), "misc.test")
+	expectWaterMarks(t, b, &g, 1, 4, 4)
+}
+
+func testSaveArticle(t *testing.T, b backend.StorageBackend) {
+	g := createGroup(t, b, "misc.test")
+
+	a := newArticle(t, "<1@test>", "Expires", "Mon, 02 Jan 2040 15:04:05 +0000")
+	a.Attachments = []models.Attachment{{ContentType: "image/png", FileName: "0b9c4f.png"}}
+	expectErr(t, "SaveArticle into missing group", b.SaveArticle(ctx, a, []string{"no.such.group"}), backend.ErrNoSuchGroup)
+	post(t, b, a, "misc.test")
+	expectErr(t, "SaveArticle of duplicate article", b.SaveArticle(ctx, a, []string{"misc.test"}), backend.ErrDuplicate)
+
+	check := func(what string, got models.Article) {
+		t.Helper()
+		if got.ID == 0 || got.CreatedAt.IsZero() {
+			t.Errorf("%s: article has no id or creation time", what)
+		}
+		if got.ArticleNumber != 1 {
+			t.Errorf("%s: article number is %d", what, got.ArticleNumber)
+		}
+		if got.Header.Get("Message-ID") != "<1@test>" || got.Header.Get("Subject") != "<1@test>" {
+			t.Errorf("%s: unexpected header %v", what, got.Header)
+		}
+		if got.Body != a.Body {
+			t.Errorf("%s: body is %q", what, got.Body)
+		}
+		if got.Thread.Valid {
+			t.Errorf("%s: article without thread got thread %s", what, got.Thread.String)
+		}
+		equal(t, what+" attachments", got.Attachments, a.Attachments)
+	}
+
+	got, err := b.GetArticle(ctx, "<1@test>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("GetArticle", got)
+	got, err = b.GetArticleByNumber(ctx, &g, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("GetArticleByNumber", got)
+
+	_, err = b.GetArticle(ctx, "<missing@test>")
+	expectErr(t, "GetArticle of missing article", err, backend.ErrNoSuchArticle)
+	_, err = b.GetArticleByNumber(ctx, &g, 2)
+	expectErr(t, "GetArticleByNumber of missing article", err, backend.ErrNoSuchArticle)
+	expectErr(t, "DeleteArticle of missing article", b.DeleteArticle(ctx, "<missing@test>"), backend.ErrNoSuchArticle)
+
+	deleteArticle(t, b, "<1@test>")
+	_, err = b.GetArticle(ctx, "<1@test>")
+	expectErr(t, "GetArticle of deleted article", err, backend.ErrNoSuchArticle)
+	_, err = b.GetArticleByNumber(ctx, &g, 1)
+	expectErr(t, "GetArticleByNumber of deleted article", err, backend.ErrNoSuchArticle)
+}
+
+func testCrosspost(t *testing.T, b backend.StorageBackend) {
+	first := createGroup(t, b, "misc.first")
+	second := createGroup(t, b, "misc.second")
+	post(t, b, newArticle(t, "<1@test>"), "misc.first")
+	post(t, b, newArticle(t, "<2@test>", "Expires", "Mon, 02 Jan 2040 15:04:05 +0000"), "misc.first", "misc.second")
+
+	// every group numbers its articles on its own
+	cases := []struct {
+		group     *models.Group
+		number    int
+		messageID string
+	}{
+		{&first, 1, "<1@test>"},
+		{&first, 2, "<2@test>"},
+		{&second, 1, "<2@test>"},
+	}
+	for _, c := range cases {
+		a, err := b.GetArticleByNumber(ctx, c.group, c.number)
+		if err != nil {
+			t.Fatalf("GetArticleByNumber(%s, %d): %v", c.group.GroupName, c.number, err)
+		}
+		if a.Header.Get("Message-ID") != c.messageID || a.ArticleNumber != c.number {
+			t.Errorf("GetArticleByNumber(%s, %d) returned %s with number %d", c.group.GroupName, c.number, a.Header.Get("Message-ID"), a.ArticleNumber)
+		}
+	}
+	expectWaterMarks(t, b, &first, 2, 1, 2)
+	expectWaterMarks(t, b, &second, 1, 1, 1)
+
+	for messageID, want := range map[string][]string{
+		"<1@test>":       {"misc.first"},
+		"<2@test>":       {"misc.first", "misc.second"},
+		"<missing@test>": nil,
+	} {
+		groups, err := b.GetArticleGroups(ctx, messageID)
+		if err != nil {
+			t.Fatalf("GetArticleGroups(%s): %v", messageID, err)
+		}
+		equal(t, "GetArticleGroups("+messageID+")", groupNames(groups), want)
+	}
+
+	info, err := b.GetGroupArticleInfo(ctx, &first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info) != 2 {
+		t.Fatalf("GetGroupArticleInfo returned %d articles", len(info))
+	}
+	for i, v := range []struct {
+		number, groups     int
+		messageID, expires string
+	}{
+		{1, 1, "<1@test>", ""},
+		{2, 2, "<2@test>", "Mon, 02 Jan 2040 15:04:05 +0000"},
+	} {
+		got := info[i]
+		if got.Number != v.number || got.Groups != v.groups || got.MessageID != v.messageID || got.Expires != v.expires || got.Size <= 0 || got.CreatedAt.IsZero() {
+			t.Errorf("GetGroupArticleInfo returned unexpected %+v", got)
+		}
+	}
+
+	// the crossposted article is removed from all groups at once
+	deleteArticle(t, b, "<2@test>")
+	expectWaterMarks(t, b, &first, 1, 1, 2)
+	expectWaterMarks(t, b, &second, 0, 2, 1)
+}
+
+func testGetArticleNumbers(t *testing.T, b backend.StorageBackend) {
+	g := createGroup(t, b, "misc.test")
+	postN(t, b, "misc.test", 5)
+	deleteArticle(t, b, "<3@test>")
+
+	// see GetArticleNumbers in the interface: 0, 0 is the whole group, -1, n is the article n,
+	// n, -1 is everything after n, and the range is exclusive otherwise
+	cases := []struct {
+		low, high int64
+		want      []int64
+	}{
+		{0, 0, []int64{1, 2, 4, 5}},
+		{-1, 4, []int64{4}},
+		{-1, 3, nil},
+		{2, -1, []int64{4, 5}},
+		{5, -1, nil},
+		{-1, -1, nil},
+		{1, 5, []int64{2, 4}},
+		{0, 3, []int64{1, 2}},
+		{5, 10, nil},
+	}
+	for _, c := range cases {
+		numbers, err := b.GetArticleNumbers(ctx, &g, c.low, c.high)
+		if err != nil {
+			t.Fatalf("GetArticleNumbers(%d, %d): %v", c.low, c.high, err)
+		}
+		equal(t, fmt.Sprintf("GetArticleNumbers(%d, %d)", c.low, c.high), numbers, c.want)
+	}
+}
+
+func articleNumbers(articles []models.Article) []int {
+	var numbers []int
+	for _, v := range articles {
+		numbers = append(numbers, v.ArticleNumber)
+	}
+	return numbers
+}
+
+func testGetArticlesByRange(t *testing.T, b backend.StorageBackend) {
+	g := createGroup(t, b, "misc.test")
+	createGroup(t, b, "misc.other")
+	post(t, b, newArticle(t, "<0@test>"), "misc.other")
+	postN(t, b, "misc.test", 5)
+	deleteArticle(t, b, "<3@test>")
+
+	cases := []struct {
+		low, high int64
+		want      []int
+	}{
+		{1, 5, []int{1, 2, 4, 5}},
+		{2, 4, []int{2, 4}},
+		{3, 3, nil},
+		{4, 100, []int{4, 5}},
+		{6, 10, nil},
+	}
+	for _, c := range cases {
+		articles, err := b.GetArticlesByRange(ctx, &g, c.low, c.high)
+		if err != nil {
+			t.Fatalf("GetArticlesByRange(%d, %d): %v", c.low, c.high, err)
+		}
+		what := fmt.Sprintf("GetArticlesByRange(%d, %d)", c.low, c.high)
+		equal(t, what, articleNumbers(articles), c.want)
+		for _, v := range articles {
+			if v.Header.Get("Message-ID") != fmt.Sprintf("<%d@test>", v.ArticleNumber) {
+				t.Errorf("%s returned %s as article %d", what, v.Header.Get("Message-ID"), v.ArticleNumber)
+			}
+		}
+	}
+}
+
+func testOverview(t *testing.T, b backend.StorageBackend) {
+	g := createGroup(t, b, "misc.test")
+	other := createGroup(t, b, "misc.other")
+	post(t, b, newArticle(t, "<0@test>"), "misc.other")
+	postN(t, b, "misc.test", 4)
+	post(t, b, newArticle(t, "<5@test>", "Subject", "tab\there", "References", "<1@test>"), "misc.test", "misc.other")
+	deleteArticle(t, b, "<3@test>")
+
+	overview := func(g *models.Group, low, high int64) []models.Overview {
+		t.Helper()
+		var res []models.Overview
+		if err := b.GetOverview(ctx, g, low, high, func(o models.Overview) error {
+			res = append(res, o)
+			return nil
+		}); err != nil {
+			t.Fatalf("GetOverview(%d, %d): %v", low, high, err)
+		}
+		return res
+	}
+	numbers := func(records []models.Overview) []int {
+		var res []int
+		for _, v := range records {
+			res = append(res, v.Number)
+		}
+		return res
+	}
+
+	equal(t, "GetOverview(1, 5)", numbers(overview(&g, 1, 5)), []int{1, 2, 4, 5})
+	equal(t, "GetOverview(3, 3)", numbers(overview(&g, 3, 3)), []int(nil))
+	equal(t, "GetOverview(4, 100)", numbers(overview(&g, 4, 100)), []int{4, 5})
+
+	records := overview(&g, 1, 1)
+	if len(records) != 1 {
+		t.Fatalf("GetOverview(1, 1) returned %d records", len(records))
+	}
+	a := newArticle(t, "<1@test>")
+	want, err := utils.NewOverview(&a, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// backends may count the size of the article as it is stored, so only its presence is checked
+	got := records[0]
+	if got.Bytes <= 0 {
+		t.Errorf("overview of <1@test>: no size in %+v", got)
+	}
+	got.Bytes = want.Bytes
+	if got != want {
+		t.Errorf("overview of <1@test>: got %+v, want %+v", got, want)
+	}
+
+	records = overview(&other, 2, 2)
+	if len(records) != 1 {
+		t.Fatalf("GetOverview of crossposted article returned %d records", len(records))
+	}
+	if o := records[0]; o.Subject != "tab here" || o.References != "<1@test>" || o.Lines != 2 {
+		t.Errorf("overview of <5@test>: got %+v", o)
+	}
+}
+
+func testSearch(t *testing.T, b backend.StorageBackend) {
+	g := createGroup(t, b, "misc.test")
+	other := createGroup(t, b, "misc.other")
+	createGroup(t, b, "misc.hidden")
+	post(t, b, newArticle(t, "<1@test>", "Subject", "Gophers and databases", "From", "alice@example.com"), "misc.test")
+	post(t, b, newArticle(t, "<2@test>", "Subject", "Unrelated"), "misc.test", "misc.other")
+	post(t, b, newArticle(t, "<3@test>", "Subject", "Database gophers", "From", "bob@example.com"), "misc.hidden")
+	post(t, b, newArticle(t, "<4@test>", "Subject", "gophers again"), "misc.test")
+	deleteArticle(t, b, "<4@test>")
+
+	search := func(groups []models.Group, query string, limit int) []string {
+		t.Helper()
+		results, err := b.SearchArticles(ctx, groups, query, limit)
+		if err != nil {
+			t.Fatalf("SearchArticles(%q): %v", query, err)
+		}
+		var res []string
+		for _, v := range results {
+			res = append(res, fmt.Sprintf("%s %s:%d", v.MessageID, v.GroupName, v.ArticleNumber))
+		}
+		return res
+	}
+
+	groups := []models.Group{g, other}
+	equal(t, "search in subject", search(groups, "GOPHERS", 10), []string{"<1@test> misc.test:1"})
+	equal(t, "search of several words", search(groups, "gophers databases", 10), []string{"<1@test> misc.test:1"})
+	equal(t, "search in sender", search(groups, "alice", 10), []string{"<1@test> misc.test:1"})
+	equal(t, "search in body", search(groups, "second", 10), []string{"<2@test> misc.test:2", "<2@test> misc.other:1", "<1@test> misc.test:1"})
+	equal(t, "search with limit", search(groups, "second", 1), []string{"<2@test> misc.test:2"})
+	equal(t, "search in one group", search([]models.Group{other}, "second", 10), []string{"<2@test> misc.other:1"})
+	equal(t, "search without matches", search(groups, "nothing", 10), []string(nil))
+	equal(t, "search in no groups", search(nil, "second", 10), []string(nil))
+}
+
+func testLastNextArticle(t *testing.T, b backend.StorageBackend) {
+	g := createGroup(t, b, "misc.test")
+	postN(t, b, "misc.test", 5)
+	deleteArticle(t, b, "<3@test>")
+
+	cases := []struct {
+		current    int
+		last, next int // zero means there is no such article
+	}{
+		{1, 0, 2},
+		{2, 1, 4},
+		{4, 2, 5},
+		{5, 4, 0},
+	}
+	for _, c := range cases {
+		current, err := b.GetArticleByNumber(ctx, &g, c.current)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []struct {
+			name string
+			get  func(ctx context.Context, g *models.Group, a *models.Article) (models.Article, error)
+			want int
+		}{
+			{"GetLastArticleByNum", b.GetLastArticleByNum, c.last},
+			{"GetNextArticleByNum", b.GetNextArticleByNum, c.next},
+		} {
+			what := fmt.Sprintf("%s(%d)", v.name, c.current)
+			a, err := v.get(ctx, &g, &current)
+			if v.want == 0 {
+				expectErr(t, what, err, backend.ErrNoSuchArticle)
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: %v", what, err)
+				continue
+			}
+			if a.Header.Get("Message-ID") != fmt.Sprintf("<%d@test>", v.want) {
+				t.Errorf("%s returned %s, want article %d", what, a.Header.Get("Message-ID"), v.want)
+			}
+		}
+	}
+}
+
+func testGetNewArticlesSince(t *testing.T, b backend.StorageBackend) {
+	createGroup(t, b, "misc.test")
+	postN(t, b, "misc.test", 3)
+	deleteArticle(t, b, "<2@test>")
+
+	cases := []struct {
+		since time.Time
+		want  []string
+	}{
+		{time.Now().Add(-time.Hour), []string{"<1@test>", "<3@test>"}},
+		{time.Now().Add(time.Hour), nil},
+	}
+	for _, c := range cases {
+		messageIDs, err := b.GetNewArticlesSince(ctx, c.since.Unix())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(messageIDs)
+		equal(t, fmt.Sprintf("GetNewArticlesSince(%s)", c.since), messageIDs, c.want)
+	}
+}
+
+func testGetArticlesSinceID(t *testing.T, b backend.StorageBackend) {
+	createGroup(t, b, "misc.test")
+	postN(t, b, "misc.test", 3)
+
+	articles, err := b.GetArticlesSinceID(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(articles) != 3 {
+		t.Fatalf("GetArticlesSinceID(0, 10) returned %d articles", len(articles))
+	}
+	for i, v := range articles {
+		if v.Header.Get("Message-ID") != fmt.Sprintf("<%d@test>", i+1) {
+			t.Errorf("GetArticlesSinceID returned %s at position %d", v.Header.Get("Message-ID"), i)
+		}
+		if i > 0 && v.ID <= articles[i-1].ID {
+			t.Errorf("GetArticlesSinceID returned ids out of order: %d after %d", v.ID, articles[i-1].ID)
+		}
+	}
+
+	next, err := b.GetArticlesSinceID(ctx, articles[0].ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(next) != 1 || next[0].ID != articles[1].ID {
+		t.Errorf("GetArticlesSinceID(%d, 1) didn't return the second article", articles[0].ID)
+	}
+	next, err = b.GetArticlesSinceID(ctx, articles[2].ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "GetArticlesSinceID of the last id", next, []models.Article(nil))
+}
+
+func testThreads(t *testing.T, b backend.StorageBackend) {
+	g := createGroup(t, b, "misc.test")
+	other := createGroup(t, b, "misc.other")
+	post(t, b, newArticle(t, "<1@test>"), "misc.test")
+	post(t, b, newArticle(t, "<2@test>"), "misc.test", "misc.other")
+	post(t, b, reply(t, "<3@test>", "<1@test>"), "misc.test")
+	post(t, b, reply(t, "<4@test>", "<1@test>"), "misc.test")
+	post(t, b, reply(t, "<5@test>", "<2@test>"), "misc.test", "misc.other")
+
+	got, err := b.GetArticle(ctx, "<3@test>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Thread.Valid || got.Thread.String != "<1@test>" {
+		t.Errorf("GetArticle returned thread %v", got.Thread)
+	}
+
+	// threads are listed from the newest one
+	threadCases := []struct {
+		group            *models.Group
+		perPage, pageNum int
+		want             []int
+	}{
+		{&g, 10, 0, []int{2, 1}},
+		{&g, 1, 0, []int{2}},
+		{&g, 1, 1, []int{1}},
+		{&g, 1, 2, nil},
+		{&other, 10, 0, []int{1}},
+	}
+	for _, c := range threadCases {
+		numbers, err := b.GetNewThreads(ctx, c.group, c.perPage, c.pageNum, models.ThreadOrderCreated)
+		if err != nil {
+			t.Fatal(err)
+		}
+		equal(t, fmt.Sprintf("GetNewThreads(%s, %d, %d)", c.group.GroupName, c.perPage, c.pageNum), numbers, c.want)
+	}
+
+	// replies are listed in the order of posting
+	replyCases := []struct {
+		group     *models.Group
+		threadNum int
+		want      []int
+	}{
+		{&g, 1, []int{3, 4}},
+		{&g, 2, []int{5}},
+		{&g, 3, nil},
+		{&g, 99, nil},
+		{&other, 1, []int{2}},
+	}
+	for _, c := range replyCases {
+		numbers, err := b.GetThread(ctx, c.group, c.threadNum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		equal(t, fmt.Sprintf("GetThread(%s, %d)", c.group.GroupName, c.threadNum), numbers, c.want)
+	}
+
+	// a new reply brings the older thread up
+	post(t, b, reply(t, "<6@test>", "<1@test>"), "misc.test")
+	for _, c := range []struct {
+		order models.ThreadOrder
+		want  []int
+	}{
+		{models.ThreadOrderCreated, []int{2, 1}},
+		{models.ThreadOrderLastReply, []int{1, 2}},
+	} {
+		numbers, err := b.GetNewThreads(ctx, &g, 10, 0, c.order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		equal(t, fmt.Sprintf("GetNewThreads in order %d", c.order), numbers, c.want)
+	}
+}
+
+func testThreadTree(t *testing.T, b backend.StorageBackend) {
+	g := createGroup(t, b, "misc.test")
+	createGroup(t, b, "misc.other")
+	post(t, b, newArticle(t, "<1@test>"), "misc.test")
+	post(t, b, reply(t, "<2@test>", "<1@test>"), "misc.test")
+	post(t, b, nestedReply(t, "<3@test>", "<1@test>", "<2@test>"), "misc.test")
+	post(t, b, reply(t, "<4@test>", "<1@test>"), "misc.test")
+	post(t, b, nestedReply(t, "<5@test>", "<1@test>", "<3@test>"), "misc.other")
+	post(t, b, nestedReply(t, "<6@test>", "<1@test>", "<5@test>"), "misc.test")
+
+	tree := func(threadNum int) []string {
+		t.Helper()
+		nodes, err := b.GetThreadTree(ctx, &g, threadNum)
+		if err != nil {
+			t.Fatalf("GetThreadTree(%d): %v", threadNum, err)
+		}
+		var res []string
+		for _, v := range nodes {
+			res = append(res, fmt.Sprintf("%d %s parent %d depth %d", v.Number, v.MessageID, v.Parent, v.Depth))
+		}
+		return res
+	}
+
+	// <6@test> replies to the article which isn't in the group, so it is attached to the root
+	equal(t, "GetThreadTree(1)", tree(1), []string{
+		"1 <1@test> parent 0 depth 0",
+		"2 <2@test> parent 1 depth 1",
+		"3 <3@test> parent 2 depth 2",
+		"4 <4@test> parent 1 depth 1",
+		"5 <6@test> parent 1 depth 1",
+	})
+	equal(t, "GetThreadTree(2)", tree(2), []string{"2 <2@test> parent 0 depth 0"})
+	equal(t, "GetThreadTree(99)", tree(99), []string(nil))
+
+	got, err := b.GetArticle(ctx, "<3@test>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Parent.Valid || got.Parent.String != "<2@test>" {
+		t.Errorf("GetArticle returned parent %v", got.Parent)
+	}
+}
+
+func testOrphanReplies(t *testing.T, b backend.StorageBackend) {
+	g := createGroup(t, b, "misc.test")
+	// the ancestors of the replies haven't arrived, the oldest known one stands for the thread root
+	post(t, b, nestedReply(t, "<1@test>", "<root@test>", "<mid@test>"), "misc.test")
+	post(t, b, reply(t, "<2@test>", "<mid@test>"), "misc.test")
+
+	threads := func(what string, want []int) {
+		t.Helper()
+		numbers, err := b.GetNewThreads(ctx, &g, 10, 0, models.ThreadOrderCreated)
+		if err != nil {
+			t.Fatal(err)
+		}
+		equal(t, what+": GetNewThreads", numbers, want)
+	}
+	tree := func(what string, threadNum int, want []string) {
+		t.Helper()
+		nodes, err := b.GetThreadTree(ctx, &g, threadNum)
+		if err != nil {
+			t.Fatalf("GetThreadTree(%d): %v", threadNum, err)
+		}
+		var res []string
+		for _, v := range nodes {
+			res = append(res, fmt.Sprintf("%d parent %d depth %d", v.Number, v.Parent, v.Depth))
+		}
+		equal(t, fmt.Sprintf("%s: GetThreadTree(%d)", what, threadNum), res, want)
+	}
+	thread := func(what string, messageID, want string) {
+		t.Helper()
+		a, err := b.GetArticle(ctx, messageID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !a.Thread.Valid || a.Thread.String != want {
+			t.Errorf("%s: thread of %s is %v, want %s", what, messageID, a.Thread, want)
+		}
+	}
+
+	threads("orphans", []int{2, 1})
+	tree("orphans", 1, []string{"1 parent 0 depth 0"})
+	numbers, err := b.GetThread(ctx, &g, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "orphans: GetThread(1)", numbers, []int(nil))
+
+	// the missing parent arrives, its own parent is still missing
+	post(t, b, reply(t, "<mid@test>", "<root@test>"), "misc.test")
+	thread("parent arrived", "<2@test>", "<root@test>")
+	threads("parent arrived", []int{1})
+	tree("parent arrived", 1, []string{
+		"3 parent 0 depth 0",
+		"1 parent 3 depth 1",
+		"2 parent 3 depth 1",
+	})
+	numbers, err = b.GetThread(ctx, &g, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "parent arrived: GetThread(1)", numbers, []int{2, 3})
+
+	// an article made before <mid@test> arrived, e.g. a pending one, joins the thread of its root
+	post(t, b, reply(t, "<4@test>", "<mid@test>"), "misc.test")
+	thread("late reply", "<4@test>", "<root@test>")
+
+	post(t, b, newArticle(t, "<root@test>"), "misc.test")
+	threads("root arrived", []int{5})
+	tree("root arrived", 5, []string{
+		"5 parent 0 depth 0",
+		"3 parent 5 depth 1",
+		"1 parent 3 depth 2",
+		"2 parent 3 depth 2",
+		"4 parent 3 depth 2",
+	})
+	numbers, err = b.GetThread(ctx, &g, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "root arrived: GetThread(5)", numbers, []int{1, 2, 3, 4})
+}
+
+func testHistory(t *testing.T, b backend.StorageBackend) {
+	createGroup(t, b, "misc.test")
+	postN(t, b, "misc.test", 2)
+	// times of history entries may have a resolution of seconds
+	time.Sleep(1100 * time.Millisecond)
+	arrived := time.Now()
+	time.Sleep(1100 * time.Millisecond)
+	if err := b.RememberMessageID(ctx, "<rejected@test>"); err != nil {
+		t.Fatal(err)
+	}
+	// remembering twice is fine
+	if err := b.RememberMessageID(ctx, "<rejected@test>"); err != nil {
+		t.Fatal(err)
+	}
+	deleteArticle(t, b, "<2@test>")
+
+	expect := func(what string, want map[string]bool) {
+		t.Helper()
+		for k, v := range want {
+			if ok, err := b.HasMessageID(ctx, k); err != nil || ok != v {
+				t.Errorf("%s: HasMessageID(%s) = %t, %v, want %t", what, k, ok, err, v)
+			}
+		}
+	}
+	expect("before purge", map[string]bool{"<1@test>": true, "<2@test>": true, "<rejected@test>": true, "<unknown@test>": false})
+
+	// deleted and rejected articles are still remembered, so they can't be posted again
+	expectErr(t, "SaveArticle of deleted article", b.SaveArticle(ctx, newArticle(t, "<2@test>"), []string{"misc.test"}), backend.ErrDuplicate)
+	expectErr(t, "SaveArticle of remembered message id", b.SaveArticle(ctx, newArticle(t, "<rejected@test>"), []string{"misc.test"}), backend.ErrDuplicate)
+
+	// message ids are remembered for the time after the articles have been removed, not after they arrived
+	n, err := b.PurgeHistory(ctx, arrived)
+	if err != nil || n != 0 {
+		t.Errorf("PurgeHistory of entries removed later: got %d, %v, want 0", n, err)
+	}
+	// stored articles are never forgotten
+	n, err = b.PurgeHistory(ctx, time.Now().Add(time.Hour))
+	if err != nil || n != 2 {
+		t.Errorf("PurgeHistory: got %d, %v, want 2", n, err)
+	}
+	expect("after purge", map[string]bool{"<1@test>": true, "<2@test>": false, "<rejected@test>": false})
+
+	post(t, b, newArticle(t, "<2@test>"), "misc.test")
+}
+
+func testUsers(t *testing.T, b backend.StorageBackend) {
+	_, err := b.GetUser(ctx, "alice")
+	expectErr(t, "GetUser of missing user", err, backend.ErrNotFound)
+
+	alice := models.User{
+		Username:        "alice",
+		PasswordHash:    "hash",
+		ScramSalt:       "salt",
+		ScramIterations: 4096,
+		ScramStoredKey:  "stored",
+		ScramServerKey:  "server",
+	}
+	for _, v := range []models.User{alice, {Username: "bob", PasswordHash: "bob's hash"}} {
+		if err := b.SaveUser(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := b.GetUser(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID == 0 || got.CreatedAt.IsZero() {
+		t.Error("GetUser returned user without id or creation time")
+	}
+	alice.ID, alice.CreatedAt = got.ID, got.CreatedAt
+	if !reflect.DeepEqual(got, alice) {
+		t.Errorf("GetUser: got %+v, want %+v", got, alice)
+	}
+
+	// saving existing user updates the credentials
+	alice.PasswordHash = "new hash"
+	if err := b.SaveUser(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := b.GetUser(ctx, "alice"); err != nil || got.PasswordHash != "new hash" || got.ID != alice.ID {
+		t.Errorf("GetUser after update: got %+v, %v", got, err)
+	}
+
+	users, err := b.ListUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, v := range users {
+		names = append(names, v.Username)
+	}
+	equal(t, "ListUsers", names, []string{"alice", "bob"})
+
+	g := createGroup(t, b, "misc.test")
+	if err := b.SaveACLEntry(ctx, models.ACLEntry{GroupID: g.ID, Username: "alice", CanRead: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.DeleteUser(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.GetUser(ctx, "alice")
+	expectErr(t, "GetUser of deleted user", err, backend.ErrNotFound)
+	entries, err := b.GetGroupACL(ctx, &g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "GetGroupACL after DeleteUser", entries, []models.ACLEntry(nil))
+}
+
+func testACL(t *testing.T, b backend.StorageBackend) {
+	g := createGroup(t, b, "misc.test")
+	other := createGroup(t, b, "misc.other")
+
+	for _, v := range []models.ACLEntry{
+		{GroupID: g.ID, Username: "alice", CanRead: true},
+		{GroupID: g.ID, Username: models.ACLAuthenticated, CanRead: true, CanPost: true},
+		{GroupID: g.ID, Username: models.ACLAnonymous},
+		{GroupID: other.ID, Username: "alice", CanModerate: true},
+		// replaces the first entry
+		{GroupID: g.ID, Username: "alice", CanRead: true, CanPost: true, CanModerate: true},
+	} {
+		if err := b.SaveACLEntry(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expect := func(what string, want []models.ACLEntry) {
+		t.Helper()
+		entries, err := b.GetGroupACL(ctx, &g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Username < entries[j].Username
+		})
+		equal(t, what, entries, want)
+	}
+	expect("GetGroupACL", []models.ACLEntry{
+		{GroupID: g.ID, Username: models.ACLAnonymous},
+		{GroupID: g.ID, Username: models.ACLAuthenticated, CanRead: true, CanPost: true},
+		{GroupID: g.ID, Username: "alice", CanRead: true, CanPost: true, CanModerate: true},
+	})
+
+	if err := b.DeleteACLEntry(ctx, &g, models.ACLAuthenticated); err != nil {
+		t.Fatal(err)
+	}
+	expect("GetGroupACL after DeleteACLEntry", []models.ACLEntry{
+		{GroupID: g.ID, Username: models.ACLAnonymous},
+		{GroupID: g.ID, Username: "alice", CanRead: true, CanPost: true, CanModerate: true},
+	})
+}
+
+func testPendingArticles(t *testing.T, b backend.StorageBackend) {
+	g := createGroup(t, b, "misc.moderated")
+	other := createGroup(t, b, "misc.other")
+
+	a := reply(t, "<1@test>", "<0@test>")
+	a.Attachments = []models.Attachment{{ContentType: "image/png", FileName: "0b9c4f.png"}}
+	id, err := b.SavePendingArticle(ctx, a, &g, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherID, err := b.SavePendingArticle(ctx, newArticle(t, "<2@test>"), &other, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == otherID {
+		t.Fatal("SavePendingArticle returned the same id twice")
+	}
+
+	got, err := b.GetPendingArticle(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != id || got.GroupID != g.ID || got.Submitter != "alice" || got.Body != a.Body || got.CreatedAt.IsZero() {
+		t.Errorf("GetPendingArticle returned unexpected %+v", got)
+	}
+	if got.Header.Get("Message-ID") != "<1@test>" || got.Thread != a.Thread {
+		t.Errorf("GetPendingArticle returned header %v and thread %v", got.Header, got.Thread)
+	}
+	equal(t, "GetPendingArticle attachments", got.Attachments, a.Attachments)
+
+	articles, err := b.GetPendingArticles(ctx, &g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(articles) != 1 || articles[0].ID != id {
+		t.Errorf("GetPendingArticles returned %+v", articles)
+	}
+
+	if err := b.DeletePendingArticle(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.GetPendingArticle(ctx, id)
+	expectErr(t, "GetPendingArticle of deleted article", err, backend.ErrNotFound)
+	expectErr(t, "DeletePendingArticle of deleted article", b.DeletePendingArticle(ctx, id), backend.ErrNotFound)
+	articles, err = b.GetPendingArticles(ctx, &g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "GetPendingArticles after DeletePendingArticle", articles, []models.PendingArticle(nil))
+	if _, err := b.GetPendingArticle(ctx, otherID); err != nil {
+		t.Errorf("GetPendingArticle of the other group: %v", err)
+	}
+}
+
+func testPublishPendingArticle(t *testing.T, b backend.StorageBackend) {
+	g := createGroup(t, b, "misc.moderated")
+	a := newArticle(t, "<1@test>")
+	id, err := b.SavePendingArticle(ctx, a, &g, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectErr(t, "PublishPendingArticle of missing article", b.PublishPendingArticle(ctx, id+100, a, []string{"misc.moderated"}), backend.ErrNotFound)
+	if _, err := b.GetArticle(ctx, "<1@test>"); err != backend.ErrNoSuchArticle {
+		t.Errorf("GetArticle after PublishPendingArticle of missing article: %v", err)
+	}
+
+	// the article stays pending when it can't be saved
+	expectErr(t, "PublishPendingArticle to missing group", b.PublishPendingArticle(ctx, id, a, []string{"no.such.group"}), backend.ErrNoSuchGroup)
+	if _, err := b.GetPendingArticle(ctx, id); err != nil {
+		t.Errorf("GetPendingArticle after failed PublishPendingArticle: %v", err)
+	}
+
+	if err := b.PublishPendingArticle(ctx, id, a, []string{"misc.moderated"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GetArticle(ctx, "<1@test>"); err != nil {
+		t.Errorf("GetArticle of published article: %v", err)
+	}
+	_, err = b.GetPendingArticle(ctx, id)
+	expectErr(t, "GetPendingArticle of published article", err, backend.ErrNotFound)
+	expectErr(t, "PublishPendingArticle of published article", b.PublishPendingArticle(ctx, id, a, []string{"misc.moderated"}), backend.ErrNotFound)
+
+	id, err = b.SavePendingArticle(ctx, a, &g, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectErr(t, "PublishPendingArticle of duplicate", b.PublishPendingArticle(ctx, id, a, []string{"misc.moderated"}), backend.ErrDuplicate)
+	if _, err := b.GetPendingArticle(ctx, id); err != nil {
+		t.Errorf("GetPendingArticle after PublishPendingArticle of duplicate: %v", err)
+	}
+}
+
+func testState(t *testing.T, b backend.StorageBackend) {
+	_, err := b.GetState(ctx, "key")
+	expectErr(t, "GetState of missing key", err, backend.ErrNotFound)
+
+	for _, v := range []string{"first", "second"} {
+		if err := b.SetState(ctx, "key", v); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := b.GetState(ctx, "key"); err != nil || got != v {
+			t.Errorf("GetState: got %q, %v, want %q", got, err, v)
+		}
+	}
+}
+
+func queuedIDs(items []models.FeedQueueItem) []string {
+	var messageIDs []string
+	for _, v := range items {
+		messageIDs = append(messageIDs, v.MessageID)
+	}
+	sort.Strings(messageIDs)
+	return messageIDs
+}
+
+func testFeedQueue(t *testing.T, b backend.StorageBackend) {
+	for _, v := range []struct{ peer, messageID string }{
+		{"peer", "<1@test>"},
+		{"peer", "<2@test>"},
+		{"peer", "<1@test>"}, // already queued
+		{"other", "<1@test>"},
+	} {
+		if err := b.EnqueueFeedArticle(ctx, v.peer, v.messageID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expect := func(what string, limit int, want []string, size int) {
+		t.Helper()
+		items, err := b.GetFeedQueue(ctx, "peer", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		equal(t, what+": GetFeedQueue", queuedIDs(items), want)
+		for _, v := range items {
+			if v.Peer != "peer" {
+				t.Errorf("%s: GetFeedQueue returned item of %s", what, v.Peer)
+			}
+		}
+		if n, err := b.GetFeedQueueSize(ctx, "peer"); err != nil || n != size {
+			t.Errorf("%s: GetFeedQueueSize: got %d, %v, want %d", what, n, err, size)
+		}
+	}
+	expect("queued", 10, []string{"<1@test>", "<2@test>"}, 2)
+	if items, err := b.GetFeedQueue(ctx, "peer", 1); err != nil || len(items) != 1 {
+		t.Errorf("GetFeedQueue with limit 1 returned %d items, %v", len(items), err)
+	}
+
+	// postponed items stay in the queue, but aren't returned until their next attempt
+	if err := b.UpdateFeedQueueItem(ctx, models.FeedQueueItem{Peer: "peer", MessageID: "<1@test>", Attempts: 1, NextAttemptAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	expect("postponed", 10, []string{"<2@test>"}, 2)
+
+	if err := b.DeleteFeedQueueItem(ctx, "peer", "<2@test>"); err != nil {
+		t.Fatal(err)
+	}
+	expect("deleted", 10, nil, 1)
+
+	if err := b.ClearFeedQueue(ctx, "peer"); err != nil {
+		t.Fatal(err)
+	}
+	expect("cleared", 10, nil, 0)
+	if n, err := b.GetFeedQueueSize(ctx, "other"); err != nil || n != 1 {
+		t.Errorf("GetFeedQueueSize of the other peer: got %d, %v, want 1", n, err)
+	}
+}
+
+func testBans(t *testing.T, b backend.StorageBackend) {
+	bans := []models.Ban{
+		{Type: models.BanTypeAddress, Value: "192.0.2.0/24", Reason: "spam"},
+		{Type: models.BanTypeUser, Value: "mallory"},
+	}
+	for i := range bans {
+		id, err := b.SaveBan(ctx, bans[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		bans[i].ID = id
+	}
+
+	got, err := b.ListBans(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(bans) {
+		t.Fatalf("ListBans returned %d bans", len(got))
+	}
+	for i, v := range got {
+		if v.CreatedAt.IsZero() {
+			t.Errorf("ListBans returned ban without creation time")
+		}
+		v.CreatedAt = time.Time{}
+		if v != bans[i] {
+			t.Errorf("ListBans: got %+v, want %+v", v, bans[i])
+		}
+	}
+
+	if err := b.DeleteBan(ctx, bans[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	expectErr(t, "DeleteBan of deleted ban", b.DeleteBan(ctx, bans[0].ID), backend.ErrNotFound)
+	got, err = b.ListBans(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != bans[1].ID {
+		t.Errorf("ListBans after DeleteBan returned %+v", got)
+	}
+}
@@ -0,0 +1,1013 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/utils"
+)
+
+type article struct {
+	models.Article
+	links    []link          // groups the article is posted to, in the order of posting
+	overview models.Overview // overview record without the article number
+}
+
+type link struct {
+	groupID int
+	number  int
+}
+
+// MemoryBackend keeps everything in maps, the data is lost when the process exits.
+// It behaves like the SQL backends, e.g. numbers of removed articles are never reused.
+type MemoryBackend struct {
+	mu sync.RWMutex
+
+	lastID    int // shared by all entities which need generated ids
+	groups    map[int]*models.Group
+	groupIDs  map[string]int
+	articles  map[int]*article
+	messageID map[string]int      // message id -> article id
+	numbers   map[int]map[int]int // group id -> article number -> article id
+	users     map[string]models.User
+	acl       map[int]map[string]models.ACLEntry
+	pending   map[int]models.PendingArticle
+	history   map[string]time.Time // message id -> time the article has been removed or rejected, or arrived if it is stored
+	state     map[string]string
+	feedQueue map[string]map[string]models.FeedQueueItem
+	bans      map[int]models.Ban
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		groups:    map[int]*models.Group{},
+		groupIDs:  map[string]int{},
+		articles:  map[int]*article{},
+		messageID: map[string]int{},
+		numbers:   map[int]map[int]int{},
+		users:     map[string]models.User{},
+		acl:       map[int]map[string]models.ACLEntry{},
+		pending:   map[int]models.PendingArticle{},
+		history:   map[string]time.Time{},
+		state:     map[string]string{},
+		feedQueue: map[string]map[string]models.FeedQueueItem{},
+		bans:      map[int]models.Ban{},
+	}
+}
+
+func (mb *MemoryBackend) nextID() int {
+	mb.lastID++
+	return mb.lastID
+}
+
+func copyGroup(g *models.Group) models.Group {
+	res := *g
+	if g.Description != nil {
+		description := *g.Description
+		res.Description = &description
+	}
+	return res
+}
+
+// sortedGroups returns the groups matching the filter ordered by id.
+func (mb *MemoryBackend) sortedGroups(filter func(g *models.Group) bool) []models.Group {
+	var groups []models.Group
+	for _, v := range mb.groups {
+		if filter(v) {
+			groups = append(groups, copyGroup(v))
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].ID < groups[j].ID
+	})
+	return groups
+}
+
+func (mb *MemoryBackend) ListGroups(ctx context.Context) ([]models.Group, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	return mb.sortedGroups(func(g *models.Group) bool { return true }), nil
+}
+
+func (mb *MemoryBackend) ListGroupsByPattern(ctx context.Context, pattern string) ([]models.Group, error) {
+	w, err := utils.ParseWildmat(pattern)
+	if err != nil {
+		return nil, err
+	}
+	r, err := w.ToRegex()
+	if err != nil {
+		return nil, err
+	}
+
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	return mb.sortedGroups(func(g *models.Group) bool {
+		ok, _ := r.MatchString(g.GroupName)
+		return ok
+	}), nil
+}
+
+func (mb *MemoryBackend) GetGroup(ctx context.Context, groupName string) (models.Group, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	id, ok := mb.groupIDs[groupName]
+	if !ok {
+		return models.Group{}, backend.ErrNoSuchGroup
+	}
+	return copyGroup(mb.groups[id]), nil
+}
+
+func (mb *MemoryBackend) GetNewGroupsSince(ctx context.Context, timestamp int64) ([]models.Group, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	return mb.sortedGroups(func(g *models.Group) bool {
+		return g.CreatedAt.Unix() > timestamp
+	}), nil
+}
+
+func (mb *MemoryBackend) GetArticlesCount(ctx context.Context, g *models.Group) (int, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	return len(mb.numbers[g.ID]), nil
+}
+
+func (mb *MemoryBackend) GetGroupLowWaterMark(ctx context.Context, g *models.Group) (int, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	group, ok := mb.groups[g.ID]
+	if !ok {
+		return 0, backend.ErrNoSuchGroup
+	}
+	low := group.HighWaterMark + 1
+	for num := range mb.numbers[g.ID] {
+		if num < low {
+			low = num
+		}
+	}
+	return low, nil
+}
+
+func (mb *MemoryBackend) GetGroupHighWaterMark(ctx context.Context, g *models.Group) (int, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	group, ok := mb.groups[g.ID]
+	if !ok {
+		return 0, backend.ErrNoSuchGroup
+	}
+	return group.HighWaterMark, nil
+}
+
+func (mb *MemoryBackend) SaveArticle(ctx context.Context, a models.Article, groups []string) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	return mb.saveArticle(a, groups)
+}
+
+func (mb *MemoryBackend) PublishPendingArticle(ctx context.Context, id int, a models.Article, groups []string) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if _, ok := mb.pending[id]; !ok {
+		return backend.ErrNotFound
+	}
+	if err := mb.saveArticle(a, groups); err != nil {
+		return err
+	}
+	delete(mb.pending, id)
+	return nil
+}
+
+// saveArticle stores the article, the caller holds the lock.
+func (mb *MemoryBackend) saveArticle(a models.Article, groups []string) error {
+	var groupIDs []int
+	for _, v := range groups {
+		id, ok := mb.groupIDs[strings.TrimSpace(v)]
+		if !ok {
+			return backend.ErrNoSuchGroup
+		}
+		groupIDs = append(groupIDs, id)
+	}
+
+	messageID := a.Header.Get("Message-ID")
+	if _, ok := mb.history[messageID]; ok {
+		return backend.ErrDuplicate
+	}
+	o, err := utils.NewOverview(&a, 0)
+	if err != nil {
+		return err
+	}
+	mb.history[messageID] = time.Now()
+
+	if a.Thread.Valid {
+		// the thread of the article may have got its own root since the article was made, e.g. while it was pending
+		if id, ok := mb.messageID[a.Thread.String]; ok && mb.articles[id].Thread.Valid {
+			a.Thread = mb.articles[id].Thread
+		}
+	}
+	stored := &article{Article: models.Article{
+		ID:          mb.nextID(),
+		CreatedAt:   time.Now(),
+		HeaderRaw:   a.HeaderRaw,
+		Body:        a.Body,
+		Thread:      a.Thread,
+		Parent:      a.Parent,
+		MessageID:   messageID,
+		Attachments: append([]models.Attachment(nil), a.Attachments...),
+	}, overview: o}
+	for _, v := range groupIDs {
+		g := mb.groups[v]
+		g.HighWaterMark++
+		if mb.numbers[v] == nil {
+			mb.numbers[v] = map[int]int{}
+		}
+		mb.numbers[v][g.HighWaterMark] = stored.ID
+		stored.links = append(stored.links, link{groupID: v, number: g.HighWaterMark})
+	}
+	mb.articles[stored.ID] = stored
+	mb.messageID[messageID] = stored.ID
+
+	if a.Thread.Valid {
+		// replies which arrived before the article had it as their thread root
+		for _, v := range mb.articles {
+			if v.Thread.Valid && v.Thread.String == messageID {
+				v.Thread = a.Thread
+			}
+		}
+	}
+	return nil
+}
+
+// article returns a copy of the stored article with the number it has in the group,
+// or the number in the first group it was posted to when groupID is zero.
+func (mb *MemoryBackend) article(id int, groupID int) (models.Article, error) {
+	stored, ok := mb.articles[id]
+	if !ok {
+		return models.Article{}, backend.ErrNoSuchArticle
+	}
+
+	a := stored.Article
+	a.Attachments = append([]models.Attachment(nil), stored.Attachments...)
+	for _, v := range stored.links {
+		if groupID == 0 || v.groupID == groupID {
+			a.ArticleNumber = v.number
+			break
+		}
+	}
+	return a, json.Unmarshal([]byte(a.HeaderRaw), &a.Header)
+}
+
+func (mb *MemoryBackend) GetArticle(ctx context.Context, messageID string) (models.Article, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	id, ok := mb.messageID[messageID]
+	if !ok {
+		return models.Article{}, backend.ErrNoSuchArticle
+	}
+	a, err := mb.article(id, 0)
+	if err == nil && len(mb.articles[id].links) == 0 {
+		// the SQL backends can't find the number of an article which isn't in any group
+		return a, backend.ErrNoSuchArticle
+	}
+	return a, err
+}
+
+func (mb *MemoryBackend) GetArticleGroups(ctx context.Context, messageID string) ([]models.Group, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	var groups []models.Group
+	id, ok := mb.messageID[messageID]
+	if !ok {
+		return groups, nil
+	}
+	for _, v := range mb.articles[id].links {
+		if g, ok := mb.groups[v.groupID]; ok {
+			groups = append(groups, copyGroup(g))
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups, nil
+}
+
+func (mb *MemoryBackend) GetArticleByNumber(ctx context.Context, g *models.Group, num int) (models.Article, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	id, ok := mb.numbers[g.ID][num]
+	if !ok {
+		return models.Article{}, backend.ErrNoSuchArticle
+	}
+	return mb.article(id, g.ID)
+}
+
+// sortedNumbers returns the article numbers of the group in ascending order.
+func (mb *MemoryBackend) sortedNumbers(groupID int) []int {
+	var numbers []int
+	for num := range mb.numbers[groupID] {
+		numbers = append(numbers, num)
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+func (mb *MemoryBackend) GetArticleNumbers(ctx context.Context, g *models.Group, low, high int64) ([]int64, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	var match func(num int64) bool
+	if high == 0 && low == 0 {
+		match = func(num int64) bool { return true }
+	} else if low == -1 && high != 0 {
+		match = func(num int64) bool { return num == high }
+	} else if low != 0 && high == -1 {
+		match = func(num int64) bool { return num > low }
+	} else if low == -1 && high == -1 {
+		return nil, nil
+	} else {
+		match = func(num int64) bool { return num > low && num < high }
+	}
+
+	var numbers []int64
+	for _, v := range mb.sortedNumbers(g.ID) {
+		if match(int64(v)) {
+			numbers = append(numbers, int64(v))
+		}
+	}
+	return numbers, nil
+}
+
+func (mb *MemoryBackend) GetNewArticlesSince(ctx context.Context, timestamp int64) ([]string, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	var ids []int
+	for id, v := range mb.articles {
+		if v.CreatedAt.Unix() > timestamp {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	var messageIDs []string
+	for _, v := range ids {
+		messageIDs = append(messageIDs, mb.articles[v].MessageID)
+	}
+	return messageIDs, nil
+}
+
+func (mb *MemoryBackend) GetLastArticleByNum(ctx context.Context, g *models.Group, a *models.Article) (models.Article, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	numbers := mb.sortedNumbers(g.ID)
+	for i := len(numbers) - 1; i >= 0; i-- {
+		if numbers[i] < a.ArticleNumber {
+			return mb.article(mb.numbers[g.ID][numbers[i]], g.ID)
+		}
+	}
+	return models.Article{}, backend.ErrNoSuchArticle
+}
+
+func (mb *MemoryBackend) GetNextArticleByNum(ctx context.Context, g *models.Group, a *models.Article) (models.Article, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	for _, v := range mb.sortedNumbers(g.ID) {
+		if v > a.ArticleNumber {
+			return mb.article(mb.numbers[g.ID][v], g.ID)
+		}
+	}
+	return models.Article{}, backend.ErrNoSuchArticle
+}
+
+func (mb *MemoryBackend) GetArticlesByRange(ctx context.Context, g *models.Group, low, high int64) ([]models.Article, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	var articles []models.Article
+	for _, v := range mb.sortedNumbers(g.ID) {
+		if int64(v) < low || int64(v) > high {
+			continue
+		}
+		a, err := mb.article(mb.numbers[g.ID][v], g.ID)
+		if err != nil {
+			return nil, err
+		}
+		articles = append(articles, a)
+	}
+	return articles, nil
+}
+
+func (mb *MemoryBackend) GetOverview(ctx context.Context, g *models.Group, low, high int64, fn func(o models.Overview) error) error {
+	// the records are collected first, so the lock isn't held while fn writes them out
+	mb.mu.RLock()
+	var records []models.Overview
+	for _, v := range mb.sortedNumbers(g.ID) {
+		if int64(v) < low || int64(v) > high {
+			continue
+		}
+		o := mb.articles[mb.numbers[g.ID][v]].overview
+		o.Number = v
+		records = append(records, o)
+	}
+	mb.mu.RUnlock()
+
+	for _, v := range records {
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mb *MemoryBackend) SearchArticles(ctx context.Context, groups []models.Group, query string, limit int) ([]models.SearchResult, error) {
+	terms := utils.SearchTerms(query)
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	searched := map[int]bool{}
+	var ids []int
+	for _, g := range groups {
+		searched[g.ID] = true
+		for _, id := range mb.numbers[g.ID] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+
+	var results []models.SearchResult
+	for i, id := range ids {
+		if len(results) >= limit {
+			break
+		}
+		// an article posted to several of the groups appears several times in a row
+		if i > 0 && ids[i-1] == id {
+			continue
+		}
+		a := mb.articles[id]
+		if !utils.MatchesSearch(a.overview.Subject, a.overview.From, a.Body, terms) {
+			continue
+		}
+		for _, v := range a.links {
+			if searched[v.groupID] && len(results) < limit {
+				results = append(results, models.SearchResult{MessageID: a.MessageID, GroupName: mb.groups[v.groupID].GroupName, ArticleNumber: v.number})
+			}
+		}
+	}
+	return results, nil
+}
+
+// groupArticles returns the articles of the group ordered by creation time.
+func (mb *MemoryBackend) groupArticles(groupID int) []*article {
+	var articles []*article
+	for _, id := range mb.numbers[groupID] {
+		articles = append(articles, mb.articles[id])
+	}
+	sort.Slice(articles, func(i, j int) bool {
+		if articles[i].CreatedAt.Equal(articles[j].CreatedAt) {
+			return articles[i].ID < articles[j].ID
+		}
+		return articles[i].CreatedAt.Before(articles[j].CreatedAt)
+	})
+	return articles
+}
+
+func numberIn(a *article, groupID int) int {
+	for _, v := range a.links {
+		if v.groupID == groupID {
+			return v.number
+		}
+	}
+	return 0
+}
+
+func (mb *MemoryBackend) GetNewThreads(ctx context.Context, g *models.Group, perPage int, pageNum int, order models.ThreadOrder) ([]int, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	lastReply := map[string]int{} // thread -> id of its latest reply in the group
+	orphaned := map[string]bool{} // threads with missing roots whose earliest article has been found
+	var heads []*article
+	for _, v := range mb.groupArticles(g.ID) {
+		if !v.Thread.Valid {
+			heads = append(heads, v)
+			continue
+		}
+		if _, ok := mb.messageID[v.Thread.String]; !ok && !orphaned[v.Thread.String] {
+			orphaned[v.Thread.String] = true
+			heads = append(heads, v)
+		}
+		if v.ID > lastReply[v.Thread.String] {
+			lastReply[v.Thread.String] = v.ID
+		}
+	}
+	// the newest threads first
+	for i, j := 0, len(heads)-1; i < j; i, j = i+1, j-1 {
+		heads[i], heads[j] = heads[j], heads[i]
+	}
+	if order == models.ThreadOrderLastReply {
+		activity := func(a *article) int {
+			thread := a.MessageID
+			if a.Thread.Valid {
+				thread = a.Thread.String
+			}
+			if id, ok := lastReply[thread]; ok {
+				return id
+			}
+			return a.ID
+		}
+		sort.SliceStable(heads, func(i, j int) bool {
+			return activity(heads[i]) > activity(heads[j])
+		})
+	}
+
+	var numbers []int
+	for _, v := range heads {
+		numbers = append(numbers, numberIn(v, g.ID))
+	}
+
+	offset := perPage * pageNum
+	if offset >= len(numbers) {
+		return nil, nil
+	}
+	numbers = numbers[offset:]
+	if len(numbers) > perPage {
+		numbers = numbers[:perPage]
+	}
+	return numbers, nil
+}
+
+// threadRoot returns the message id of the article with the number, or its thread if the root of the thread
+// is missing. The string is empty if there is no such article.
+func (mb *MemoryBackend) threadRoot(g *models.Group, num int) string {
+	id, ok := mb.numbers[g.ID][num]
+	if !ok {
+		return ""
+	}
+	a := mb.articles[id]
+	if a.Thread.Valid {
+		if _, ok := mb.messageID[a.Thread.String]; !ok {
+			return a.Thread.String
+		}
+	}
+	return a.MessageID
+}
+
+func (mb *MemoryBackend) GetThread(ctx context.Context, g *models.Group, threadNum int) ([]int, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	root := mb.threadRoot(g, threadNum)
+	if root == "" {
+		return nil, nil
+	}
+
+	var numbers []int
+	for _, v := range mb.groupArticles(g.ID) {
+		if n := numberIn(v, g.ID); v.Thread.Valid && v.Thread.String == root && n != threadNum {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers, nil
+}
+
+func (mb *MemoryBackend) GetThreadTree(ctx context.Context, g *models.Group, threadNum int) ([]models.ThreadNode, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	root := mb.threadRoot(g, threadNum)
+	if root == "" {
+		return nil, nil
+	}
+
+	var nodes []models.ThreadNode
+	for _, v := range mb.groupArticles(g.ID) {
+		if v.MessageID == root || (v.Thread.Valid && v.Thread.String == root) {
+			nodes = append(nodes, models.ThreadNode{Number: numberIn(v, g.ID), MessageID: v.MessageID, ParentID: v.Parent})
+		}
+	}
+	return utils.BuildThreadTree(nodes, root), nil
+}
+
+func (mb *MemoryBackend) GetUser(ctx context.Context, username string) (models.User, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	u, ok := mb.users[username]
+	if !ok {
+		return u, backend.ErrNotFound
+	}
+	return u, nil
+}
+
+func (mb *MemoryBackend) SaveUser(ctx context.Context, u models.User) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if old, ok := mb.users[u.Username]; ok {
+		u.ID = old.ID
+		u.CreatedAt = old.CreatedAt
+	} else {
+		u.ID = mb.nextID()
+		u.CreatedAt = time.Now()
+	}
+	mb.users[u.Username] = u
+	return nil
+}
+
+func (mb *MemoryBackend) ListUsers(ctx context.Context) ([]models.User, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	var users []models.User
+	for _, v := range mb.users {
+		users = append(users, v)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users, nil
+}
+
+func (mb *MemoryBackend) DeleteUser(ctx context.Context, username string) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	for _, entries := range mb.acl {
+		delete(entries, username)
+	}
+	delete(mb.users, username)
+	return nil
+}
+
+func (mb *MemoryBackend) GetGroupACL(ctx context.Context, g *models.Group) ([]models.ACLEntry, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	var entries []models.ACLEntry
+	for _, v := range mb.acl[g.ID] {
+		entries = append(entries, v)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Username < entries[j].Username
+	})
+	return entries, nil
+}
+
+func (mb *MemoryBackend) SaveACLEntry(ctx context.Context, e models.ACLEntry) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if mb.acl[e.GroupID] == nil {
+		mb.acl[e.GroupID] = map[string]models.ACLEntry{}
+	}
+	mb.acl[e.GroupID][e.Username] = e
+	return nil
+}
+
+func (mb *MemoryBackend) DeleteACLEntry(ctx context.Context, g *models.Group, username string) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	delete(mb.acl[g.ID], username)
+	return nil
+}
+
+func (mb *MemoryBackend) SavePendingArticle(ctx context.Context, a models.Article, g *models.Group, submitter string) (int, error) {
+	attachments, err := json.Marshal(a.Attachments)
+	if err != nil {
+		return 0, err
+	}
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	pa := models.PendingArticle{
+		ID:             mb.nextID(),
+		GroupID:        g.ID,
+		CreatedAt:      time.Now(),
+		HeaderRaw:      a.HeaderRaw,
+		Body:           a.Body,
+		Thread:         a.Thread,
+		Parent:         a.Parent,
+		AttachmentsRaw: string(attachments),
+		Submitter:      submitter,
+	}
+	mb.pending[pa.ID] = pa
+	return pa.ID, nil
+}
+
+func (mb *MemoryBackend) GetPendingArticles(ctx context.Context, g *models.Group) ([]models.PendingArticle, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	var articles []models.PendingArticle
+	for _, v := range mb.pending {
+		if v.GroupID != g.ID {
+			continue
+		}
+		if err := unmarshalPendingArticle(&v); err != nil {
+			return nil, err
+		}
+		articles = append(articles, v)
+	}
+	sort.Slice(articles, func(i, j int) bool {
+		return articles[i].ID < articles[j].ID
+	})
+	return articles, nil
+}
+
+func (mb *MemoryBackend) GetPendingArticle(ctx context.Context, id int) (models.PendingArticle, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	pa, ok := mb.pending[id]
+	if !ok {
+		return pa, backend.ErrNotFound
+	}
+	return pa, unmarshalPendingArticle(&pa)
+}
+
+func (mb *MemoryBackend) DeletePendingArticle(ctx context.Context, id int) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if _, ok := mb.pending[id]; !ok {
+		return backend.ErrNotFound
+	}
+	delete(mb.pending, id)
+	return nil
+}
+
+func unmarshalPendingArticle(a *models.PendingArticle) error {
+	if err := json.Unmarshal([]byte(a.HeaderRaw), &a.Header); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(a.AttachmentsRaw), &a.Attachments)
+}
+
+func (mb *MemoryBackend) HasMessageID(ctx context.Context, messageID string) (bool, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	_, ok := mb.history[messageID]
+	return ok, nil
+}
+
+func (mb *MemoryBackend) PurgeHistory(ctx context.Context, before time.Time) (int, error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	n := 0
+	for k, v := range mb.history {
+		if _, ok := mb.messageID[k]; ok || !v.Before(before) {
+			continue
+		}
+		delete(mb.history, k)
+		n++
+	}
+	return n, nil
+}
+
+func (mb *MemoryBackend) GetGroupArticleInfo(ctx context.Context, g *models.Group) ([]models.ArticleInfo, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	var info []models.ArticleInfo
+	for _, num := range mb.sortedNumbers(g.ID) {
+		a := mb.articles[mb.numbers[g.ID][num]]
+		var header map[string][]string
+		if err := json.Unmarshal([]byte(a.HeaderRaw), &header); err != nil {
+			return nil, err
+		}
+		ai := models.ArticleInfo{
+			Number:    num,
+			MessageID: a.MessageID,
+			CreatedAt: a.CreatedAt,
+			Size:      len(a.HeaderRaw) + len(a.Body),
+			Groups:    len(a.links),
+		}
+		if v := header["Expires"]; len(v) != 0 {
+			ai.Expires = v[0]
+		}
+		info = append(info, ai)
+	}
+	return info, nil
+}
+
+func (mb *MemoryBackend) DeleteArticle(ctx context.Context, messageID string) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	id, ok := mb.messageID[messageID]
+	if !ok {
+		return backend.ErrNoSuchArticle
+	}
+	for _, v := range mb.articles[id].links {
+		delete(mb.numbers[v.groupID], v.number)
+	}
+	delete(mb.articles, id)
+	delete(mb.messageID, messageID)
+	mb.history[messageID] = time.Now()
+	return nil
+}
+
+func (mb *MemoryBackend) RememberMessageID(ctx context.Context, messageID string) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if _, ok := mb.history[messageID]; !ok {
+		mb.history[messageID] = time.Now()
+	}
+	return nil
+}
+
+func (mb *MemoryBackend) CreateGroup(ctx context.Context, g models.Group) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if _, ok := mb.groupIDs[g.GroupName]; ok {
+		return fmt.Errorf("group %s already exists", g.GroupName)
+	}
+	g.ID = mb.nextID()
+	g.CreatedAt = time.Now()
+	g.HighWaterMark = 0
+	mb.groups[g.ID] = &g
+	mb.groupIDs[g.GroupName] = g.ID
+	return nil
+}
+
+func (mb *MemoryBackend) UpdateGroup(ctx context.Context, g models.Group) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	stored, ok := mb.groups[g.ID]
+	if !ok {
+		return nil
+	}
+	if id, ok := mb.groupIDs[g.GroupName]; ok && id != g.ID {
+		return fmt.Errorf("group %s already exists", g.GroupName)
+	}
+	delete(mb.groupIDs, stored.GroupName)
+	mb.groupIDs[g.GroupName] = g.ID
+
+	updated := copyGroup(&g)
+	stored.GroupName = updated.GroupName
+	stored.Description = updated.Description
+	stored.Moderated = updated.Moderated
+	return nil
+}
+
+// DeleteGroup removes the group with everything what belongs to it, articles stay in the other groups they are posted to.
+func (mb *MemoryBackend) DeleteGroup(ctx context.Context, g *models.Group) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	for _, id := range mb.numbers[g.ID] {
+		a := mb.articles[id]
+		var links []link
+		for _, v := range a.links {
+			if v.groupID != g.ID {
+				links = append(links, v)
+			}
+		}
+		a.links = links
+	}
+	delete(mb.numbers, g.ID)
+	delete(mb.acl, g.ID)
+	for id, v := range mb.pending {
+		if v.GroupID == g.ID {
+			delete(mb.pending, id)
+		}
+	}
+	if stored, ok := mb.groups[g.ID]; ok {
+		delete(mb.groupIDs, stored.GroupName)
+		delete(mb.groups, g.ID)
+	}
+	return nil
+}
+
+func (mb *MemoryBackend) GetArticlesSinceID(ctx context.Context, id int, limit int) ([]models.Article, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	var ids []int
+	for v := range mb.articles {
+		if v > id {
+			ids = append(ids, v)
+		}
+	}
+	sort.Ints(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	var articles []models.Article
+	for _, v := range ids {
+		a, err := mb.article(v, 0)
+		if err != nil {
+			return nil, err
+		}
+		a.ArticleNumber = 0
+		articles = append(articles, a)
+	}
+	return articles, nil
+}
+
+func (mb *MemoryBackend) GetState(ctx context.Context, key string) (string, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	value, ok := mb.state[key]
+	if !ok {
+		return "", backend.ErrNotFound
+	}
+	return value, nil
+}
+
+func (mb *MemoryBackend) SetState(ctx context.Context, key, value string) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.state[key] = value
+	return nil
+}
+
+func (mb *MemoryBackend) EnqueueFeedArticle(ctx context.Context, peer, messageID string) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if mb.feedQueue[peer] == nil {
+		mb.feedQueue[peer] = map[string]models.FeedQueueItem{}
+	}
+	if _, ok := mb.feedQueue[peer][messageID]; ok {
+		return nil
+	}
+	now := time.Now()
+	mb.feedQueue[peer][messageID] = models.FeedQueueItem{
+		Peer:          peer,
+		MessageID:     messageID,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	return nil
+}
+
+func (mb *MemoryBackend) GetFeedQueue(ctx context.Context, peer string, limit int) ([]models.FeedQueueItem, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	now := time.Now()
+	var items []models.FeedQueueItem
+	for _, v := range mb.feedQueue[peer] {
+		if !v.NextAttemptAt.After(now) {
+			items = append(items, v)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+func (mb *MemoryBackend) UpdateFeedQueueItem(ctx context.Context, item models.FeedQueueItem) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	stored, ok := mb.feedQueue[item.Peer][item.MessageID]
+	if !ok {
+		return nil
+	}
+	stored.Attempts = item.Attempts
+	stored.NextAttemptAt = item.NextAttemptAt
+	mb.feedQueue[item.Peer][item.MessageID] = stored
+	return nil
+}
+
+func (mb *MemoryBackend) DeleteFeedQueueItem(ctx context.Context, peer, messageID string) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	delete(mb.feedQueue[peer], messageID)
+	return nil
+}
+
+func (mb *MemoryBackend) GetFeedQueueSize(ctx context.Context, peer string) (int, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	return len(mb.feedQueue[peer]), nil
+}
+
+func (mb *MemoryBackend) ClearFeedQueue(ctx context.Context, peer string) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	delete(mb.feedQueue, peer)
+	return nil
+}
+
+func (mb *MemoryBackend) ListBans(ctx context.Context) ([]models.Ban, error) {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	var bans []models.Ban
+	for _, v := range mb.bans {
+		bans = append(bans, v)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].ID < bans[j].ID
+	})
+	return bans, nil
+}
+
+func (mb *MemoryBackend) SaveBan(ctx context.Context, b models.Ban) (int, error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	b.ID = mb.nextID()
+	b.CreatedAt = time.Now()
+	mb.bans[b.ID] = b
+	return b.ID, nil
+}
+
+func (mb *MemoryBackend) DeleteBan(ctx context.Context, id int) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if _, ok := mb.bans[id]; !ok {
+		return backend.ErrNotFound
+	}
+	delete(mb.bans, id)
+	return nil
+}
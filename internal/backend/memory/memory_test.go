@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/backend/backendtest"
+)
+
+func TestConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) backend.StorageBackend {
+		return NewMemoryBackend()
+	})
+}
@@ -0,0 +1,104 @@
+-- +goose Up
+
+CREATE TABLE IF NOT EXISTS groups(
+    id SERIAL PRIMARY KEY,
+    group_name TEXT UNIQUE NOT NULL,
+    description TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    moderated BOOLEAN NOT NULL DEFAULT false,
+    -- article numbers are allocated by incrementing it in the transaction which saves the article,
+    -- so instances sharing the database never hand out the same number
+    high_water_mark INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS articles(
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    header JSONB NOT NULL,
+    thread TEXT,
+    body TEXT NOT NULL,
+    message_id TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS articles_message_id ON articles(message_id);
+CREATE INDEX IF NOT EXISTS articles_thread ON articles(thread);
+CREATE TABLE IF NOT EXISTS articles_to_groups(
+    article_id INTEGER NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+    article_number INTEGER NOT NULL,
+    group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, article_number)
+);
+CREATE INDEX IF NOT EXISTS articles_to_groups_article_id ON articles_to_groups(article_id);
+CREATE TABLE IF NOT EXISTS attachments_articles_mapping(
+    article_id INTEGER NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+    content_type TEXT NOT NULL,
+    attachment_id TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS attachments_articles_mapping_article_id ON attachments_articles_mapping(article_id);
+
+CREATE TABLE IF NOT EXISTS users(
+    id SERIAL PRIMARY KEY,
+    username TEXT UNIQUE NOT NULL,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    scram_salt TEXT NOT NULL DEFAULT '',
+    scram_iterations INTEGER NOT NULL DEFAULT 0,
+    scram_stored_key TEXT NOT NULL DEFAULT '',
+    scram_server_key TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS group_acl(
+    group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    username TEXT NOT NULL,
+    can_read BOOLEAN NOT NULL DEFAULT true,
+    can_post BOOLEAN NOT NULL DEFAULT false,
+    can_moderate BOOLEAN NOT NULL DEFAULT false,
+    UNIQUE (group_id, username)
+);
+CREATE TABLE IF NOT EXISTS pending_articles(
+    id SERIAL PRIMARY KEY,
+    group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    header JSONB NOT NULL,
+    thread TEXT,
+    body TEXT NOT NULL,
+    attachments JSONB NOT NULL DEFAULT '[]',
+    submitter TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS state(
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS feed_queue(
+    peer TEXT NOT NULL,
+    message_id TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (peer, message_id)
+);
+CREATE INDEX IF NOT EXISTS feed_queue_next_attempt ON feed_queue(peer, next_attempt_at);
+CREATE TABLE IF NOT EXISTS history(
+    message_id TEXT PRIMARY KEY,
+    arrived_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS history_arrived_at ON history(arrived_at);
+CREATE TABLE IF NOT EXISTS bans(
+    id SERIAL PRIMARY KEY,
+    type TEXT NOT NULL,
+    value TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS bans;
+DROP TABLE IF EXISTS history;
+DROP TABLE IF EXISTS feed_queue;
+DROP TABLE IF EXISTS state;
+DROP TABLE IF EXISTS pending_articles;
+DROP TABLE IF EXISTS group_acl;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS attachments_articles_mapping;
+DROP TABLE IF EXISTS articles_to_groups;
+DROP TABLE IF EXISTS articles;
+DROP TABLE IF EXISTS groups;
@@ -0,0 +1,13 @@
+-- +goose Up
+
+-- parent is the message id of the article the one replies to, threads of existing articles had no nesting,
+-- so their replies are attached to the roots
+ALTER TABLE articles ADD COLUMN IF NOT EXISTS parent TEXT;
+UPDATE articles SET parent = thread WHERE thread IS NOT NULL;
+ALTER TABLE pending_articles ADD COLUMN IF NOT EXISTS parent TEXT;
+UPDATE pending_articles SET parent = thread WHERE thread IS NOT NULL;
+
+-- +goose Down
+
+ALTER TABLE pending_articles DROP COLUMN IF EXISTS parent;
+ALTER TABLE articles DROP COLUMN IF EXISTS parent;
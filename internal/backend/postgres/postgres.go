@@ -0,0 +1,668 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/utils"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/pressly/goose/v3"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// PostgresBackend stores everything in PostgreSQL database, which may be shared by several instances of the server.
+type PostgresBackend struct {
+	db *sqlx.DB
+}
+
+func NewPostgresBackend(cfg config.PostgresBackendConfig) (*PostgresBackend, error) {
+	db, err := sqlx.Open("postgres", cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	goose.SetBaseFS(migrations)
+
+	if err := goose.SetDialect("postgres"); err != nil {
+		return nil, err
+	}
+
+	if err := goose.Up(db.DB, "migrations"); err != nil {
+		return nil, err
+	}
+
+	pb := &PostgresBackend{
+		db: db,
+	}
+	if err := pb.fillOverview(context.Background()); err != nil {
+		return nil, err
+	}
+	return pb, nil
+}
+
+// fillOverview adds the missing overview records of articles saved before the overview table was introduced.
+func (pb *PostgresBackend) fillOverview(ctx context.Context) error {
+	var rows []struct {
+		models.Article
+		GroupID int `db:"group_id"`
+		Number  int `db:"article_number"`
+	}
+	if err := pb.db.SelectContext(ctx, &rows, "SELECT articles.*, atg.group_id, atg.article_number FROM articles INNER JOIN articles_to_groups atg ON atg.article_id = articles.id LEFT JOIN overview o ON o.group_id = atg.group_id AND o.article_number = atg.article_number WHERE o.article_id IS NULL"); err != nil {
+		return err
+	}
+	for _, v := range rows {
+		if err := json.Unmarshal([]byte(v.HeaderRaw), &v.Header); err != nil {
+			return err
+		}
+		o, err := utils.NewOverview(&v.Article, v.Number)
+		if err != nil {
+			return err
+		}
+		if err := insertOverview(ctx, pb.db, v.GroupID, v.ID, o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertOverview(ctx context.Context, e sqlx.ExecerContext, groupID, articleID int, o models.Overview) error {
+	_, err := e.ExecContext(ctx, "INSERT INTO overview (group_id, article_number, article_id, subject, from_header, date, message_id, references_header, bytes, lines) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+		groupID, o.Number, articleID, o.Subject, o.From, o.Date, o.MessageID, o.References, o.Bytes, o.Lines)
+	return err
+}
+
+func (pb *PostgresBackend) ListGroups(ctx context.Context) ([]models.Group, error) {
+	var groups []models.Group
+	return groups, pb.db.SelectContext(ctx, &groups, "SELECT * FROM groups ORDER BY id")
+}
+
+func (pb *PostgresBackend) ListGroupsByPattern(ctx context.Context, pattern string) ([]models.Group, error) {
+	var groups []models.Group
+	w, err := utils.ParseWildmat(pattern)
+	if err != nil {
+		return nil, err
+	}
+	r, err := w.ToRegex()
+	if err != nil {
+		return nil, err
+	}
+	return groups, pb.db.SelectContext(ctx, &groups, "SELECT * FROM groups WHERE group_name ~ $1 ORDER BY id", r.String())
+}
+
+func (pb *PostgresBackend) GetArticlesCount(ctx context.Context, g *models.Group) (int, error) {
+	var count int
+	return count, pb.db.GetContext(ctx, &count, "SELECT count(*) FROM articles_to_groups WHERE group_id = $1", g.ID)
+}
+
+func (pb *PostgresBackend) GetGroupHighWaterMark(ctx context.Context, g *models.Group) (int, error) {
+	var waterMark int
+	return waterMark, notFound(pb.db.GetContext(ctx, &waterMark, "SELECT high_water_mark FROM groups WHERE id = $1", g.ID), backend.ErrNoSuchGroup)
+}
+
+func (pb *PostgresBackend) GetGroupLowWaterMark(ctx context.Context, g *models.Group) (int, error) {
+	var waterMark int
+	return waterMark, notFound(pb.db.GetContext(ctx, &waterMark, "SELECT COALESCE((SELECT min(article_number) FROM articles_to_groups WHERE group_id = groups.id), high_water_mark + 1) FROM groups WHERE id = $1", g.ID), backend.ErrNoSuchGroup)
+}
+
+func (pb *PostgresBackend) GetGroup(ctx context.Context, groupName string) (models.Group, error) {
+	var group models.Group
+	return group, notFound(pb.db.GetContext(ctx, &group, "SELECT * FROM groups WHERE group_name = $1", groupName), backend.ErrNoSuchGroup)
+}
+
+func (pb *PostgresBackend) GetNewGroupsSince(ctx context.Context, timestamp int64) ([]models.Group, error) {
+	var groups []models.Group
+	return groups, pb.db.SelectContext(ctx, &groups, "SELECT * FROM groups WHERE created_at > to_timestamp($1)", timestamp)
+}
+
+// SaveArticle stores the article in a single transaction. Article numbers are taken by incrementing
+// high water marks of the groups, the row locks keep concurrent instances from allocating the same number.
+func (pb *PostgresBackend) SaveArticle(ctx context.Context, a models.Article, groups []string) error {
+	return pb.saveArticle(ctx, a, groups, 0)
+}
+
+func (pb *PostgresBackend) PublishPendingArticle(ctx context.Context, id int, a models.Article, groups []string) error {
+	return pb.saveArticle(ctx, a, groups, id)
+}
+
+// saveArticle stores the article, the pending article with pendingID is removed in the same transaction
+// unless the id is zero.
+func (pb *PostgresBackend) saveArticle(ctx context.Context, a models.Article, groups []string, pendingID int) error {
+	var groupIDs []int
+	for _, v := range groups {
+		v = strings.TrimSpace(v)
+		g, err := pb.GetGroup(ctx, v)
+		if err != nil {
+			return err
+		}
+		groupIDs = append(groupIDs, g.ID)
+	}
+	o, err := utils.NewOverview(&a, 0)
+	if err != nil {
+		return err
+	}
+	// groups are always locked in the same order, so crossposts saved concurrently can't deadlock
+	sort.Ints(groupIDs)
+
+	tx, err := pb.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if pendingID != 0 {
+		res, err := tx.ExecContext(ctx, "DELETE FROM pending_articles WHERE id = $1", pendingID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return backend.ErrNotFound
+		}
+	}
+
+	messageID := a.Header.Get("Message-ID")
+	res, err := tx.ExecContext(ctx, "INSERT INTO history (message_id) VALUES ($1) ON CONFLICT DO NOTHING", messageID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return backend.ErrDuplicate
+	}
+
+	if a.Thread.Valid {
+		// the thread of the article may have got its own root since the article was made, e.g. while it was pending
+		var root sql.NullString
+		if err := tx.GetContext(ctx, &root, "SELECT thread FROM articles WHERE message_id = $1 LIMIT 1", a.Thread.String); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if root.Valid {
+			a.Thread = root
+		}
+	}
+	var articleID int
+	if err := tx.GetContext(ctx, &articleID, "INSERT INTO articles (header, body, thread, parent, message_id) VALUES ($1, $2, $3, $4, $5) RETURNING id", a.HeaderRaw, a.Body, a.Thread, a.Parent, messageID); err != nil {
+		return err
+	}
+	if a.Thread.Valid {
+		// replies which arrived before the article had it as their thread root
+		if _, err := tx.ExecContext(ctx, "UPDATE articles SET thread = $1 WHERE thread = $2", a.Thread, messageID); err != nil {
+			return err
+		}
+	}
+
+	for _, v := range groupIDs {
+		var num int
+		if err := tx.GetContext(ctx, &num, "UPDATE groups SET high_water_mark = high_water_mark + 1 WHERE id = $1 RETURNING high_water_mark", v); err != nil {
+			// the group has been deleted meanwhile
+			return notFound(err, backend.ErrNoSuchGroup)
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO articles_to_groups (article_id, article_number, group_id) VALUES ($1, $2, $3)", articleID, num, v); err != nil {
+			return err
+		}
+		o.Number = num
+		if err := insertOverview(ctx, tx, v, articleID, o); err != nil {
+			return err
+		}
+	}
+
+	// save attachments into db
+	for _, v := range a.Attachments {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO attachments_articles_mapping (article_id, content_type, attachment_id) VALUES ($1, $2, $3)", articleID, v.ContentType, v.FileName); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (pb *PostgresBackend) GetArticleGroups(ctx context.Context, messageID string) ([]models.Group, error) {
+	var groups []models.Group
+	return groups, pb.db.SelectContext(ctx, &groups, "SELECT groups.* FROM groups INNER JOIN articles_to_groups atg ON atg.group_id = groups.id INNER JOIN articles ON articles.id = atg.article_id WHERE articles.message_id = $1 ORDER BY groups.id", messageID)
+}
+
+func (pb *PostgresBackend) GetArticle(ctx context.Context, messageID string) (models.Article, error) {
+	var a models.Article
+	if err := pb.db.GetContext(ctx, &a, "SELECT * FROM articles WHERE message_id = $1", messageID); err != nil {
+		return a, notFound(err, backend.ErrNoSuchArticle)
+	}
+	if err := pb.db.GetContext(ctx, &a.ArticleNumber, "SELECT article_number FROM articles_to_groups WHERE article_id = $1 LIMIT 1", a.ID); err != nil {
+		// the article isn't in any group
+		return a, notFound(err, backend.ErrNoSuchArticle)
+	}
+	if err := pb.db.SelectContext(ctx, &a.Attachments, "SELECT content_type, attachment_id FROM attachments_articles_mapping WHERE article_id = $1", a.ID); err != nil {
+		return a, err
+	}
+	return a, json.Unmarshal([]byte(a.HeaderRaw), &a.Header)
+}
+
+func (pb *PostgresBackend) GetArticleByNumber(ctx context.Context, g *models.Group, num int) (models.Article, error) {
+	var a models.Article
+	if err := pb.db.GetContext(ctx, &a, "SELECT articles.* FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number = $1 AND atg.group_id = $2", num, g.ID); err != nil {
+		return a, notFound(err, backend.ErrNoSuchArticle)
+	}
+	a.ArticleNumber = num
+	if err := pb.db.SelectContext(ctx, &a.Attachments, "SELECT content_type, attachment_id FROM attachments_articles_mapping WHERE article_id = $1", a.ID); err != nil {
+		return a, err
+	}
+	return a, json.Unmarshal([]byte(a.HeaderRaw), &a.Header)
+}
+
+func (pb *PostgresBackend) GetArticleNumbers(ctx context.Context, g *models.Group, low, high int64) ([]int64, error) {
+	var numbers []int64
+
+	if high == 0 && low == 0 {
+		if err := pb.db.SelectContext(ctx, &numbers, "SELECT article_number FROM articles_to_groups WHERE group_id = $1 ORDER BY article_number", g.ID); err != nil {
+			return nil, err
+		}
+	} else if low == -1 && high != 0 {
+		if err := pb.db.SelectContext(ctx, &numbers, "SELECT article_number FROM articles_to_groups WHERE group_id = $1 AND article_number = $2", g.ID, high); err != nil {
+			return nil, err
+		}
+	} else if low != 0 && high == -1 {
+		if err := pb.db.SelectContext(ctx, &numbers, "SELECT article_number FROM articles_to_groups WHERE group_id = $1 AND article_number > $2 ORDER BY article_number", g.ID, low); err != nil {
+			return nil, err
+		}
+	} else if low == -1 && high == -1 {
+		return nil, nil
+	} else {
+		if err := pb.db.SelectContext(ctx, &numbers, "SELECT article_number FROM articles_to_groups WHERE group_id = $1 AND article_number > $2 AND article_number < $3 ORDER BY article_number", g.ID, low, high); err != nil {
+			return nil, err
+		}
+	}
+
+	return numbers, nil
+}
+
+func (pb *PostgresBackend) GetLastArticleByNum(ctx context.Context, g *models.Group, a *models.Article) (models.Article, error) {
+	var lastArticle models.Article
+	if err := pb.db.GetContext(ctx, &lastArticle, "SELECT articles.* FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number < $1 AND atg.group_id = $2 ORDER BY atg.article_number DESC LIMIT 1", a.ArticleNumber, g.ID); err != nil {
+		return lastArticle, notFound(err, backend.ErrNoSuchArticle)
+	}
+	if err := pb.db.GetContext(ctx, &lastArticle.ArticleNumber, "SELECT article_number FROM articles_to_groups WHERE article_id = $1 AND group_id = $2", lastArticle.ID, g.ID); err != nil {
+		return lastArticle, err
+	}
+	return lastArticle, json.Unmarshal([]byte(lastArticle.HeaderRaw), &lastArticle.Header)
+}
+
+func (pb *PostgresBackend) GetNextArticleByNum(ctx context.Context, g *models.Group, a *models.Article) (models.Article, error) {
+	var nextArticle models.Article
+	if err := pb.db.GetContext(ctx, &nextArticle, "SELECT articles.* FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number > $1 AND atg.group_id = $2 ORDER BY atg.article_number LIMIT 1", a.ArticleNumber, g.ID); err != nil {
+		return nextArticle, notFound(err, backend.ErrNoSuchArticle)
+	}
+	if err := pb.db.GetContext(ctx, &nextArticle.ArticleNumber, "SELECT article_number FROM articles_to_groups WHERE article_id = $1 AND group_id = $2", nextArticle.ID, g.ID); err != nil {
+		return nextArticle, err
+	}
+	return nextArticle, json.Unmarshal([]byte(nextArticle.HeaderRaw), &nextArticle.Header)
+}
+
+func (pb *PostgresBackend) GetArticlesByRange(ctx context.Context, g *models.Group, low, high int64) ([]models.Article, error) {
+	var rows []struct {
+		models.Article
+		Number int `db:"article_number"`
+	}
+	if err := pb.db.SelectContext(ctx, &rows, "SELECT articles.*, atg.article_number FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number >= $1 AND atg.article_number <= $2 AND atg.group_id = $3 ORDER BY atg.article_number", low, high, g.ID); err != nil {
+		return nil, err
+	}
+
+	articles := make([]models.Article, len(rows))
+	for i, v := range rows {
+		articles[i] = v.Article
+		articles[i].ArticleNumber = v.Number
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return articles, nil
+}
+
+// SearchArticles scans the articles with ILIKE, there is no search index.
+func (pb *PostgresBackend) SearchArticles(ctx context.Context, groups []models.Group, query string, limit int) ([]models.SearchResult, error) {
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	var groupIDs []int
+	for _, v := range groups {
+		groupIDs = append(groupIDs, v.ID)
+	}
+
+	q := "SELECT a.message_id, g.group_name, atg.article_number FROM articles a INNER JOIN articles_to_groups atg ON atg.article_id = a.id INNER JOIN groups g ON g.id = atg.group_id WHERE atg.group_id IN (?)"
+	args := []interface{}{groupIDs}
+	for _, t := range utils.SearchTerms(query) {
+		q += " AND (a.header->'Subject'->>0 ILIKE ? OR a.header->'From'->>0 ILIKE ? OR a.body ILIKE ?)"
+		p := "%" + likeEscaper.Replace(t) + "%"
+		args = append(args, p, p, p)
+	}
+	q += " ORDER BY a.id DESC, atg.group_id LIMIT ?"
+	args = append(args, limit)
+
+	q, args, err := sqlx.In(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	var results []models.SearchResult
+	return results, pb.db.SelectContext(ctx, &results, pb.db.Rebind(q), args...)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (pb *PostgresBackend) GetOverview(ctx context.Context, g *models.Group, low, high int64, fn func(o models.Overview) error) error {
+	rows, err := pb.db.QueryxContext(ctx, "SELECT article_number, subject, from_header, date, message_id, references_header, bytes, lines FROM overview WHERE group_id = $1 AND article_number >= $2 AND article_number <= $3 ORDER BY article_number", g.ID, low, high)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var o models.Overview
+		if err := rows.StructScan(&o); err != nil {
+			return err
+		}
+		if err := fn(o); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (pb *PostgresBackend) GetNewArticlesSince(ctx context.Context, timestamp int64) ([]string, error) {
+	var articleIds []string
+	return articleIds, pb.db.SelectContext(ctx, &articleIds, "SELECT message_id FROM articles WHERE created_at > to_timestamp($1)", timestamp)
+}
+
+// threadHead selects the articles heading threads in the group with id atg.group_id: the roots,
+// and the earliest articles of threads whose roots are missing.
+const threadHead = `(articles.thread IS NULL OR (
+	NOT EXISTS (SELECT 1 FROM articles root WHERE root.message_id = articles.thread) AND
+	articles.id = (SELECT MIN(t.id) FROM articles t INNER JOIN articles_to_groups tatg ON tatg.article_id = t.id WHERE tatg.group_id = atg.group_id AND t.thread = articles.thread)))`
+
+func (pb *PostgresBackend) GetNewThreads(ctx context.Context, g *models.Group, perPage int, pageNum int, order models.ThreadOrder) ([]int, error) {
+	var numbers []int
+
+	orderBy := "articles.created_at DESC, articles.id DESC"
+	if order == models.ThreadOrderLastReply {
+		// ids grow in the order of arrival, so the latest reply has the greatest one
+		orderBy = "COALESCE((SELECT MAX(r.id) FROM articles r INNER JOIN articles_to_groups ratg ON ratg.article_id = r.id WHERE ratg.group_id = atg.group_id AND r.thread = COALESCE(articles.thread, articles.message_id)), articles.id) DESC"
+	}
+	return numbers, pb.db.SelectContext(ctx, &numbers, "SELECT atg.article_number FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.group_id = $1 AND "+threadHead+" ORDER BY "+orderBy+" LIMIT $2 OFFSET $3", g.ID, perPage, perPage*pageNum)
+}
+
+// threadRoot returns the message id of the article with the number, or its thread if the root of the thread
+// is missing. The string is empty if there is no such article.
+func (pb *PostgresBackend) threadRoot(ctx context.Context, g *models.Group, num int) (string, error) {
+	var root string
+	err := pb.db.GetContext(ctx, &root, `SELECT CASE WHEN articles.thread IS NOT NULL AND NOT EXISTS (SELECT 1 FROM articles root WHERE root.message_id = articles.thread)
+		THEN articles.thread ELSE articles.message_id END
+		FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.group_id = $1 AND atg.article_number = $2`, g.ID, num)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return root, err
+}
+
+func (pb *PostgresBackend) GetThread(ctx context.Context, g *models.Group, threadNum int) ([]int, error) {
+	root, err := pb.threadRoot(ctx, g, threadNum)
+	if err != nil || root == "" {
+		return nil, err
+	}
+
+	var numbers []int
+	return numbers, pb.db.SelectContext(ctx, &numbers, "SELECT atg.article_number FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.group_id = $1 AND articles.thread = $2 AND atg.article_number != $3 ORDER BY articles.created_at, articles.id", g.ID, root, threadNum)
+}
+
+func (pb *PostgresBackend) GetThreadTree(ctx context.Context, g *models.Group, threadNum int) ([]models.ThreadNode, error) {
+	root, err := pb.threadRoot(ctx, g, threadNum)
+	if err != nil || root == "" {
+		return nil, err
+	}
+
+	var nodes []models.ThreadNode
+	if err := pb.db.SelectContext(ctx, &nodes, "SELECT atg.article_number, articles.message_id, articles.parent FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.group_id = $1 AND (articles.message_id = $2 OR articles.thread = $2) ORDER BY articles.created_at, articles.id", g.ID, root); err != nil {
+		return nil, err
+	}
+	return utils.BuildThreadTree(nodes, root), nil
+}
+
+func (pb *PostgresBackend) GetUser(ctx context.Context, username string) (models.User, error) {
+	var user models.User
+	return user, notFound(pb.db.GetContext(ctx, &user, "SELECT * FROM users WHERE username = $1", username), backend.ErrNotFound)
+}
+
+func (pb *PostgresBackend) SaveUser(ctx context.Context, u models.User) error {
+	_, err := pb.db.ExecContext(ctx, "INSERT INTO users (username, password_hash, scram_salt, scram_iterations, scram_stored_key, scram_server_key) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT(username) DO UPDATE SET password_hash = excluded.password_hash, scram_salt = excluded.scram_salt, scram_iterations = excluded.scram_iterations, scram_stored_key = excluded.scram_stored_key, scram_server_key = excluded.scram_server_key", u.Username, u.PasswordHash, u.ScramSalt, u.ScramIterations, u.ScramStoredKey, u.ScramServerKey)
+	return err
+}
+
+func (pb *PostgresBackend) ListUsers(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	return users, pb.db.SelectContext(ctx, &users, "SELECT * FROM users ORDER BY username")
+}
+
+func (pb *PostgresBackend) DeleteUser(ctx context.Context, username string) error {
+	if _, err := pb.db.ExecContext(ctx, "DELETE FROM group_acl WHERE username = $1", username); err != nil {
+		return err
+	}
+	_, err := pb.db.ExecContext(ctx, "DELETE FROM users WHERE username = $1", username)
+	return err
+}
+
+func (pb *PostgresBackend) GetGroupACL(ctx context.Context, g *models.Group) ([]models.ACLEntry, error) {
+	var entries []models.ACLEntry
+	return entries, pb.db.SelectContext(ctx, &entries, "SELECT * FROM group_acl WHERE group_id = $1", g.ID)
+}
+
+func (pb *PostgresBackend) SaveACLEntry(ctx context.Context, e models.ACLEntry) error {
+	_, err := pb.db.ExecContext(ctx, "INSERT INTO group_acl (group_id, username, can_read, can_post, can_moderate) VALUES ($1, $2, $3, $4, $5) ON CONFLICT(group_id, username) DO UPDATE SET can_read = excluded.can_read, can_post = excluded.can_post, can_moderate = excluded.can_moderate", e.GroupID, e.Username, e.CanRead, e.CanPost, e.CanModerate)
+	return err
+}
+
+func (pb *PostgresBackend) DeleteACLEntry(ctx context.Context, g *models.Group, username string) error {
+	_, err := pb.db.ExecContext(ctx, "DELETE FROM group_acl WHERE group_id = $1 AND username = $2", g.ID, username)
+	return err
+}
+
+func (pb *PostgresBackend) SavePendingArticle(ctx context.Context, a models.Article, g *models.Group, submitter string) (int, error) {
+	attachments, err := json.Marshal(a.Attachments)
+	if err != nil {
+		return 0, err
+	}
+	var id int
+	return id, pb.db.GetContext(ctx, &id, "INSERT INTO pending_articles (group_id, header, body, thread, parent, attachments, submitter) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id", g.ID, a.HeaderRaw, a.Body, a.Thread, a.Parent, string(attachments), submitter)
+}
+
+func (pb *PostgresBackend) GetPendingArticles(ctx context.Context, g *models.Group) ([]models.PendingArticle, error) {
+	var articles []models.PendingArticle
+	if err := pb.db.SelectContext(ctx, &articles, "SELECT * FROM pending_articles WHERE group_id = $1 ORDER BY id", g.ID); err != nil {
+		return nil, err
+	}
+	for i := range articles {
+		if err := unmarshalPendingArticle(&articles[i]); err != nil {
+			return nil, err
+		}
+	}
+	return articles, nil
+}
+
+func (pb *PostgresBackend) GetPendingArticle(ctx context.Context, id int) (models.PendingArticle, error) {
+	var a models.PendingArticle
+	if err := pb.db.GetContext(ctx, &a, "SELECT * FROM pending_articles WHERE id = $1", id); err != nil {
+		return a, notFound(err, backend.ErrNotFound)
+	}
+	return a, unmarshalPendingArticle(&a)
+}
+
+func (pb *PostgresBackend) DeletePendingArticle(ctx context.Context, id int) error {
+	res, err := pb.db.ExecContext(ctx, "DELETE FROM pending_articles WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return backend.ErrNotFound
+	}
+	return nil
+}
+
+func unmarshalPendingArticle(a *models.PendingArticle) error {
+	if err := json.Unmarshal([]byte(a.HeaderRaw), &a.Header); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(a.AttachmentsRaw), &a.Attachments)
+}
+
+func (pb *PostgresBackend) HasMessageID(ctx context.Context, messageID string) (bool, error) {
+	var exists bool
+	return exists, pb.db.GetContext(ctx, &exists, "SELECT EXISTS(SELECT 1 FROM history WHERE message_id = $1)", messageID)
+}
+
+func (pb *PostgresBackend) PurgeHistory(ctx context.Context, before time.Time) (int, error) {
+	res, err := pb.db.ExecContext(ctx, "DELETE FROM history WHERE removed_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (pb *PostgresBackend) GetArticlesSinceID(ctx context.Context, id int, limit int) ([]models.Article, error) {
+	var articles []models.Article
+	if err := pb.db.SelectContext(ctx, &articles, "SELECT * FROM articles WHERE id > $1 ORDER BY id LIMIT $2", id, limit); err != nil {
+		return nil, err
+	}
+	for i := range articles {
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+	return articles, nil
+}
+
+func (pb *PostgresBackend) GetState(ctx context.Context, key string) (string, error) {
+	var value string
+	return value, notFound(pb.db.GetContext(ctx, &value, "SELECT value FROM state WHERE key = $1", key), backend.ErrNotFound)
+}
+
+func (pb *PostgresBackend) SetState(ctx context.Context, key, value string) error {
+	_, err := pb.db.ExecContext(ctx, "INSERT INTO state (key, value) VALUES ($1, $2) ON CONFLICT(key) DO UPDATE SET value = excluded.value", key, value)
+	return err
+}
+
+func (pb *PostgresBackend) EnqueueFeedArticle(ctx context.Context, peer, messageID string) error {
+	_, err := pb.db.ExecContext(ctx, "INSERT INTO feed_queue (peer, message_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", peer, messageID)
+	return err
+}
+
+func (pb *PostgresBackend) GetFeedQueue(ctx context.Context, peer string, limit int) ([]models.FeedQueueItem, error) {
+	var items []models.FeedQueueItem
+	return items, pb.db.SelectContext(ctx, &items, "SELECT * FROM feed_queue WHERE peer = $1 AND next_attempt_at <= now() ORDER BY created_at LIMIT $2", peer, limit)
+}
+
+func (pb *PostgresBackend) UpdateFeedQueueItem(ctx context.Context, item models.FeedQueueItem) error {
+	_, err := pb.db.ExecContext(ctx, "UPDATE feed_queue SET attempts = $1, next_attempt_at = $2 WHERE peer = $3 AND message_id = $4", item.Attempts, item.NextAttemptAt, item.Peer, item.MessageID)
+	return err
+}
+
+func (pb *PostgresBackend) DeleteFeedQueueItem(ctx context.Context, peer, messageID string) error {
+	_, err := pb.db.ExecContext(ctx, "DELETE FROM feed_queue WHERE peer = $1 AND message_id = $2", peer, messageID)
+	return err
+}
+
+func (pb *PostgresBackend) GetFeedQueueSize(ctx context.Context, peer string) (int, error) {
+	var count int
+	return count, pb.db.GetContext(ctx, &count, "SELECT count(*) FROM feed_queue WHERE peer = $1", peer)
+}
+
+func (pb *PostgresBackend) ClearFeedQueue(ctx context.Context, peer string) error {
+	_, err := pb.db.ExecContext(ctx, "DELETE FROM feed_queue WHERE peer = $1", peer)
+	return err
+}
+
+func (pb *PostgresBackend) GetGroupArticleInfo(ctx context.Context, g *models.Group) ([]models.ArticleInfo, error) {
+	var info []models.ArticleInfo
+	return info, pb.db.SelectContext(ctx, &info, `SELECT atg.article_number, articles.message_id, articles.created_at,
+		octet_length(articles.header::text) + octet_length(articles.body) AS size,
+		COALESCE(articles.header->'Expires'->>0, '') AS expires,
+		(SELECT count(*) FROM articles_to_groups a WHERE a.article_id = articles.id) AS groups
+		FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.group_id = $1 ORDER BY atg.article_number`, g.ID)
+}
+
+// DeleteArticle removes the article from all groups, its group links and attachments are removed by cascade.
+// The history entry keeps the time of removal.
+func (pb *PostgresBackend) DeleteArticle(ctx context.Context, messageID string) error {
+	res, err := pb.db.ExecContext(ctx, `WITH removed AS (DELETE FROM articles WHERE message_id = $1 RETURNING message_id)
+		INSERT INTO history (message_id, removed_at) SELECT message_id, now() FROM removed
+		ON CONFLICT (message_id) DO UPDATE SET removed_at = excluded.removed_at`, messageID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return backend.ErrNoSuchArticle
+	}
+	return nil
+}
+
+func (pb *PostgresBackend) RememberMessageID(ctx context.Context, messageID string) error {
+	_, err := pb.db.ExecContext(ctx, "INSERT INTO history (message_id, removed_at) VALUES ($1, now()) ON CONFLICT DO NOTHING", messageID)
+	return err
+}
+
+func (pb *PostgresBackend) CreateGroup(ctx context.Context, g models.Group) error {
+	_, err := pb.db.ExecContext(ctx, "INSERT INTO groups (group_name, description, moderated, creator) VALUES ($1, $2, $3, $4)", g.GroupName, g.Description, g.Moderated, g.Creator)
+	return err
+}
+
+func (pb *PostgresBackend) UpdateGroup(ctx context.Context, g models.Group) error {
+	_, err := pb.db.ExecContext(ctx, "UPDATE groups SET group_name = $1, description = $2, moderated = $3 WHERE id = $4", g.GroupName, g.Description, g.Moderated, g.ID)
+	return err
+}
+
+// DeleteGroup removes the group, its article links, ACL entries and pending articles are removed by cascade.
+// Articles stay in the other groups they are posted to.
+func (pb *PostgresBackend) DeleteGroup(ctx context.Context, g *models.Group) error {
+	_, err := pb.db.ExecContext(ctx, "DELETE FROM groups WHERE id = $1", g.ID)
+	return err
+}
+
+func (pb *PostgresBackend) ListBans(ctx context.Context) ([]models.Ban, error) {
+	var bans []models.Ban
+	return bans, pb.db.SelectContext(ctx, &bans, "SELECT * FROM bans ORDER BY id")
+}
+
+func (pb *PostgresBackend) SaveBan(ctx context.Context, b models.Ban) (int, error) {
+	var id int
+	return id, pb.db.GetContext(ctx, &id, "INSERT INTO bans (type, value, reason) VALUES ($1, $2, $3) RETURNING id", b.Type, b.Value, b.Reason)
+}
+
+func (pb *PostgresBackend) DeleteBan(ctx context.Context, id int) error {
+	res, err := pb.db.ExecContext(ctx, "DELETE FROM bans WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return backend.ErrNotFound
+	}
+	return err
+}
+
+// notFound replaces sql.ErrNoRows with the error the backend interface defines for the missing entity.
+func notFound(err error, notFoundErr error) error {
+	if err == sql.ErrNoRows {
+		return notFoundErr
+	}
+	return err
+}
@@ -0,0 +1,38 @@
+package postgres
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/backend/backendtest"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/jmoiron/sqlx"
+)
+
+// dsnEnv names the variable with the DSN of a database for the tests, everything in its public schema is dropped.
+const dsnEnv = "YANS_TEST_POSTGRES_DSN"
+
+func TestConformance(t *testing.T) {
+	dsn := os.Getenv(dsnEnv)
+	if dsn == "" {
+		t.Skipf("%s isn't set", dsnEnv)
+	}
+	backendtest.Run(t, func(t *testing.T) backend.StorageBackend {
+		db, err := sqlx.Open("postgres", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if _, err := db.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public"); err != nil {
+			t.Fatal(err)
+		}
+
+		pb, err := NewPostgresBackend(config.PostgresBackendConfig{DSN: dsn})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { pb.db.Close() })
+		return pb
+	})
+}
@@ -0,0 +1,7 @@
+//go:build sqlite_fts5
+// +build sqlite_fts5
+
+package sqlite
+
+// fts5Enabled tells whether go-sqlite3 is built with FTS5 module, it is enabled by sqlite_fts5 build tag.
+const fts5Enabled = true
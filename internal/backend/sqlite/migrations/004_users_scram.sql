@@ -0,0 +1,13 @@
+-- +goose Up
+
+ALTER TABLE users ADD COLUMN scram_salt TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN scram_iterations INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN scram_stored_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN scram_server_key TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+
+ALTER TABLE users DROP COLUMN scram_salt;
+ALTER TABLE users DROP COLUMN scram_iterations;
+ALTER TABLE users DROP COLUMN scram_stored_key;
+ALTER TABLE users DROP COLUMN scram_server_key;
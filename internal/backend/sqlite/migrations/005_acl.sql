@@ -0,0 +1,15 @@
+-- +goose Up
+
+CREATE TABLE IF NOT EXISTS group_acl(
+    group_id INTEGER NOT NULL,
+    username TEXT NOT NULL,
+    can_read BOOLEAN NOT NULL DEFAULT 1,
+    can_post BOOLEAN NOT NULL DEFAULT 0,
+    can_moderate BOOLEAN NOT NULL DEFAULT 0,
+    UNIQUE (group_id, username),
+    FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS group_acl;
@@ -0,0 +1,20 @@
+-- +goose Up
+
+ALTER TABLE groups ADD COLUMN moderated BOOLEAN NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS pending_articles(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    group_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    header TEXT,
+    thread TEXT,
+    body TEXT NOT NULL,
+    attachments TEXT NOT NULL DEFAULT '[]',
+    submitter TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS pending_articles;
+ALTER TABLE groups DROP COLUMN moderated;
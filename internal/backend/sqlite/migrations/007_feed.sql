@@ -0,0 +1,20 @@
+-- +goose Up
+
+CREATE TABLE IF NOT EXISTS state(
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS feed_queue(
+    peer TEXT NOT NULL,
+    message_id TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (peer, message_id)
+);
+CREATE INDEX IF NOT EXISTS feed_queue_next_attempt ON feed_queue(peer, next_attempt_at);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS state;
+DROP TABLE IF EXISTS feed_queue;
@@ -0,0 +1,10 @@
+-- +goose Up
+
+ALTER TABLE articles ADD COLUMN message_id TEXT NOT NULL DEFAULT '';
+UPDATE articles SET message_id = ifnull(json_extract(header, '$.Message-Id[0]'), '');
+CREATE INDEX IF NOT EXISTS articles_message_id ON articles(message_id);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS articles_message_id;
+ALTER TABLE articles DROP COLUMN message_id;
@@ -0,0 +1,12 @@
+-- +goose Up
+
+CREATE TABLE IF NOT EXISTS history(
+    message_id TEXT PRIMARY KEY,
+    arrived_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+INSERT OR IGNORE INTO history (message_id, arrived_at) SELECT message_id, created_at FROM articles WHERE message_id != '';
+CREATE INDEX IF NOT EXISTS history_arrived_at ON history(arrived_at);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS history;
@@ -0,0 +1,11 @@
+-- +goose Up
+
+-- article numbers must not be reused after articles are expired
+ALTER TABLE groups ADD COLUMN high_water_mark INTEGER NOT NULL DEFAULT 0;
+UPDATE groups SET high_water_mark = (SELECT ifnull(max(article_number), 0) FROM articles_to_groups WHERE group_id = groups.id);
+CREATE INDEX IF NOT EXISTS articles_to_groups_article_id ON articles_to_groups(article_id);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS articles_to_groups_article_id;
+ALTER TABLE groups DROP COLUMN high_water_mark;
@@ -0,0 +1,22 @@
+-- +goose Up
+
+-- overview (NOV) records are written when articles are saved, so OVER doesn't have to parse articles;
+-- records of existing articles are filled by the backend on start
+CREATE TABLE IF NOT EXISTS overview(
+    group_id INTEGER NOT NULL,
+    article_number INTEGER NOT NULL,
+    article_id INTEGER NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',
+    from_header TEXT NOT NULL DEFAULT '',
+    date TEXT NOT NULL DEFAULT '',
+    message_id TEXT NOT NULL DEFAULT '',
+    references_header TEXT NOT NULL DEFAULT '',
+    bytes INTEGER NOT NULL DEFAULT 0,
+    lines INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (group_id, article_number)
+);
+CREATE INDEX IF NOT EXISTS overview_article_id ON overview(article_id);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS overview;
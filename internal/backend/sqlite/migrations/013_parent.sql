@@ -0,0 +1,15 @@
+-- +goose Up
+
+-- parent is the message id of the article the one replies to, threads of existing articles had no nesting,
+-- so their replies are attached to the roots
+ALTER TABLE articles ADD COLUMN parent TEXT;
+UPDATE articles SET parent = thread WHERE thread IS NOT NULL;
+CREATE INDEX IF NOT EXISTS articles_thread ON articles(thread);
+ALTER TABLE pending_articles ADD COLUMN parent TEXT;
+UPDATE pending_articles SET parent = thread WHERE thread IS NOT NULL;
+
+-- +goose Down
+
+ALTER TABLE pending_articles DROP COLUMN parent;
+DROP INDEX IF EXISTS articles_thread;
+ALTER TABLE articles DROP COLUMN parent;
@@ -0,0 +1,12 @@
+-- +goose Up
+
+-- removed_at is when the article has been removed or rejected, its message id is remembered for some time after it.
+-- It isn't known when articles which are already gone have been removed, so they are remembered from now on.
+ALTER TABLE history ADD COLUMN removed_at DATETIME;
+UPDATE history SET removed_at = CURRENT_TIMESTAMP WHERE NOT EXISTS (SELECT 1 FROM articles WHERE articles.message_id = history.message_id);
+CREATE INDEX IF NOT EXISTS history_removed_at ON history(removed_at);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS history_removed_at;
+ALTER TABLE history DROP COLUMN removed_at;
@@ -0,0 +1,8 @@
+-- +goose Up
+
+-- creator is the address of whoever has created the group, it isn't known for existing groups
+ALTER TABLE groups ADD COLUMN creator TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+
+ALTER TABLE groups DROP COLUMN creator;
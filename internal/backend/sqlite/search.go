@@ -0,0 +1,97 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+// The search index is FTS5 table with the rowid of the article. It isn't created by a migration since FTS5 module
+// is present only in the builds with sqlite_fts5 tag, the other builds search with LIKE.
+
+// initSearchIndex creates the search index and adds the articles which aren't indexed yet, e.g. the ones saved
+// by a build without FTS5.
+func (sb *SQLiteBackend) initSearchIndex(ctx context.Context) error {
+	if !fts5Enabled {
+		log.Print("sqlite: the server is built without sqlite_fts5 tag, search scans all articles; build it with -tags sqlite_fts5 to have the full-text index")
+		return nil
+	}
+	if _, err := sb.db.ExecContext(ctx, "CREATE VIRTUAL TABLE IF NOT EXISTS articles_fts USING fts5(subject, from_header, body, tokenize = 'unicode61 remove_diacritics 2')"); err != nil {
+		return err
+	}
+
+	var articles []models.Article
+	if err := sb.db.SelectContext(ctx, &articles, "SELECT * FROM articles WHERE id NOT IN (SELECT rowid FROM articles_fts)"); err != nil {
+		return err
+	}
+	for _, v := range articles {
+		if err := json.Unmarshal([]byte(v.HeaderRaw), &v.Header); err != nil {
+			return err
+		}
+		if err := indexArticle(ctx, sb.db, v.ID, &v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func indexArticle(ctx context.Context, e sqlx.ExecerContext, articleID int, a *models.Article) error {
+	if !fts5Enabled {
+		return nil
+	}
+	_, err := e.ExecContext(ctx, "INSERT INTO articles_fts (rowid, subject, from_header, body) VALUES (?, ?, ?, ?)", articleID, a.Header.Get("Subject"), a.Header.Get("From"), a.Body)
+	return err
+}
+
+func unindexArticle(ctx context.Context, e sqlx.ExecerContext, articleID int) error {
+	if !fts5Enabled {
+		return nil
+	}
+	_, err := e.ExecContext(ctx, "DELETE FROM articles_fts WHERE rowid = ?", articleID)
+	return err
+}
+
+func (sb *SQLiteBackend) SearchArticles(ctx context.Context, groups []models.Group, query string, limit int) ([]models.SearchResult, error) {
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	var groupIDs []int
+	for _, v := range groups {
+		groupIDs = append(groupIDs, v.ID)
+	}
+	terms := utils.SearchTerms(query)
+
+	q := "SELECT a.message_id, g.group_name, atg.article_number FROM articles a INNER JOIN articles_to_groups atg ON atg.article_id = a.id INNER JOIN groups g ON g.id = atg.group_id WHERE atg.group_id IN (?)"
+	args := []interface{}{groupIDs}
+	if fts5Enabled && len(terms) != 0 {
+		// every term is a quoted prefix query, so the syntax of FTS5 queries isn't exposed
+		var phrases []string
+		for _, t := range terms {
+			phrases = append(phrases, `"`+strings.ReplaceAll(t, `"`, `""`)+`"*`)
+		}
+		q += " AND a.id IN (SELECT rowid FROM articles_fts WHERE articles_fts MATCH ?)"
+		args = append(args, strings.Join(phrases, " "))
+	} else {
+		for _, t := range terms {
+			q += ` AND (json_extract(a.header, '$.Subject[0]') LIKE ? ESCAPE '\' OR json_extract(a.header, '$.From[0]') LIKE ? ESCAPE '\' OR a.body LIKE ? ESCAPE '\')`
+			p := "%" + likeEscaper.Replace(t) + "%"
+			args = append(args, p, p, p)
+		}
+	}
+	q += " ORDER BY a.id DESC, atg.group_id LIMIT ?"
+	args = append(args, limit)
+
+	q, args, err := sqlx.In(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	var results []models.SearchResult
+	return results, sb.db.SelectContext(ctx, &results, q, args...)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
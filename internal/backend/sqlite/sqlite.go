@@ -1,10 +1,11 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"embed"
 	"encoding/json"
-	"fmt"
+	"github.com/ChronosX88/yans/internal/backend"
 	"github.com/ChronosX88/yans/internal/config"
 	"github.com/ChronosX88/yans/internal/models"
 	"github.com/ChronosX88/yans/internal/utils"
@@ -14,6 +15,8 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pressly/goose/v3"
 	"strings"
+	"sync"
+	"time"
 )
 
 //go:embed migrations/*.sql
@@ -27,13 +30,18 @@ func regexHelper(re, s string) (bool, error) {
 	return regexp2.MustCompile(re, regexp2.None).MatchString(s)
 }
 
+// registerDriver lets several backends be opened in one process, sql.Register panics on the second call.
+var registerDriver sync.Once
+
 func NewSQLiteBackend(cfg config.SQLiteBackendConfig) (*SQLiteBackend, error) {
-	sql.Register("sqlite3_with_regexp",
-		&sqlite3.SQLiteDriver{
-			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
-				return conn.RegisterFunc("regexp", regexHelper, true)
-			},
-		})
+	registerDriver.Do(func() {
+		sql.Register("sqlite3_with_regexp",
+			&sqlite3.SQLiteDriver{
+				ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+					return conn.RegisterFunc("regexp", regexHelper, true)
+				},
+			})
+	})
 
 	db, err := sqlx.Open("sqlite3_with_regexp", cfg.Path)
 	if err != nil {
@@ -49,17 +57,55 @@ func NewSQLiteBackend(cfg config.SQLiteBackendConfig) (*SQLiteBackend, error) {
 		return nil, err
 	}
 
-	return &SQLiteBackend{
+	sb := &SQLiteBackend{
 		db: db,
-	}, nil
+	}
+	if err := sb.fillOverview(context.Background()); err != nil {
+		return nil, err
+	}
+	if err := sb.initSearchIndex(context.Background()); err != nil {
+		return nil, err
+	}
+	return sb, nil
 }
 
-func (sb *SQLiteBackend) ListGroups() ([]models.Group, error) {
+// fillOverview adds the missing overview records of articles saved before the overview table was introduced.
+func (sb *SQLiteBackend) fillOverview(ctx context.Context) error {
+	var rows []struct {
+		models.Article
+		GroupID int `db:"group_id"`
+		Number  int `db:"article_number"`
+	}
+	if err := sb.db.SelectContext(ctx, &rows, "SELECT articles.*, atg.group_id, atg.article_number FROM articles INNER JOIN articles_to_groups atg ON atg.article_id = articles.id LEFT JOIN overview o ON o.group_id = atg.group_id AND o.article_number = atg.article_number WHERE o.article_id IS NULL"); err != nil {
+		return err
+	}
+	for _, v := range rows {
+		if err := json.Unmarshal([]byte(v.HeaderRaw), &v.Header); err != nil {
+			return err
+		}
+		o, err := utils.NewOverview(&v.Article, v.Number)
+		if err != nil {
+			return err
+		}
+		if err := insertOverview(ctx, sb.db, v.GroupID, v.ID, o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertOverview(ctx context.Context, e sqlx.ExecerContext, groupID, articleID int, o models.Overview) error {
+	_, err := e.ExecContext(ctx, "INSERT INTO overview (group_id, article_number, article_id, subject, from_header, date, message_id, references_header, bytes, lines) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		groupID, o.Number, articleID, o.Subject, o.From, o.Date, o.MessageID, o.References, o.Bytes, o.Lines)
+	return err
+}
+
+func (sb *SQLiteBackend) ListGroups(ctx context.Context) ([]models.Group, error) {
 	var groups []models.Group
-	return groups, sb.db.Select(&groups, "SELECT * FROM groups")
+	return groups, sb.db.SelectContext(ctx, &groups, "SELECT * FROM groups")
 }
 
-func (sb *SQLiteBackend) ListGroupsByPattern(pattern string) ([]models.Group, error) {
+func (sb *SQLiteBackend) ListGroupsByPattern(ctx context.Context, pattern string) ([]models.Group, error) {
 	var groups []models.Group
 	w, err := utils.ParseWildmat(pattern)
 	if err != nil {
@@ -69,118 +115,195 @@ func (sb *SQLiteBackend) ListGroupsByPattern(pattern string) ([]models.Group, er
 	if err != nil {
 		return nil, err
 	}
-	return groups, sb.db.Select(&groups, "SELECT * FROM groups WHERE group_name REGEXP ?", r.String())
+	return groups, sb.db.SelectContext(ctx, &groups, "SELECT * FROM groups WHERE group_name REGEXP ?", r.String())
 }
 
-func (sb *SQLiteBackend) GetArticlesCount(g *models.Group) (int, error) {
+func (sb *SQLiteBackend) GetArticlesCount(ctx context.Context, g *models.Group) (int, error) {
 	var count int
-	return count, sb.db.Get(&count, "SELECT COUNT(*) FROM articles_to_groups WHERE group_id = ?", g.ID)
+	return count, sb.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM articles_to_groups WHERE group_id = ?", g.ID)
 }
 
-func (sb *SQLiteBackend) GetGroupHighWaterMark(g *models.Group) (int, error) {
+func (sb *SQLiteBackend) GetGroupHighWaterMark(ctx context.Context, g *models.Group) (int, error) {
 	var waterMark int
-	return waterMark, sb.db.Get(&waterMark, "SELECT COALESCE(max(article_number), 0) FROM articles_to_groups WHERE group_id = ?", g.ID)
+	return waterMark, notFound(sb.db.GetContext(ctx, &waterMark, "SELECT high_water_mark FROM groups WHERE id = ?", g.ID), backend.ErrNoSuchGroup)
 }
 
-func (sb *SQLiteBackend) GetGroupLowWaterMark(g *models.Group) (int, error) {
+func (sb *SQLiteBackend) GetGroupLowWaterMark(ctx context.Context, g *models.Group) (int, error) {
 	var waterMark int
-	return waterMark, sb.db.Get(&waterMark, "SELECT COALESCE(min(article_number), 0) FROM articles_to_groups WHERE group_id = ?", g.ID)
+	return waterMark, notFound(sb.db.GetContext(ctx, &waterMark, "SELECT COALESCE((SELECT min(article_number) FROM articles_to_groups WHERE group_id = groups.id), high_water_mark + 1) FROM groups WHERE id = ?", g.ID), backend.ErrNoSuchGroup)
 }
 
-func (sb *SQLiteBackend) GetGroup(groupName string) (models.Group, error) {
+func (sb *SQLiteBackend) GetGroup(ctx context.Context, groupName string) (models.Group, error) {
 	var group models.Group
-	return group, sb.db.Get(&group, "SELECT * FROM groups WHERE group_name = ?", groupName)
+	return group, notFound(sb.db.GetContext(ctx, &group, "SELECT * FROM groups WHERE group_name = ?", groupName), backend.ErrNoSuchGroup)
 }
 
-func (sb *SQLiteBackend) GetNewGroupsSince(timestamp int64) ([]models.Group, error) {
+func (sb *SQLiteBackend) GetNewGroupsSince(ctx context.Context, timestamp int64) ([]models.Group, error) {
 	var groups []models.Group
-	return groups, sb.db.Select(&groups, "SELECT * FROM groups WHERE created_at > datetime(?, 'unixepoch')", timestamp)
+	return groups, sb.db.SelectContext(ctx, &groups, "SELECT * FROM groups WHERE created_at > datetime(?, 'unixepoch')", timestamp)
 }
 
-func (sb *SQLiteBackend) SaveArticle(a models.Article, groups []string) error {
-	res, err := sb.db.Exec("INSERT INTO articles (header, body, thread) VALUES (?, ?, ?)", a.HeaderRaw, a.Body, a.Thread)
-	articleID, err := res.LastInsertId()
-	if err != nil {
-		return err
-	}
+// SaveArticle stores the article with its history entry, numbers and attachments in one transaction,
+// so nothing is left behind if any of the groups doesn't exist.
+func (sb *SQLiteBackend) SaveArticle(ctx context.Context, a models.Article, groups []string) error {
+	return sb.saveArticle(ctx, a, groups, 0)
+}
 
+func (sb *SQLiteBackend) PublishPendingArticle(ctx context.Context, id int, a models.Article, groups []string) error {
+	return sb.saveArticle(ctx, a, groups, id)
+}
+
+// saveArticle stores the article, the pending article with pendingID is removed in the same transaction
+// unless the id is zero.
+func (sb *SQLiteBackend) saveArticle(ctx context.Context, a models.Article, groups []string, pendingID int) error {
 	var groupIDs []int
 	for _, v := range groups {
 		v = strings.TrimSpace(v)
-		g, err := sb.GetGroup(v)
+		g, err := sb.GetGroup(ctx, v)
 		if err != nil {
-			if err == sql.ErrNoRows {
-				return fmt.Errorf("no such newsgroup")
-			} else {
-				return err
-			}
+			return err
 		}
 		groupIDs = append(groupIDs, g.ID)
 	}
+	o, err := utils.NewOverview(&a, 0)
+	if err != nil {
+		return err
+	}
 
-	for _, v := range groupIDs {
-		_, err = sb.db.Exec("INSERT INTO articles_to_groups (article_id, article_number, group_id) VALUES (?, (SELECT ifnull(max(article_number)+1, 1) FROM articles_to_groups WHERE group_id = ?), ?)", articleID, v, v)
+	// the transaction starts with a write, so it takes the write lock at once instead of upgrading to it
+	tx, err := sb.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if pendingID != 0 {
+		res, err := tx.ExecContext(ctx, "DELETE FROM pending_articles WHERE id = ?", pendingID)
 		if err != nil {
 			return err
 		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return backend.ErrNotFound
+		}
+	}
+
+	messageID := a.Header.Get("Message-ID")
+	res, err := tx.ExecContext(ctx, "INSERT INTO history (message_id) VALUES (?) ON CONFLICT DO NOTHING", messageID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return backend.ErrDuplicate
+	}
+
+	if a.Thread.Valid {
+		// the thread of the article may have got its own root since the article was made, e.g. while it was pending
+		var root sql.NullString
+		if err := tx.GetContext(ctx, &root, "SELECT thread FROM articles WHERE message_id = ? LIMIT 1", a.Thread.String); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if root.Valid {
+			a.Thread = root
+		}
+	}
+	res, err = tx.ExecContext(ctx, "INSERT INTO articles (header, body, thread, parent, message_id) VALUES (?, ?, ?, ?, ?)", a.HeaderRaw, a.Body, a.Thread, a.Parent, messageID)
+	if err != nil {
+		return err
+	}
+	articleID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if a.Thread.Valid {
+		// replies which arrived before the article had it as their thread root
+		if _, err := tx.ExecContext(ctx, "UPDATE articles SET thread = ? WHERE thread = ?", a.Thread, messageID); err != nil {
+			return err
+		}
+	}
+	if err := indexArticle(ctx, tx, int(articleID), &a); err != nil {
+		return err
+	}
+
+	for _, v := range groupIDs {
+		var num int
+		if err := tx.GetContext(ctx, &num, "UPDATE groups SET high_water_mark = high_water_mark + 1 WHERE id = ? RETURNING high_water_mark", v); err != nil {
+			// the group has been deleted meanwhile
+			return notFound(err, backend.ErrNoSuchGroup)
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO articles_to_groups (article_id, article_number, group_id) VALUES (?, ?, ?)", articleID, num, v); err != nil {
+			return err
+		}
+		o.Number = num
+		if err := insertOverview(ctx, tx, v, int(articleID), o); err != nil {
+			return err
+		}
 	}
 
 	// save attachments into db
 	for _, v := range a.Attachments {
-		_, err = sb.db.Exec("INSERT INTO attachments_articles_mapping (article_id, content_type, attachment_id) VALUES (?, ?, ?)", articleID, v.ContentType, v.FileName)
-		if err != nil {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO attachments_articles_mapping (article_id, content_type, attachment_id) VALUES (?, ?, ?)", articleID, v.ContentType, v.FileName); err != nil {
 			return err
 		}
 	}
 
-	return err
+	return tx.Commit()
+}
+
+func (sb *SQLiteBackend) GetArticleGroups(ctx context.Context, messageID string) ([]models.Group, error) {
+	var groups []models.Group
+	return groups, sb.db.SelectContext(ctx, &groups, "SELECT groups.* FROM groups INNER JOIN articles_to_groups atg ON atg.group_id = groups.id INNER JOIN articles ON articles.id = atg.article_id WHERE articles.message_id = ? ORDER BY groups.id", messageID)
 }
 
-func (sb *SQLiteBackend) GetArticle(messageID string) (models.Article, error) {
+func (sb *SQLiteBackend) GetArticle(ctx context.Context, messageID string) (models.Article, error) {
 	var a models.Article
-	if err := sb.db.Get(&a, "SELECT * FROM articles WHERE json_extract(articles.header, '$.Message-Id[0]') = ?", messageID); err != nil {
-		return a, err
+	if err := sb.db.GetContext(ctx, &a, "SELECT * FROM articles WHERE message_id = ?", messageID); err != nil {
+		return a, notFound(err, backend.ErrNoSuchArticle)
 	}
-	if err := sb.db.Get(&a.ArticleNumber, "SELECT article_number FROM articles_to_groups WHERE article_id = ?", a.ID); err != nil {
-		return a, err
+	if err := sb.db.GetContext(ctx, &a.ArticleNumber, "SELECT article_number FROM articles_to_groups WHERE article_id = ?", a.ID); err != nil {
+		// the article isn't in any group
+		return a, notFound(err, backend.ErrNoSuchArticle)
 	}
-	if err := sb.db.Select(&a.Attachments, "SELECT content_type, attachment_id FROM attachments_articles_mapping WHERE article_id = ?", a.ID); err != nil {
+	if err := sb.db.SelectContext(ctx, &a.Attachments, "SELECT content_type, attachment_id FROM attachments_articles_mapping WHERE article_id = ?", a.ID); err != nil {
 		return a, err
 	}
 	return a, json.Unmarshal([]byte(a.HeaderRaw), &a.Header)
 }
 
-func (sb *SQLiteBackend) GetArticleByNumber(g *models.Group, num int) (models.Article, error) {
+func (sb *SQLiteBackend) GetArticleByNumber(ctx context.Context, g *models.Group, num int) (models.Article, error) {
 	var a models.Article
-	if err := sb.db.Get(&a, "SELECT articles.* FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number = ? AND atg.group_id = ?", num, g.ID); err != nil {
-		return a, err
+	if err := sb.db.GetContext(ctx, &a, "SELECT articles.* FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number = ? AND atg.group_id = ?", num, g.ID); err != nil {
+		return a, notFound(err, backend.ErrNoSuchArticle)
 	}
 	a.ArticleNumber = num
-	if err := sb.db.Select(&a.Attachments, "SELECT content_type, attachment_id FROM attachments_articles_mapping WHERE article_id = ?", a.ID); err != nil {
+	if err := sb.db.SelectContext(ctx, &a.Attachments, "SELECT content_type, attachment_id FROM attachments_articles_mapping WHERE article_id = ?", a.ID); err != nil {
 		return a, err
 	}
 	return a, json.Unmarshal([]byte(a.HeaderRaw), &a.Header)
 }
 
-func (sb *SQLiteBackend) GetArticleNumbers(g *models.Group, low, high int64) ([]int64, error) {
+func (sb *SQLiteBackend) GetArticleNumbers(ctx context.Context, g *models.Group, low, high int64) ([]int64, error) {
 	var numbers []int64
 
 	if high == 0 && low == 0 {
-		if err := sb.db.Select(&numbers, "SELECT article_number FROM articles_to_groups WHERE group_id = ?", g.ID); err != nil {
+		if err := sb.db.SelectContext(ctx, &numbers, "SELECT article_number FROM articles_to_groups WHERE group_id = ? ORDER BY article_number", g.ID); err != nil {
 			return nil, err
 		}
 	} else if low == -1 && high != 0 {
-		if err := sb.db.Select(&numbers, "SELECT article_number FROM articles_to_groups WHERE group_id = ? AND article_number = ?", g.ID, high); err != nil {
+		if err := sb.db.SelectContext(ctx, &numbers, "SELECT article_number FROM articles_to_groups WHERE group_id = ? AND article_number = ?", g.ID, high); err != nil {
 			return nil, err
 		}
 	} else if low != 0 && high == -1 {
-		if err := sb.db.Select(&numbers, "SELECT article_number FROM articles_to_groups WHERE group_id = ? AND article_number > ?", g.ID, low); err != nil {
+		if err := sb.db.SelectContext(ctx, &numbers, "SELECT article_number FROM articles_to_groups WHERE group_id = ? AND article_number > ? ORDER BY article_number", g.ID, low); err != nil {
 			return nil, err
 		}
 	} else if low == -1 && high == -1 {
 		return nil, nil
 	} else {
-		if err := sb.db.Select(&numbers, "SELECT article_number FROM articles_to_groups WHERE group_id = ? AND article_number > ? AND article_number < ?", g.ID, low, high); err != nil {
+		if err := sb.db.SelectContext(ctx, &numbers, "SELECT article_number FROM articles_to_groups WHERE group_id = ? AND article_number > ? AND article_number < ? ORDER BY article_number", g.ID, low, high); err != nil {
 			return nil, err
 		}
 	}
@@ -188,38 +311,41 @@ func (sb *SQLiteBackend) GetArticleNumbers(g *models.Group, low, high int64) ([]
 	return numbers, nil
 }
 
-func (sb *SQLiteBackend) GetLastArticleByNum(g *models.Group, a *models.Article) (models.Article, error) {
+func (sb *SQLiteBackend) GetLastArticleByNum(ctx context.Context, g *models.Group, a *models.Article) (models.Article, error) {
 	var lastArticle models.Article
-	if err := sb.db.Get(&lastArticle, "SELECT articles.* FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number < ? AND atg.group_id = ? ORDER BY atg.article_number DESC LIMIT 1", a.ArticleNumber, g.ID); err != nil {
-		return lastArticle, err
+	if err := sb.db.GetContext(ctx, &lastArticle, "SELECT articles.* FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number < ? AND atg.group_id = ? ORDER BY atg.article_number DESC LIMIT 1", a.ArticleNumber, g.ID); err != nil {
+		return lastArticle, notFound(err, backend.ErrNoSuchArticle)
 	}
-	if err := sb.db.Get(&lastArticle.ArticleNumber, "SELECT article_number FROM articles_to_groups WHERE article_id = ?", lastArticle.ID); err != nil {
+	if err := sb.db.GetContext(ctx, &lastArticle.ArticleNumber, "SELECT article_number FROM articles_to_groups WHERE article_id = ?", lastArticle.ID); err != nil {
 		return lastArticle, err
 	}
 	return lastArticle, json.Unmarshal([]byte(lastArticle.HeaderRaw), &lastArticle.Header)
 }
 
-func (sb *SQLiteBackend) GetNextArticleByNum(g *models.Group, a *models.Article) (models.Article, error) {
+func (sb *SQLiteBackend) GetNextArticleByNum(ctx context.Context, g *models.Group, a *models.Article) (models.Article, error) {
 	var nextArticle models.Article
-	if err := sb.db.Get(&nextArticle, "SELECT articles.* FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number > ? AND atg.group_id = ? ORDER BY atg.article_number LIMIT 1", a.ArticleNumber, g.ID); err != nil {
-		return nextArticle, err
+	if err := sb.db.GetContext(ctx, &nextArticle, "SELECT articles.* FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number > ? AND atg.group_id = ? ORDER BY atg.article_number LIMIT 1", a.ArticleNumber, g.ID); err != nil {
+		return nextArticle, notFound(err, backend.ErrNoSuchArticle)
 	}
-	if err := sb.db.Get(&nextArticle.ArticleNumber, "SELECT article_number FROM articles_to_groups WHERE article_id = ?", nextArticle.ID); err != nil {
+	if err := sb.db.GetContext(ctx, &nextArticle.ArticleNumber, "SELECT article_number FROM articles_to_groups WHERE article_id = ?", nextArticle.ID); err != nil {
 		return nextArticle, err
 	}
 	return nextArticle, json.Unmarshal([]byte(nextArticle.HeaderRaw), &nextArticle.Header)
 }
 
-func (sb *SQLiteBackend) GetArticlesByRange(g *models.Group, low, high int64) ([]models.Article, error) {
-	var articles []models.Article
-
-	if err := sb.db.Select(&articles, "SELECT articles.* FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number >= ? AND atg.article_number <= ? AND atg.group_id = ? ORDER BY atg.article_number", low, high, g.ID); err != nil {
+func (sb *SQLiteBackend) GetArticlesByRange(ctx context.Context, g *models.Group, low, high int64) ([]models.Article, error) {
+	var rows []struct {
+		models.Article
+		Number int `db:"article_number"`
+	}
+	if err := sb.db.SelectContext(ctx, &rows, "SELECT articles.*, atg.article_number FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number >= ? AND atg.article_number <= ? AND atg.group_id = ? ORDER BY atg.article_number", low, high, g.ID); err != nil {
 		return nil, err
 	}
-	for i := 0; i < len(articles); i++ {
-		if err := sb.db.Get(&articles[i].ArticleNumber, "SELECT article_number FROM articles_to_groups WHERE article_id = ?", articles[i].ID); err != nil {
-			return nil, err
-		}
+
+	articles := make([]models.Article, len(rows))
+	for i, v := range rows {
+		articles[i] = v.Article
+		articles[i].ArticleNumber = v.Number
 		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
 			return nil, err
 		}
@@ -228,19 +354,347 @@ func (sb *SQLiteBackend) GetArticlesByRange(g *models.Group, low, high int64) ([
 	return articles, nil
 }
 
-func (sb *SQLiteBackend) GetNewArticlesSince(timestamp int64) ([]string, error) {
+func (sb *SQLiteBackend) GetOverview(ctx context.Context, g *models.Group, low, high int64, fn func(o models.Overview) error) error {
+	rows, err := sb.db.QueryxContext(ctx, "SELECT article_number, subject, from_header, date, message_id, references_header, bytes, lines FROM overview WHERE group_id = ? AND article_number >= ? AND article_number <= ? ORDER BY article_number", g.ID, low, high)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var o models.Overview
+		if err := rows.StructScan(&o); err != nil {
+			return err
+		}
+		if err := fn(o); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (sb *SQLiteBackend) GetNewArticlesSince(ctx context.Context, timestamp int64) ([]string, error) {
 	var articleIds []string
-	return articleIds, sb.db.Select(&articleIds, "SELECT json_extract(articles.header, '$.Message-Id[0]') FROM articles WHERE created_at > datetime(?, 'unixepoch')", timestamp)
+	return articleIds, sb.db.SelectContext(ctx, &articleIds, "SELECT message_id FROM articles WHERE created_at > datetime(?, 'unixepoch')", timestamp)
 }
 
-func (sb *SQLiteBackend) GetNewThreads(g *models.Group, perPage int, pageNum int) ([]int, error) {
+// threadHead selects the articles heading threads in the group with id atg.group_id: the roots,
+// and the earliest articles of threads whose roots are missing.
+const threadHead = `(articles.thread IS NULL OR (
+	NOT EXISTS (SELECT 1 FROM articles root WHERE root.message_id = articles.thread) AND
+	articles.id = (SELECT MIN(t.id) FROM articles t INNER JOIN articles_to_groups tatg ON tatg.article_id = t.id WHERE tatg.group_id = atg.group_id AND t.thread = articles.thread)))`
+
+func (sb *SQLiteBackend) GetNewThreads(ctx context.Context, g *models.Group, perPage int, pageNum int, order models.ThreadOrder) ([]int, error) {
 	var numbers []int
 
-	return numbers, sb.db.Select(&numbers, "SELECT atg.article_number FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.group_id = ? AND articles.thread IS NULL ORDER BY articles.created_at DESC LIMIT ? OFFSET ?", g.ID, perPage, perPage*pageNum)
+	orderBy := "articles.created_at DESC, articles.id DESC"
+	if order == models.ThreadOrderLastReply {
+		// ids grow in the order of arrival, so the latest reply has the greatest one
+		orderBy = "COALESCE((SELECT MAX(r.id) FROM articles r INNER JOIN articles_to_groups ratg ON ratg.article_id = r.id WHERE ratg.group_id = atg.group_id AND r.thread = COALESCE(articles.thread, articles.message_id)), articles.id) DESC"
+	}
+	return numbers, sb.db.SelectContext(ctx, &numbers, "SELECT atg.article_number FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.group_id = ? AND "+threadHead+" ORDER BY "+orderBy+" LIMIT ? OFFSET ?", g.ID, perPage, perPage*pageNum)
+}
+
+// threadRoot returns the message id of the article with the number, or its thread if the root of the thread
+// is missing. The string is empty if there is no such article.
+func (sb *SQLiteBackend) threadRoot(ctx context.Context, g *models.Group, num int) (string, error) {
+	var root string
+	err := sb.db.GetContext(ctx, &root, `SELECT CASE WHEN articles.thread IS NOT NULL AND NOT EXISTS (SELECT 1 FROM articles root WHERE root.message_id = articles.thread)
+		THEN articles.thread ELSE articles.message_id END
+		FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.group_id = ? AND atg.article_number = ?`, g.ID, num)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return root, err
 }
 
-func (sb *SQLiteBackend) GetThread(g *models.Group, threadNum int) ([]int, error) {
+func (sb *SQLiteBackend) GetThread(ctx context.Context, g *models.Group, threadNum int) ([]int, error) {
+	root, err := sb.threadRoot(ctx, g, threadNum)
+	if err != nil || root == "" {
+		return nil, err
+	}
+
 	var numbers []int
+	return numbers, sb.db.SelectContext(ctx, &numbers, "SELECT atg.article_number FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.group_id = ? AND articles.thread = ? AND atg.article_number != ? ORDER BY articles.created_at, articles.id", g.ID, root, threadNum)
+}
+
+func (sb *SQLiteBackend) GetThreadTree(ctx context.Context, g *models.Group, threadNum int) ([]models.ThreadNode, error) {
+	root, err := sb.threadRoot(ctx, g, threadNum)
+	if err != nil || root == "" {
+		return nil, err
+	}
 
-	return numbers, sb.db.Select(&numbers, "SELECT atg.article_number FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.group_id = ? AND articles.thread = json_extract((SELECT articles.header from articles INNER JOIN articles_to_groups a on articles.id = a.article_id WHERE a.group_id = ? AND a.article_number = ?), '$.Message-Id[0]') ORDER BY articles.created_at", g.ID, g.ID, threadNum)
+	var nodes []models.ThreadNode
+	if err := sb.db.SelectContext(ctx, &nodes, "SELECT atg.article_number, articles.message_id, articles.parent FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.group_id = ? AND (articles.message_id = ? OR articles.thread = ?) ORDER BY articles.created_at, articles.id", g.ID, root, root); err != nil {
+		return nil, err
+	}
+	return utils.BuildThreadTree(nodes, root), nil
+}
+
+func (sb *SQLiteBackend) GetUser(ctx context.Context, username string) (models.User, error) {
+	var user models.User
+	return user, notFound(sb.db.GetContext(ctx, &user, "SELECT * FROM users WHERE username = ?", username), backend.ErrNotFound)
+}
+
+func (sb *SQLiteBackend) SaveUser(ctx context.Context, u models.User) error {
+	_, err := sb.db.ExecContext(ctx, "INSERT INTO users (username, password_hash, scram_salt, scram_iterations, scram_stored_key, scram_server_key) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT(username) DO UPDATE SET password_hash = excluded.password_hash, scram_salt = excluded.scram_salt, scram_iterations = excluded.scram_iterations, scram_stored_key = excluded.scram_stored_key, scram_server_key = excluded.scram_server_key", u.Username, u.PasswordHash, u.ScramSalt, u.ScramIterations, u.ScramStoredKey, u.ScramServerKey)
+	return err
+}
+
+func (sb *SQLiteBackend) ListUsers(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	return users, sb.db.SelectContext(ctx, &users, "SELECT * FROM users ORDER BY username")
+}
+
+func (sb *SQLiteBackend) DeleteUser(ctx context.Context, username string) error {
+	if _, err := sb.db.ExecContext(ctx, "DELETE FROM group_acl WHERE username = ?", username); err != nil {
+		return err
+	}
+	_, err := sb.db.ExecContext(ctx, "DELETE FROM users WHERE username = ?", username)
+	return err
+}
+
+func (sb *SQLiteBackend) GetGroupACL(ctx context.Context, g *models.Group) ([]models.ACLEntry, error) {
+	var entries []models.ACLEntry
+	return entries, sb.db.SelectContext(ctx, &entries, "SELECT * FROM group_acl WHERE group_id = ?", g.ID)
+}
+
+func (sb *SQLiteBackend) SaveACLEntry(ctx context.Context, e models.ACLEntry) error {
+	_, err := sb.db.ExecContext(ctx, "INSERT INTO group_acl (group_id, username, can_read, can_post, can_moderate) VALUES (?, ?, ?, ?, ?) ON CONFLICT(group_id, username) DO UPDATE SET can_read = excluded.can_read, can_post = excluded.can_post, can_moderate = excluded.can_moderate", e.GroupID, e.Username, e.CanRead, e.CanPost, e.CanModerate)
+	return err
+}
+
+func (sb *SQLiteBackend) DeleteACLEntry(ctx context.Context, g *models.Group, username string) error {
+	_, err := sb.db.ExecContext(ctx, "DELETE FROM group_acl WHERE group_id = ? AND username = ?", g.ID, username)
+	return err
+}
+
+func (sb *SQLiteBackend) SavePendingArticle(ctx context.Context, a models.Article, g *models.Group, submitter string) (int, error) {
+	attachments, err := json.Marshal(a.Attachments)
+	if err != nil {
+		return 0, err
+	}
+	res, err := sb.db.ExecContext(ctx, "INSERT INTO pending_articles (group_id, header, body, thread, parent, attachments, submitter) VALUES (?, ?, ?, ?, ?, ?, ?)", g.ID, a.HeaderRaw, a.Body, a.Thread, a.Parent, string(attachments), submitter)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (sb *SQLiteBackend) GetPendingArticles(ctx context.Context, g *models.Group) ([]models.PendingArticle, error) {
+	var articles []models.PendingArticle
+	if err := sb.db.SelectContext(ctx, &articles, "SELECT * FROM pending_articles WHERE group_id = ? ORDER BY id", g.ID); err != nil {
+		return nil, err
+	}
+	for i := range articles {
+		if err := unmarshalPendingArticle(&articles[i]); err != nil {
+			return nil, err
+		}
+	}
+	return articles, nil
+}
+
+func (sb *SQLiteBackend) GetPendingArticle(ctx context.Context, id int) (models.PendingArticle, error) {
+	var a models.PendingArticle
+	if err := sb.db.GetContext(ctx, &a, "SELECT * FROM pending_articles WHERE id = ?", id); err != nil {
+		return a, notFound(err, backend.ErrNotFound)
+	}
+	return a, unmarshalPendingArticle(&a)
+}
+
+func (sb *SQLiteBackend) DeletePendingArticle(ctx context.Context, id int) error {
+	res, err := sb.db.ExecContext(ctx, "DELETE FROM pending_articles WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return backend.ErrNotFound
+	}
+	return nil
+}
+
+func unmarshalPendingArticle(a *models.PendingArticle) error {
+	if err := json.Unmarshal([]byte(a.HeaderRaw), &a.Header); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(a.AttachmentsRaw), &a.Attachments)
+}
+
+func (sb *SQLiteBackend) HasMessageID(ctx context.Context, messageID string) (bool, error) {
+	var exists bool
+	return exists, sb.db.GetContext(ctx, &exists, "SELECT EXISTS(SELECT 1 FROM history WHERE message_id = ?)", messageID)
+}
+
+func (sb *SQLiteBackend) PurgeHistory(ctx context.Context, before time.Time) (int, error) {
+	res, err := sb.db.ExecContext(ctx, "DELETE FROM history WHERE removed_at < datetime(?, 'unixepoch')", before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (sb *SQLiteBackend) GetArticlesSinceID(ctx context.Context, id int, limit int) ([]models.Article, error) {
+	var articles []models.Article
+	if err := sb.db.SelectContext(ctx, &articles, "SELECT * FROM articles WHERE id > ? ORDER BY id LIMIT ?", id, limit); err != nil {
+		return nil, err
+	}
+	for i := range articles {
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+	return articles, nil
+}
+
+func (sb *SQLiteBackend) GetState(ctx context.Context, key string) (string, error) {
+	var value string
+	return value, notFound(sb.db.GetContext(ctx, &value, "SELECT value FROM state WHERE key = ?", key), backend.ErrNotFound)
+}
+
+func (sb *SQLiteBackend) SetState(ctx context.Context, key, value string) error {
+	_, err := sb.db.ExecContext(ctx, "INSERT INTO state (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value", key, value)
+	return err
+}
+
+func (sb *SQLiteBackend) EnqueueFeedArticle(ctx context.Context, peer, messageID string) error {
+	_, err := sb.db.ExecContext(ctx, "INSERT OR IGNORE INTO feed_queue (peer, message_id) VALUES (?, ?)", peer, messageID)
+	return err
+}
+
+func (sb *SQLiteBackend) GetFeedQueue(ctx context.Context, peer string, limit int) ([]models.FeedQueueItem, error) {
+	var items []models.FeedQueueItem
+	return items, sb.db.SelectContext(ctx, &items, "SELECT * FROM feed_queue WHERE peer = ? AND next_attempt_at <= CURRENT_TIMESTAMP ORDER BY created_at LIMIT ?", peer, limit)
+}
+
+func (sb *SQLiteBackend) UpdateFeedQueueItem(ctx context.Context, item models.FeedQueueItem) error {
+	_, err := sb.db.ExecContext(ctx, "UPDATE feed_queue SET attempts = ?, next_attempt_at = datetime(?, 'unixepoch') WHERE peer = ? AND message_id = ?", item.Attempts, item.NextAttemptAt.Unix(), item.Peer, item.MessageID)
+	return err
+}
+
+func (sb *SQLiteBackend) DeleteFeedQueueItem(ctx context.Context, peer, messageID string) error {
+	_, err := sb.db.ExecContext(ctx, "DELETE FROM feed_queue WHERE peer = ? AND message_id = ?", peer, messageID)
+	return err
+}
+
+func (sb *SQLiteBackend) GetGroupArticleInfo(ctx context.Context, g *models.Group) ([]models.ArticleInfo, error) {
+	var info []models.ArticleInfo
+	return info, sb.db.SelectContext(ctx, &info, `SELECT atg.article_number, articles.message_id, articles.created_at,
+		length(articles.header) + length(articles.body) AS size,
+		ifnull(json_extract(articles.header, '$.Expires[0]'), '') AS expires,
+		(SELECT count(*) FROM articles_to_groups a WHERE a.article_id = articles.id) AS groups
+		FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.group_id = ? ORDER BY atg.article_number`, g.ID)
+}
+
+func (sb *SQLiteBackend) DeleteArticle(ctx context.Context, messageID string) error {
+	tx, err := sb.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.GetContext(ctx, &id, "SELECT id FROM articles WHERE message_id = ?", messageID); err != nil {
+		return notFound(err, backend.ErrNoSuchArticle)
+	}
+	for _, q := range []string{
+		"DELETE FROM attachments_articles_mapping WHERE article_id = ?",
+		"DELETE FROM overview WHERE article_id = ?",
+		"DELETE FROM articles_to_groups WHERE article_id = ?",
+		"DELETE FROM articles WHERE id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, q, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO history (message_id, removed_at) VALUES (?, CURRENT_TIMESTAMP)
+		ON CONFLICT (message_id) DO UPDATE SET removed_at = excluded.removed_at`, messageID); err != nil {
+		return err
+	}
+	if err := unindexArticle(ctx, tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (sb *SQLiteBackend) RememberMessageID(ctx context.Context, messageID string) error {
+	_, err := sb.db.ExecContext(ctx, "INSERT INTO history (message_id, removed_at) VALUES (?, CURRENT_TIMESTAMP) ON CONFLICT DO NOTHING", messageID)
+	return err
+}
+
+func (sb *SQLiteBackend) CreateGroup(ctx context.Context, g models.Group) error {
+	_, err := sb.db.ExecContext(ctx, "INSERT INTO groups (group_name, description, moderated, creator) VALUES (?, ?, ?, ?)", g.GroupName, g.Description, g.Moderated, g.Creator)
+	return err
+}
+
+func (sb *SQLiteBackend) UpdateGroup(ctx context.Context, g models.Group) error {
+	_, err := sb.db.ExecContext(ctx, "UPDATE groups SET group_name = ?, description = ?, moderated = ? WHERE id = ?", g.GroupName, g.Description, g.Moderated, g.ID)
+	return err
+}
+
+// DeleteGroup removes the group with everything what belongs to it, articles stay in the other groups they are posted to.
+func (sb *SQLiteBackend) DeleteGroup(ctx context.Context, g *models.Group) error {
+	tx, err := sb.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, q := range []string{
+		"DELETE FROM overview WHERE group_id = ?",
+		"DELETE FROM articles_to_groups WHERE group_id = ?",
+		"DELETE FROM group_acl WHERE group_id = ?",
+		"DELETE FROM pending_articles WHERE group_id = ?",
+		"DELETE FROM groups WHERE id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, q, g.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (sb *SQLiteBackend) GetFeedQueueSize(ctx context.Context, peer string) (int, error) {
+	var count int
+	return count, sb.db.GetContext(ctx, &count, "SELECT count(*) FROM feed_queue WHERE peer = ?", peer)
+}
+
+func (sb *SQLiteBackend) ClearFeedQueue(ctx context.Context, peer string) error {
+	_, err := sb.db.ExecContext(ctx, "DELETE FROM feed_queue WHERE peer = ?", peer)
+	return err
+}
+
+func (sb *SQLiteBackend) ListBans(ctx context.Context) ([]models.Ban, error) {
+	var bans []models.Ban
+	return bans, sb.db.SelectContext(ctx, &bans, "SELECT * FROM bans ORDER BY id")
+}
+
+func (sb *SQLiteBackend) SaveBan(ctx context.Context, b models.Ban) (int, error) {
+	res, err := sb.db.ExecContext(ctx, "INSERT INTO bans (type, value, reason) VALUES (?, ?, ?)", b.Type, b.Value, b.Reason)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (sb *SQLiteBackend) DeleteBan(ctx context.Context, id int) error {
+	res, err := sb.db.ExecContext(ctx, "DELETE FROM bans WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return backend.ErrNotFound
+	}
+	return err
+}
+
+// notFound replaces sql.ErrNoRows with the error the backend interface defines for the missing entity.
+func notFound(err error, notFoundErr error) error {
+	if err == sql.ErrNoRows {
+		return notFoundErr
+	}
+	return err
 }
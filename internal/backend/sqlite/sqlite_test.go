@@ -0,0 +1,21 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/backend/backendtest"
+	"github.com/ChronosX88/yans/internal/config"
+)
+
+func TestConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) backend.StorageBackend {
+		sb, err := NewSQLiteBackend(config.SQLiteBackendConfig{Path: filepath.Join(t.TempDir(), "yans.db")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { sb.db.Close() })
+		return sb
+	})
+}
@@ -1,27 +1,96 @@
 package backend
 
-import "github.com/ChronosX88/yans/internal/models"
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ChronosX88/yans/internal/models"
+)
 
 const (
-	SupportedBackendList = "sqlite"
+	SupportedBackendList = "sqlite, postgres, memory, tradspool"
+)
+
+var (
+	ErrNoSuchGroup   = errors.New("no such newsgroup")
+	ErrNoSuchArticle = errors.New("no such article")
+	ErrDuplicate     = errors.New("duplicate article")
+	// ErrNotFound is returned when the requested user, pending article, state key or ban doesn't exist
+	ErrNotFound = errors.New("not found")
 )
 
+// StorageBackend stores groups, articles and the other data of the server. Lookups of missing groups
+// and articles return ErrNoSuchGroup and ErrNoSuchArticle, the other missing entities ErrNotFound.
+// The context of calls made while serving a client is cancelled when the client disconnects.
 type StorageBackend interface {
-	ListGroups() ([]models.Group, error)
-	ListGroupsByPattern(pattern string) ([]models.Group, error)
-	GetGroup(groupName string) (models.Group, error)
-	GetNewGroupsSince(timestamp int64) ([]models.Group, error)
-	GetArticlesCount(g *models.Group) (int, error)
-	GetGroupLowWaterMark(g *models.Group) (int, error)
-	GetGroupHighWaterMark(g *models.Group) (int, error)
-	SaveArticle(article models.Article, groups []string) error
-	GetArticle(messageID string) (models.Article, error)
-	GetArticleByNumber(g *models.Group, num int) (models.Article, error)
-	GetArticleNumbers(g *models.Group, low, high int64) ([]int64, error)
-	GetNewArticlesSince(timestamp int64) ([]string, error)
-	GetLastArticleByNum(g *models.Group, a *models.Article) (models.Article, error)
-	GetNextArticleByNum(g *models.Group, a *models.Article) (models.Article, error)
-	GetArticlesByRange(g *models.Group, low, high int64) ([]models.Article, error)
-	GetNewThreads(g *models.Group, perPage int, pageNum int) ([]int, error)
-	GetThread(g *models.Group, threadNum int) ([]int, error)
+	ListGroups(ctx context.Context) ([]models.Group, error)
+	ListGroupsByPattern(ctx context.Context, pattern string) ([]models.Group, error)
+	GetGroup(ctx context.Context, groupName string) (models.Group, error)
+	GetNewGroupsSince(ctx context.Context, timestamp int64) ([]models.Group, error)
+	GetArticlesCount(ctx context.Context, g *models.Group) (int, error)
+	GetGroupLowWaterMark(ctx context.Context, g *models.Group) (int, error)
+	GetGroupHighWaterMark(ctx context.Context, g *models.Group) (int, error)
+	// SaveArticle stores the article. When its thread is an article we have, it joins the thread of that one,
+	// and the articles whose thread is the saved article (it has been missing) join its thread.
+	SaveArticle(ctx context.Context, article models.Article, groups []string) error
+	GetArticle(ctx context.Context, messageID string) (models.Article, error)
+	// GetArticleGroups returns the groups the article is filed into, there are none if there is no such article
+	GetArticleGroups(ctx context.Context, messageID string) ([]models.Group, error)
+	GetArticleByNumber(ctx context.Context, g *models.Group, num int) (models.Article, error)
+	GetArticleNumbers(ctx context.Context, g *models.Group, low, high int64) ([]int64, error)
+	GetNewArticlesSince(ctx context.Context, timestamp int64) ([]string, error)
+	GetLastArticleByNum(ctx context.Context, g *models.Group, a *models.Article) (models.Article, error)
+	GetNextArticleByNum(ctx context.Context, g *models.Group, a *models.Article) (models.Article, error)
+	GetArticlesByRange(ctx context.Context, g *models.Group, low, high int64) ([]models.Article, error)
+	// GetOverview passes overview records of the articles numbered from low to high to fn in the order of numbers
+	GetOverview(ctx context.Context, g *models.Group, low, high int64, fn func(o models.Overview) error) error
+	// SearchArticles returns the newest articles of the groups whose subject, sender or body contain all the terms
+	// of the query, at most limit of them. An article is returned once for each of the given groups it is posted to.
+	SearchArticles(ctx context.Context, groups []models.Group, query string, limit int) ([]models.SearchResult, error)
+	// GetNewThreads returns numbers of the roots of threads in the group. A thread whose root we don't have
+	// is represented by its earliest article in the group.
+	GetNewThreads(ctx context.Context, g *models.Group, perPage int, pageNum int, order models.ThreadOrder) ([]int, error)
+	// GetThread returns numbers of the replies in the thread rooted at the article, or of the other articles
+	// of its thread when the root is missing
+	GetThread(ctx context.Context, g *models.Group, threadNum int) ([]int, error)
+	// GetThreadTree returns the thread rooted at the article of the group, or the thread the article belongs to when
+	// its root is missing, ordered with utils.BuildThreadTree. It is empty if there is no such article.
+	GetThreadTree(ctx context.Context, g *models.Group, threadNum int) ([]models.ThreadNode, error)
+	GetUser(ctx context.Context, username string) (models.User, error)
+	SaveUser(ctx context.Context, u models.User) error
+	ListUsers(ctx context.Context) ([]models.User, error)
+	DeleteUser(ctx context.Context, username string) error
+	GetGroupACL(ctx context.Context, g *models.Group) ([]models.ACLEntry, error)
+	SaveACLEntry(ctx context.Context, e models.ACLEntry) error
+	DeleteACLEntry(ctx context.Context, g *models.Group, username string) error
+	SavePendingArticle(ctx context.Context, a models.Article, g *models.Group, submitter string) (int, error)
+	GetPendingArticles(ctx context.Context, g *models.Group) ([]models.PendingArticle, error)
+	GetPendingArticle(ctx context.Context, id int) (models.PendingArticle, error)
+	// DeletePendingArticle returns ErrNotFound if there is no such article, so only one of concurrent callers removes it
+	DeletePendingArticle(ctx context.Context, id int) error
+	// PublishPendingArticle saves the article made of the pending one and removes the pending article only if it
+	// has been saved. It returns ErrNotFound if there is no such pending article, so only one of concurrent callers
+	// publishes it.
+	PublishPendingArticle(ctx context.Context, id int, a models.Article, groups []string) error
+	HasMessageID(ctx context.Context, messageID string) (bool, error)
+	PurgeHistory(ctx context.Context, before time.Time) (int, error)
+	GetGroupArticleInfo(ctx context.Context, g *models.Group) ([]models.ArticleInfo, error)
+	DeleteArticle(ctx context.Context, messageID string) error
+	RememberMessageID(ctx context.Context, messageID string) error
+	CreateGroup(ctx context.Context, g models.Group) error
+	UpdateGroup(ctx context.Context, g models.Group) error
+	DeleteGroup(ctx context.Context, g *models.Group) error
+	GetArticlesSinceID(ctx context.Context, id int, limit int) ([]models.Article, error)
+	GetState(ctx context.Context, key string) (string, error)
+	SetState(ctx context.Context, key, value string) error
+	EnqueueFeedArticle(ctx context.Context, peer, messageID string) error
+	GetFeedQueue(ctx context.Context, peer string, limit int) ([]models.FeedQueueItem, error)
+	UpdateFeedQueueItem(ctx context.Context, item models.FeedQueueItem) error
+	DeleteFeedQueueItem(ctx context.Context, peer, messageID string) error
+	GetFeedQueueSize(ctx context.Context, peer string) (int, error)
+	ClearFeedQueue(ctx context.Context, peer string) error
+	ListBans(ctx context.Context) ([]models.Ban, error)
+	SaveBan(ctx context.Context, b models.Ban) (int, error)
+	DeleteBan(ctx context.Context, id int) error
 }
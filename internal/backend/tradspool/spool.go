@@ -0,0 +1,284 @@
+package tradspool
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/utils"
+)
+
+const (
+	overviewFile = ".overview"
+	historyFile  = "history"
+	activeFile   = "active"
+
+	// headers which keep the data of the article that has no place in the usual headers,
+	// they are stripped when the article is read
+	threadHeader     = "X-Yans-Thread"
+	parentHeader     = "X-Yans-Parent"
+	attachmentHeader = "X-Yans-Attachment"
+)
+
+// groupDir returns the directory of the group, e.g. comp/lang/go for comp.lang.go.
+func groupDir(root, group string) string {
+	return filepath.Join(root, filepath.FromSlash(strings.ReplaceAll(group, ".", "/")))
+}
+
+// writeFile atomically creates the file: the data is written into a temporary file which is synced
+// and renamed, so a crash never leaves a partially written file under the name.
+func writeFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// appendLines appends the lines to the file and syncs it.
+func appendLines(path string, lines []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readLines returns the lines of the file, a missing file has no lines.
+func readLines(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+}
+
+// readActive returns the high water marks kept in the active file by group id.
+func readActive(path string) (map[int]int, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+	active := map[int]int{}
+	for _, v := range lines {
+		fields := strings.Fields(v)
+		if len(fields) != 2 {
+			continue
+		}
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		high, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		active[id] = high
+	}
+	return active, nil
+}
+
+// formatArticle renders the article in the native spool format: header lines, an empty line and the body
+// with LF line endings. Internal headers sent by the client are dropped, so they can't forge the thread
+// or the attachments of the article.
+func formatArticle(a models.Article) []byte {
+	var buf bytes.Buffer
+	keys := make([]string, 0, len(a.Header))
+	for k := range a.Header {
+		switch textproto.CanonicalMIMEHeaderKey(k) {
+		case threadHeader, parentHeader, attachmentHeader:
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range a.Header[k] {
+			fmt.Fprintf(&buf, "%s: %s\n", k, sanitize(v))
+		}
+	}
+	if a.Thread.Valid {
+		fmt.Fprintf(&buf, "%s: %s\n", threadHeader, a.Thread.String)
+	}
+	if a.Parent.Valid {
+		fmt.Fprintf(&buf, "%s: %s\n", parentHeader, a.Parent.String)
+	}
+	for _, v := range a.Attachments {
+		fmt.Fprintf(&buf, "%s: %s %s\n", attachmentHeader, v.ContentType, v.FileName)
+	}
+	buf.WriteString("\n")
+	buf.WriteString(strings.ReplaceAll(a.Body, "\r\n", "\n"))
+	return buf.Bytes()
+}
+
+// parseArticle reads the article file written by formatArticle.
+func parseArticle(r io.Reader) (models.Article, error) {
+	var a models.Article
+	br := bufio.NewReader(r)
+	header, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return a, err
+	}
+
+	if v := header.Get(threadHeader); v != "" {
+		a.Thread.String, a.Thread.Valid = v, true
+	}
+	if v := header.Get(parentHeader); v != "" {
+		a.Parent.String, a.Parent.Valid = v, true
+	}
+	for _, v := range header.Values(attachmentHeader) {
+		fields := strings.SplitN(v, " ", 2)
+		if len(fields) != 2 {
+			return a, fmt.Errorf("malformed %s header: %s", attachmentHeader, v)
+		}
+		a.Attachments = append(a.Attachments, models.Attachment{ContentType: fields[0], FileName: fields[1]})
+	}
+	header.Del(threadHeader)
+	header.Del(parentHeader)
+	header.Del(attachmentHeader)
+	a.Header = header
+	a.MessageID = header.Get("Message-ID")
+
+	body, err := io.ReadAll(br)
+	if err != nil {
+		return a, err
+	}
+	a.Body = string(body)
+	return a, nil
+}
+
+// sanitize replaces characters which would break header and overview lines.
+func sanitize(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(s)
+}
+
+// overviewLine formats the overview record of the article: the fields of OVER command followed by Xref
+// and the extra fields which let the index be rebuilt without reading articles.
+func overviewLine(number int, a models.Article, size int) string {
+	fields := []string{
+		strconv.Itoa(number),
+		sanitize(a.Header.Get("Subject")),
+		sanitize(a.Header.Get("From")),
+		sanitize(a.Header.Get("Date")),
+		sanitize(a.Header.Get("Message-ID")),
+		sanitize(a.Header.Get("References")),
+		strconv.Itoa(size),
+		strconv.Itoa(utils.CountLines(a.Body)),
+		"Xref: " + sanitize(a.Header.Get("Xref")),
+	}
+	if v := a.Header.Get("Expires"); v != "" {
+		fields = append(fields, "Expires: "+sanitize(v))
+	}
+	if a.Thread.Valid {
+		fields = append(fields, threadHeader+": "+sanitize(a.Thread.String))
+	}
+	if a.Parent.Valid {
+		fields = append(fields, parentHeader+": "+sanitize(a.Parent.String))
+	}
+	return strings.Join(fields, "\t")
+}
+
+// parseOverviewFields returns the OVER fields of the overview line.
+func parseOverviewFields(line string) (models.Overview, error) {
+	var o models.Overview
+	fields := strings.Split(line, "\t")
+	if len(fields) < 8 {
+		return o, fmt.Errorf("malformed overview line: %s", line)
+	}
+	var err error
+	if o.Number, err = strconv.Atoi(fields[0]); err != nil {
+		return o, fmt.Errorf("malformed overview line: %s", line)
+	}
+	o.Subject, o.From, o.Date, o.MessageID, o.References = fields[1], fields[2], fields[3], fields[4], fields[5]
+	o.Bytes, _ = strconv.Atoi(fields[6])
+	o.Lines, _ = strconv.Atoi(fields[7])
+	return o, nil
+}
+
+type overviewRecord struct {
+	number    int
+	messageID string
+	size      int
+	expires   string
+	thread    string
+	parent    string
+}
+
+func parseOverviewLine(line string) (overviewRecord, error) {
+	var r overviewRecord
+	fields := strings.Split(line, "\t")
+	if len(fields) < 8 {
+		return r, fmt.Errorf("malformed overview line: %s", line)
+	}
+	var err error
+	if r.number, err = strconv.Atoi(fields[0]); err != nil {
+		return r, fmt.Errorf("malformed overview line: %s", line)
+	}
+	r.messageID = fields[4]
+	r.size, _ = strconv.Atoi(fields[6])
+	for _, v := range fields[8:] {
+		switch {
+		case strings.HasPrefix(v, "Expires: "):
+			r.expires = strings.TrimPrefix(v, "Expires: ")
+		case strings.HasPrefix(v, threadHeader+": "):
+			r.thread = strings.TrimPrefix(v, threadHeader+": ")
+		case strings.HasPrefix(v, parentHeader+": "):
+			r.parent = strings.TrimPrefix(v, parentHeader+": ")
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,31 @@
+package tradspool
+
+import (
+	"bytes"
+	"net/textproto"
+	"testing"
+
+	"github.com/ChronosX88/yans/internal/models"
+)
+
+func TestFormatArticleDropsInternalHeaders(t *testing.T) {
+	a := models.Article{
+		Header: textproto.MIMEHeader{
+			"Message-Id":        {"<a@example.org>"},
+			"X-Yans-Thread":     {"<forged@example.org>"},
+			"x-yans-parent":     {"<forged@example.org>"},
+			"X-Yans-Attachment": {"text/plain ../../etc/passwd"},
+		},
+		Body: "body\n",
+	}
+	parsed, err := parseArticle(bytes.NewReader(formatArticle(a)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Thread.Valid || parsed.Parent.Valid || len(parsed.Attachments) != 0 {
+		t.Errorf("got thread %v, parent %v, attachments %v from client headers", parsed.Thread, parsed.Parent, parsed.Attachments)
+	}
+	if parsed.MessageID != "<a@example.org>" {
+		t.Errorf("got message id %q, want <a@example.org>", parsed.MessageID)
+	}
+}
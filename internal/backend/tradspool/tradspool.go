@@ -0,0 +1,1146 @@
+package tradspool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/backend/sqlite"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/utils"
+)
+
+type link struct {
+	groupID int
+	number  int
+}
+
+// entry is the index record of an article in the spool.
+type entry struct {
+	id        int // arrival time in nanoseconds, it orders articles like ids of the SQL backends
+	messageID string
+	arrived   time.Time
+	size      int
+	expires   string
+	thread    string // the files keep the thread the article had when it was saved, see resolveThreads
+	parent    string
+	links     []link // groups the article is filed into, the file in the first one is the original
+}
+
+// TradspoolBackend stores articles in the spool laid out like INN tradspool: one file per article
+// named group/name/number, crossposts are hard links, and an overview file per group. The index
+// of articles is kept in memory and is rebuilt from the overview files on start, articles missing
+// from the overview (e.g. after a crash) are indexed again. The spool numbers articles itself, the high water
+// marks are kept in the active file once articles are removed. Groups, users, ACLs and the other data
+// which isn't articles are kept in SQLite database.
+type TradspoolBackend struct {
+	*sqlite.SQLiteBackend
+
+	root   string
+	domain string
+
+	mu         sync.RWMutex
+	publishMu  sync.Mutex // serializes publishing of pending articles
+	lastID     int
+	groupNames map[int]string
+	high       map[int]int            // group id -> high water mark, numbers of removed articles aren't given out again
+	articles   map[string]*entry      // by message id
+	numbers    map[int]map[int]*entry // group id -> article number -> entry
+	history    map[string]time.Time   // message id -> time the article has been removed or rejected, or arrived if it is stored
+}
+
+func NewTradspoolBackend(cfg config.TradspoolBackendConfig, domain string) (*TradspoolBackend, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("tradspool path isn't set")
+	}
+	sb, err := sqlite.NewSQLiteBackend(config.SQLiteBackendConfig{Path: cfg.DBPath})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cfg.Path, 0755); err != nil {
+		return nil, err
+	}
+
+	tb := &TradspoolBackend{
+		SQLiteBackend: sb,
+		root:          cfg.Path,
+		domain:        domain,
+		groupNames:    map[int]string{},
+		high:          map[int]int{},
+		articles:      map[string]*entry{},
+		numbers:       map[int]map[int]*entry{},
+		history:       map[string]time.Time{},
+	}
+	if err := tb.load(context.Background()); err != nil {
+		return nil, err
+	}
+	return tb, nil
+}
+
+// load builds the index from the overview files of all groups and reads the history and the high water marks.
+func (tb *TradspoolBackend) load(ctx context.Context) error {
+	active, err := readActive(filepath.Join(tb.root, activeFile))
+	if err != nil {
+		return err
+	}
+	groups, err := tb.SQLiteBackend.ListGroups(ctx)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		tb.groupNames[g.ID] = g.GroupName
+		if err := tb.loadGroup(g); err != nil {
+			return fmt.Errorf("failed to load spool of %s: %w", g.GroupName, err)
+		}
+		// the database keeps the high water marks the spool had before it numbered articles itself
+		high := g.HighWaterMark
+		if active[g.ID] > high {
+			high = active[g.ID]
+		}
+		for n := range tb.numbers[g.ID] {
+			if n > high {
+				high = n
+			}
+		}
+		tb.high[g.ID] = high
+	}
+
+	// ids are assigned in the order of arrival, so articles with the same modification time still get distinct ones
+	var entries []*entry
+	for _, v := range tb.articles {
+		entries = append(entries, v)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].arrived.Equal(entries[j].arrived) {
+			return entries[i].messageID < entries[j].messageID
+		}
+		return entries[i].arrived.Before(entries[j].arrived)
+	})
+	for _, v := range entries {
+		v.id = tb.nextID(v.arrived)
+	}
+	tb.resolveThreads()
+
+	lines, err := readLines(filepath.Join(tb.root, historyFile))
+	if err != nil {
+		return err
+	}
+	for _, v := range lines {
+		fields := strings.Split(v, "\t")
+		if len(fields) != 2 {
+			continue
+		}
+		ts, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		tb.history[fields[0]] = time.Unix(ts, 0)
+	}
+	return nil
+}
+
+func (tb *TradspoolBackend) loadGroup(g models.Group) error {
+	dir := groupDir(tb.root, g.GroupName)
+	lines, err := readLines(filepath.Join(dir, overviewFile))
+	if err != nil {
+		return err
+	}
+	files := map[int]bool{}
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, v := range dirEntries {
+		if n, err := strconv.Atoi(v.Name()); err == nil && !v.IsDir() {
+			files[n] = true
+		}
+	}
+
+	records := map[int]overviewRecord{}
+	var valid []string
+	changed := false
+	for _, v := range lines {
+		r, err := parseOverviewLine(v)
+		if err != nil || !files[r.number] {
+			// the article has been removed, but the overview hasn't been rewritten
+			changed = true
+			continue
+		}
+		records[r.number] = r
+		valid = append(valid, v)
+	}
+	for n := range files {
+		if _, ok := records[n]; ok {
+			continue
+		}
+		// the article has been written, but its overview line hasn't
+		log.Printf("tradspool: indexing %s/%d missing from the overview", g.GroupName, n)
+		path := filepath.Join(dir, strconv.Itoa(n))
+		a, size, err := readArticleFile(path)
+		if err != nil {
+			return err
+		}
+		line := overviewLine(n, a, size)
+		r, _ := parseOverviewLine(line)
+		records[n] = r
+		valid = append(valid, line)
+		changed = true
+	}
+	if changed {
+		sort.Slice(valid, func(i, j int) bool {
+			return overviewNumber(valid[i]) < overviewNumber(valid[j])
+		})
+		if err := writeOverview(dir, valid); err != nil {
+			return err
+		}
+	}
+
+	for n, r := range records {
+		e, ok := tb.articles[r.messageID]
+		if !ok {
+			fi, err := os.Stat(filepath.Join(dir, strconv.Itoa(n)))
+			if err != nil {
+				return err
+			}
+			e = &entry{
+				messageID: r.messageID,
+				arrived:   fi.ModTime(),
+				size:      r.size,
+				expires:   r.expires,
+				thread:    r.thread,
+				parent:    r.parent,
+			}
+			tb.articles[r.messageID] = e
+		}
+		tb.addLink(e, link{groupID: g.ID, number: n})
+	}
+	return nil
+}
+
+// resolveThreads moves the articles whose thread root has arrived after them into the thread of the root.
+func (tb *TradspoolBackend) resolveThreads() {
+	for _, e := range tb.articles {
+		seen := map[string]bool{}
+		for e.thread != "" && !seen[e.thread] {
+			seen[e.thread] = true
+			root, ok := tb.articles[e.thread]
+			if !ok || root.thread == "" {
+				break
+			}
+			e.thread = root.thread
+		}
+	}
+}
+
+func overviewNumber(line string) int {
+	n, _ := strconv.Atoi(strings.SplitN(line, "\t", 2)[0])
+	return n
+}
+
+func writeOverview(dir string, lines []string) error {
+	data := ""
+	if len(lines) != 0 {
+		data = strings.Join(lines, "\n") + "\n"
+	}
+	return writeFile(filepath.Join(dir, overviewFile), []byte(data))
+}
+
+func readArticleFile(path string) (models.Article, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return models.Article{}, 0, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return models.Article{}, 0, err
+	}
+	a, err := parseArticle(f)
+	return a, int(fi.Size()), err
+}
+
+func (tb *TradspoolBackend) addLink(e *entry, l link) {
+	e.links = append(e.links, l)
+	if tb.numbers[l.groupID] == nil {
+		tb.numbers[l.groupID] = map[int]*entry{}
+	}
+	tb.numbers[l.groupID][l.number] = e
+}
+
+// nextID returns an article id based on the time, which is greater than all ids given out before.
+func (tb *TradspoolBackend) nextID(t time.Time) int {
+	id := int(t.UnixNano())
+	if id <= tb.lastID {
+		id = tb.lastID + 1
+	}
+	tb.lastID = id
+	return id
+}
+
+func (tb *TradspoolBackend) articlePath(l link) string {
+	return filepath.Join(groupDir(tb.root, tb.groupNames[l.groupID]), strconv.Itoa(l.number))
+}
+
+// readArticle reads the article file, the article gets its number in the group,
+// or no number when groupID is zero.
+func (tb *TradspoolBackend) readArticle(e *entry, groupID int) (models.Article, error) {
+	if len(e.links) == 0 {
+		return models.Article{}, backend.ErrNoSuchArticle
+	}
+	l := e.links[0]
+	for _, v := range e.links {
+		if v.groupID == groupID {
+			l = v
+			break
+		}
+	}
+
+	a, _, err := readArticleFile(tb.articlePath(l))
+	if err != nil {
+		return a, err
+	}
+	headerJson, err := json.Marshal(a.Header)
+	if err != nil {
+		return a, err
+	}
+	a.HeaderRaw = string(headerJson)
+	a.ID = e.id
+	a.CreatedAt = e.arrived
+	a.Thread.String, a.Thread.Valid = e.thread, e.thread != ""
+	if groupID != 0 {
+		a.ArticleNumber = l.number
+	}
+	return a, nil
+}
+
+func (tb *TradspoolBackend) GetArticlesCount(ctx context.Context, g *models.Group) (int, error) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	return len(tb.numbers[g.ID]), nil
+}
+
+// withHighWaterMarks sets the high water marks of the groups read from the database, the spool numbers articles itself.
+func (tb *TradspoolBackend) withHighWaterMarks(groups ...models.Group) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	for i := range groups {
+		groups[i].HighWaterMark = tb.high[groups[i].ID]
+	}
+}
+
+func (tb *TradspoolBackend) ListGroups(ctx context.Context) ([]models.Group, error) {
+	groups, err := tb.SQLiteBackend.ListGroups(ctx)
+	tb.withHighWaterMarks(groups...)
+	return groups, err
+}
+
+func (tb *TradspoolBackend) ListGroupsByPattern(ctx context.Context, pattern string) ([]models.Group, error) {
+	groups, err := tb.SQLiteBackend.ListGroupsByPattern(ctx, pattern)
+	tb.withHighWaterMarks(groups...)
+	return groups, err
+}
+
+func (tb *TradspoolBackend) GetNewGroupsSince(ctx context.Context, timestamp int64) ([]models.Group, error) {
+	groups, err := tb.SQLiteBackend.GetNewGroupsSince(ctx, timestamp)
+	tb.withHighWaterMarks(groups...)
+	return groups, err
+}
+
+func (tb *TradspoolBackend) GetGroup(ctx context.Context, groupName string) (models.Group, error) {
+	g, err := tb.SQLiteBackend.GetGroup(ctx, groupName)
+	if err != nil {
+		return g, err
+	}
+	groups := []models.Group{g}
+	tb.withHighWaterMarks(groups...)
+	return groups[0], nil
+}
+
+func (tb *TradspoolBackend) GetGroupHighWaterMark(ctx context.Context, g *models.Group) (int, error) {
+	// the database tells only whether the group exists
+	if _, err := tb.SQLiteBackend.GetGroupHighWaterMark(ctx, g); err != nil {
+		return 0, err
+	}
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	return tb.high[g.ID], nil
+}
+
+func (tb *TradspoolBackend) GetGroupLowWaterMark(ctx context.Context, g *models.Group) (int, error) {
+	if _, err := tb.SQLiteBackend.GetGroupHighWaterMark(ctx, g); err != nil {
+		return 0, err
+	}
+
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	low := tb.high[g.ID] + 1
+	for n := range tb.numbers[g.ID] {
+		if n < low {
+			low = n
+		}
+	}
+	return low, nil
+}
+
+func (tb *TradspoolBackend) SaveArticle(ctx context.Context, a models.Article, groups []string) error {
+	// the header is stored as the SQL backends get it, with Xref header added
+	header := textproto.MIMEHeader{}
+	if err := json.Unmarshal([]byte(a.HeaderRaw), &header); err != nil {
+		return err
+	}
+	a.Header = header
+
+	links, paths, err := tb.numberArticle(ctx, header, groups)
+	if err != nil {
+		return err
+	}
+
+	// the files are written and synced without the lock, the article can't be read until it is indexed
+	data := formatArticle(a)
+	err = writeFiles(paths, data)
+	if err == nil {
+		tb.mu.Lock()
+		err = tb.indexArticle(a, links, paths, len(data))
+		tb.mu.Unlock()
+	}
+	if err != nil {
+		// no file of the article is kept, stale overview lines are dropped when the spool is loaded
+		for _, v := range paths {
+			os.Remove(v)
+		}
+		return err
+	}
+	return nil
+}
+
+// numberArticle gives the article the next number in each of its groups and sets its Xref header,
+// it returns the links of the article and the paths of its files.
+func (tb *TradspoolBackend) numberArticle(ctx context.Context, header textproto.MIMEHeader, groups []string) ([]link, []string, error) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	// the groups are looked up under the lock, so they can't be renamed or deleted while the numbers are given out
+	var gs []models.Group
+	for _, v := range groups {
+		g, err := tb.SQLiteBackend.GetGroup(ctx, strings.TrimSpace(v))
+		if err != nil {
+			return nil, nil, err
+		}
+		gs = append(gs, g)
+	}
+	if len(gs) == 0 {
+		return nil, nil, backend.ErrNoSuchGroup
+	}
+	if tb.isKnown(header.Get("Message-ID")) {
+		return nil, nil, backend.ErrDuplicate
+	}
+
+	var links []link
+	var paths []string
+	xref := []string{tb.domain}
+	for _, g := range gs {
+		tb.high[g.ID]++
+		l := link{groupID: g.ID, number: tb.high[g.ID]}
+		tb.groupNames[g.ID] = g.GroupName
+		links = append(links, l)
+		paths = append(paths, tb.articlePath(l))
+		xref = append(xref, fmt.Sprintf("%s:%d", g.GroupName, l.number))
+	}
+	header.Set("Xref", strings.Join(xref, " "))
+	return links, paths, nil
+}
+
+// isKnown reports whether the message id belongs to a stored article or is in the history.
+func (tb *TradspoolBackend) isKnown(messageID string) bool {
+	if _, ok := tb.articles[messageID]; ok {
+		return true
+	}
+	_, ok := tb.history[messageID]
+	return ok
+}
+
+// writeFiles writes the article file into its first group and links it into the others.
+func writeFiles(paths []string, data []byte) error {
+	if err := writeFile(paths[0], data); err != nil {
+		return err
+	}
+	for _, v := range paths[1:] {
+		if err := linkFile(paths[0], v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexArticle adds the written article into the overview files, the history and the index. The groups
+// may have been renamed or deleted and the same article may have been saved while the files were written,
+// the paths are updated when the files are moved.
+func (tb *TradspoolBackend) indexArticle(a models.Article, links []link, paths []string, size int) error {
+	messageID := a.Header.Get("Message-ID")
+	if tb.isKnown(messageID) {
+		return backend.ErrDuplicate
+	}
+	for i, v := range links {
+		if _, ok := tb.high[v.groupID]; !ok {
+			return backend.ErrNoSuchGroup
+		}
+		// the articles of the renamed group have been moved without this one
+		if path := tb.articlePath(v); path != paths[i] {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			if err := os.Rename(paths[i], path); err != nil {
+				return err
+			}
+			// the directory stays if it holds subgroups
+			os.Remove(filepath.Dir(paths[i]))
+			paths[i] = path
+		}
+	}
+	if a.Thread.Valid {
+		// the thread of the article may have got its own root since the article was made, e.g. while it was pending
+		if root, ok := tb.articles[a.Thread.String]; ok && root.thread != "" {
+			a.Thread.String = root.thread
+		}
+	}
+
+	for _, v := range links {
+		dir := groupDir(tb.root, tb.groupNames[v.groupID])
+		if err := appendLines(filepath.Join(dir, overviewFile), []string{overviewLine(v.number, a, size)}); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	if err := tb.remember(messageID, now); err != nil {
+		return err
+	}
+
+	e := &entry{
+		id:        tb.nextID(now),
+		messageID: messageID,
+		arrived:   now,
+		size:      size,
+		expires:   a.Header.Get("Expires"),
+		thread:    a.Thread.String,
+		parent:    a.Parent.String,
+	}
+	tb.articles[messageID] = e
+	for _, v := range links {
+		tb.addLink(e, v)
+	}
+	if a.Thread.Valid {
+		// replies which arrived before the article had it as their thread root
+		for _, v := range tb.articles {
+			if v.thread == messageID {
+				v.thread = a.Thread.String
+			}
+		}
+	}
+	return nil
+}
+
+// PublishPendingArticle saves the article into the spool and then removes the pending article from the database.
+// They can't share a transaction, so publishing is serialized to keep a pending article from being published twice.
+func (tb *TradspoolBackend) PublishPendingArticle(ctx context.Context, id int, a models.Article, groups []string) error {
+	tb.publishMu.Lock()
+	defer tb.publishMu.Unlock()
+	if _, err := tb.GetPendingArticle(ctx, id); err != nil {
+		return err
+	}
+	if err := tb.SaveArticle(ctx, a, groups); err != nil {
+		return err
+	}
+	return tb.DeletePendingArticle(ctx, id)
+}
+
+// linkFile hard links the crossposted article into another group, or writes a copy if linking fails
+// (e.g. the groups are on different file systems).
+func linkFile(original, path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.Link(original, path); err == nil {
+		return syncDir(filepath.Dir(path))
+	}
+	return writeFile(path, data)
+}
+
+func (tb *TradspoolBackend) GetArticle(ctx context.Context, messageID string) (models.Article, error) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	e, ok := tb.articles[messageID]
+	if !ok {
+		return models.Article{}, backend.ErrNoSuchArticle
+	}
+	a, err := tb.readArticle(e, 0)
+	if err != nil {
+		return a, err
+	}
+	a.ArticleNumber = e.links[0].number
+	return a, nil
+}
+
+func (tb *TradspoolBackend) GetArticleGroups(ctx context.Context, messageID string) ([]models.Group, error) {
+	tb.mu.RLock()
+	var names []string
+	if e, ok := tb.articles[messageID]; ok {
+		for _, v := range e.links {
+			names = append(names, tb.groupNames[v.groupID])
+		}
+	}
+	tb.mu.RUnlock()
+
+	var groups []models.Group
+	for _, v := range names {
+		g, err := tb.GetGroup(ctx, v)
+		if err != nil {
+			if err == backend.ErrNoSuchGroup {
+				continue
+			}
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups, nil
+}
+
+func (tb *TradspoolBackend) GetArticleByNumber(ctx context.Context, g *models.Group, num int) (models.Article, error) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	e, ok := tb.numbers[g.ID][num]
+	if !ok {
+		return models.Article{}, backend.ErrNoSuchArticle
+	}
+	return tb.readArticle(e, g.ID)
+}
+
+// sortedNumbers returns the article numbers of the group in ascending order.
+func (tb *TradspoolBackend) sortedNumbers(groupID int) []int {
+	var numbers []int
+	for n := range tb.numbers[groupID] {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+func (tb *TradspoolBackend) GetArticleNumbers(ctx context.Context, g *models.Group, low, high int64) ([]int64, error) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+
+	var match func(num int64) bool
+	if high == 0 && low == 0 {
+		match = func(num int64) bool { return true }
+	} else if low == -1 && high != 0 {
+		match = func(num int64) bool { return num == high }
+	} else if low != 0 && high == -1 {
+		match = func(num int64) bool { return num > low }
+	} else if low == -1 && high == -1 {
+		return nil, nil
+	} else {
+		match = func(num int64) bool { return num > low && num < high }
+	}
+
+	var numbers []int64
+	for _, v := range tb.sortedNumbers(g.ID) {
+		if match(int64(v)) {
+			numbers = append(numbers, int64(v))
+		}
+	}
+	return numbers, nil
+}
+
+// sortedEntries returns the articles matching the filter in the order of arrival.
+func (tb *TradspoolBackend) sortedEntries(filter func(e *entry) bool) []*entry {
+	var entries []*entry
+	for _, v := range tb.articles {
+		if filter(v) {
+			entries = append(entries, v)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].id < entries[j].id
+	})
+	return entries
+}
+
+func (tb *TradspoolBackend) GetNewArticlesSince(ctx context.Context, timestamp int64) ([]string, error) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	var messageIDs []string
+	for _, v := range tb.sortedEntries(func(e *entry) bool { return e.arrived.Unix() > timestamp }) {
+		messageIDs = append(messageIDs, v.messageID)
+	}
+	return messageIDs, nil
+}
+
+func (tb *TradspoolBackend) GetLastArticleByNum(ctx context.Context, g *models.Group, a *models.Article) (models.Article, error) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	numbers := tb.sortedNumbers(g.ID)
+	for i := len(numbers) - 1; i >= 0; i-- {
+		if numbers[i] < a.ArticleNumber {
+			return tb.readArticle(tb.numbers[g.ID][numbers[i]], g.ID)
+		}
+	}
+	return models.Article{}, backend.ErrNoSuchArticle
+}
+
+func (tb *TradspoolBackend) GetNextArticleByNum(ctx context.Context, g *models.Group, a *models.Article) (models.Article, error) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	for _, v := range tb.sortedNumbers(g.ID) {
+		if v > a.ArticleNumber {
+			return tb.readArticle(tb.numbers[g.ID][v], g.ID)
+		}
+	}
+	return models.Article{}, backend.ErrNoSuchArticle
+}
+
+func (tb *TradspoolBackend) GetArticlesByRange(ctx context.Context, g *models.Group, low, high int64) ([]models.Article, error) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	var articles []models.Article
+	for _, v := range tb.sortedNumbers(g.ID) {
+		if int64(v) < low || int64(v) > high {
+			continue
+		}
+		a, err := tb.readArticle(tb.numbers[g.ID][v], g.ID)
+		if err != nil {
+			return nil, err
+		}
+		articles = append(articles, a)
+	}
+	return articles, nil
+}
+
+// SearchArticles reads the articles of the groups from the newest one, the spool has no search index.
+func (tb *TradspoolBackend) SearchArticles(ctx context.Context, groups []models.Group, query string, limit int) ([]models.SearchResult, error) {
+	terms := utils.SearchTerms(query)
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+
+	searched := map[int]bool{}
+	var entries []*entry
+	for _, g := range groups {
+		searched[g.ID] = true
+		for _, e := range tb.numbers[g.ID] {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].id > entries[j].id
+	})
+
+	var results []models.SearchResult
+	for i, e := range entries {
+		if len(results) >= limit {
+			break
+		}
+		// an article filed into several of the groups appears several times in a row
+		if i > 0 && entries[i-1] == e {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		a, err := tb.readArticle(e, e.links[0].groupID)
+		if err != nil {
+			return nil, err
+		}
+		if !utils.MatchesSearch(a.Header.Get("Subject"), a.Header.Get("From"), a.Body, terms) {
+			continue
+		}
+		for _, v := range e.links {
+			if searched[v.groupID] && len(results) < limit {
+				results = append(results, models.SearchResult{MessageID: e.messageID, GroupName: tb.groupNames[v.groupID], ArticleNumber: v.number})
+			}
+		}
+	}
+	return results, nil
+}
+
+// GetOverview reads the records from the overview file of the group, the articles themselves aren't opened.
+func (tb *TradspoolBackend) GetOverview(ctx context.Context, g *models.Group, low, high int64, fn func(o models.Overview) error) error {
+	tb.mu.RLock()
+	lines, err := readLines(filepath.Join(groupDir(tb.root, g.GroupName), overviewFile))
+	var records []models.Overview
+	for _, v := range lines {
+		o, err := parseOverviewFields(v)
+		if err != nil || int64(o.Number) < low || int64(o.Number) > high {
+			continue
+		}
+		if _, ok := tb.numbers[g.ID][o.Number]; ok {
+			records = append(records, o)
+		}
+	}
+	tb.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	// lines are appended in the order of arrival, which may differ from the order of numbers
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Number < records[j].Number
+	})
+	for _, v := range records {
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func numberIn(e *entry, groupID int) int {
+	for _, v := range e.links {
+		if v.groupID == groupID {
+			return v.number
+		}
+	}
+	return 0
+}
+
+// groupEntries returns the articles of the group in the order of arrival.
+func (tb *TradspoolBackend) groupEntries(groupID int) []*entry {
+	var entries []*entry
+	for _, v := range tb.numbers[groupID] {
+		entries = append(entries, v)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].id < entries[j].id
+	})
+	return entries
+}
+
+func (tb *TradspoolBackend) GetNewThreads(ctx context.Context, g *models.Group, perPage int, pageNum int, order models.ThreadOrder) ([]int, error) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+
+	lastReply := map[string]int{} // thread -> id of its latest reply in the group
+	orphaned := map[string]bool{} // threads with missing roots whose earliest article has been found
+	var heads []*entry
+	for _, v := range tb.groupEntries(g.ID) {
+		if v.thread == "" {
+			heads = append(heads, v)
+			continue
+		}
+		if _, ok := tb.articles[v.thread]; !ok && !orphaned[v.thread] {
+			orphaned[v.thread] = true
+			heads = append(heads, v)
+		}
+		if v.id > lastReply[v.thread] {
+			lastReply[v.thread] = v.id
+		}
+	}
+	// the newest threads first
+	for i, j := 0, len(heads)-1; i < j; i, j = i+1, j-1 {
+		heads[i], heads[j] = heads[j], heads[i]
+	}
+	if order == models.ThreadOrderLastReply {
+		activity := func(e *entry) int {
+			thread := e.thread
+			if thread == "" {
+				thread = e.messageID
+			}
+			if id, ok := lastReply[thread]; ok {
+				return id
+			}
+			return e.id
+		}
+		sort.SliceStable(heads, func(i, j int) bool {
+			return activity(heads[i]) > activity(heads[j])
+		})
+	}
+
+	var numbers []int
+	for _, v := range heads {
+		numbers = append(numbers, numberIn(v, g.ID))
+	}
+
+	offset := perPage * pageNum
+	if offset >= len(numbers) {
+		return nil, nil
+	}
+	numbers = numbers[offset:]
+	if len(numbers) > perPage {
+		numbers = numbers[:perPage]
+	}
+	return numbers, nil
+}
+
+// threadRoot returns the message id of the article with the number, or its thread if the root of the thread
+// is missing. The string is empty if there is no such article.
+func (tb *TradspoolBackend) threadRoot(g *models.Group, num int) string {
+	e, ok := tb.numbers[g.ID][num]
+	if !ok {
+		return ""
+	}
+	if e.thread != "" {
+		if _, ok := tb.articles[e.thread]; !ok {
+			return e.thread
+		}
+	}
+	return e.messageID
+}
+
+func (tb *TradspoolBackend) GetThread(ctx context.Context, g *models.Group, threadNum int) ([]int, error) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	root := tb.threadRoot(g, threadNum)
+	if root == "" {
+		return nil, nil
+	}
+
+	var numbers []int
+	for _, v := range tb.groupEntries(g.ID) {
+		if n := numberIn(v, g.ID); v.thread == root && n != threadNum {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers, nil
+}
+
+func (tb *TradspoolBackend) GetThreadTree(ctx context.Context, g *models.Group, threadNum int) ([]models.ThreadNode, error) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	root := tb.threadRoot(g, threadNum)
+	if root == "" {
+		return nil, nil
+	}
+
+	var nodes []models.ThreadNode
+	for _, v := range tb.groupEntries(g.ID) {
+		if v.messageID == root || v.thread == root {
+			n := models.ThreadNode{Number: numberIn(v, g.ID), MessageID: v.messageID}
+			n.ParentID.String, n.ParentID.Valid = v.parent, v.parent != ""
+			nodes = append(nodes, n)
+		}
+	}
+	return utils.BuildThreadTree(nodes, root), nil
+}
+
+func (tb *TradspoolBackend) GetGroupArticleInfo(ctx context.Context, g *models.Group) ([]models.ArticleInfo, error) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	var info []models.ArticleInfo
+	for _, n := range tb.sortedNumbers(g.ID) {
+		e := tb.numbers[g.ID][n]
+		info = append(info, models.ArticleInfo{
+			Number:    n,
+			MessageID: e.messageID,
+			CreatedAt: e.arrived,
+			Size:      e.size,
+			Expires:   e.expires,
+			Groups:    len(e.links),
+		})
+	}
+	return info, nil
+}
+
+func (tb *TradspoolBackend) GetArticlesSinceID(ctx context.Context, id int, limit int) ([]models.Article, error) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	entries := tb.sortedEntries(func(e *entry) bool { return e.id > id && len(e.links) != 0 })
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	var articles []models.Article
+	for _, v := range entries {
+		a, err := tb.readArticle(v, 0)
+		if err != nil {
+			return nil, err
+		}
+		articles = append(articles, a)
+	}
+	return articles, nil
+}
+
+// removeLinks removes the files of the article in the groups and their overview lines.
+func (tb *TradspoolBackend) removeLinks(e *entry, keep func(l link) bool) error {
+	var links []link
+	for _, v := range e.links {
+		if keep(v) {
+			links = append(links, v)
+			continue
+		}
+		if err := os.Remove(tb.articlePath(v)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := tb.removeOverviewLine(v); err != nil {
+			return err
+		}
+		delete(tb.numbers[v.groupID], v.number)
+	}
+	e.links = links
+	return nil
+}
+
+func (tb *TradspoolBackend) removeOverviewLine(l link) error {
+	dir := groupDir(tb.root, tb.groupNames[l.groupID])
+	lines, err := readLines(filepath.Join(dir, overviewFile))
+	if err != nil {
+		return err
+	}
+	var kept []string
+	for _, v := range lines {
+		if overviewNumber(v) != l.number {
+			kept = append(kept, v)
+		}
+	}
+	return writeOverview(dir, kept)
+}
+
+func (tb *TradspoolBackend) DeleteArticle(ctx context.Context, messageID string) error {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	e, ok := tb.articles[messageID]
+	if !ok {
+		return backend.ErrNoSuchArticle
+	}
+	if err := tb.removeLinks(e, func(l link) bool { return false }); err != nil {
+		return err
+	}
+	delete(tb.articles, messageID)
+	if err := tb.saveActive(); err != nil {
+		return err
+	}
+	return tb.remember(messageID, time.Now())
+}
+
+// saveActive writes the high water marks into the active file. They are needed once the last articles
+// of a group are removed, until then the numbers of the articles in the spool give them.
+func (tb *TradspoolBackend) saveActive() error {
+	var ids []int
+	for k := range tb.high {
+		ids = append(ids, k)
+	}
+	sort.Ints(ids)
+	var lines []string
+	for _, v := range ids {
+		lines = append(lines, fmt.Sprintf("%d %d", v, tb.high[v]))
+	}
+	return writeFile(filepath.Join(tb.root, activeFile), []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+// UpdateGroup moves the articles of the renamed group into its new directory,
+// Xref headers of the articles keep the old name.
+func (tb *TradspoolBackend) UpdateGroup(ctx context.Context, g models.Group) error {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	old, ok := tb.groupNames[g.ID]
+	if ok && old != g.GroupName {
+		oldDir, newDir := groupDir(tb.root, old), groupDir(tb.root, g.GroupName)
+		if err := os.MkdirAll(newDir, 0755); err != nil {
+			return err
+		}
+		names := []string{overviewFile}
+		for n := range tb.numbers[g.ID] {
+			names = append(names, strconv.Itoa(n))
+		}
+		for _, v := range names {
+			if err := os.Rename(filepath.Join(oldDir, v), filepath.Join(newDir, v)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		// the directory stays if it holds subgroups
+		os.Remove(oldDir)
+	}
+
+	if err := tb.SQLiteBackend.UpdateGroup(ctx, g); err != nil {
+		return err
+	}
+	tb.groupNames[g.ID] = g.GroupName
+	return nil
+}
+
+// DeleteGroup removes the articles of the group from the spool, articles stay in the other groups they are posted to.
+func (tb *TradspoolBackend) DeleteGroup(ctx context.Context, g *models.Group) error {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if _, ok := tb.groupNames[g.ID]; ok {
+		for _, e := range tb.numbers[g.ID] {
+			if err := tb.removeLinks(e, func(l link) bool { return l.groupID != g.ID }); err != nil {
+				return err
+			}
+			if len(e.links) == 0 {
+				delete(tb.articles, e.messageID)
+			}
+		}
+		dir := groupDir(tb.root, g.GroupName)
+		if err := os.Remove(filepath.Join(dir, overviewFile)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		// the directory stays if it holds subgroups
+		os.Remove(dir)
+		delete(tb.numbers, g.ID)
+		delete(tb.groupNames, g.ID)
+	}
+	delete(tb.high, g.ID)
+
+	return tb.SQLiteBackend.DeleteGroup(ctx, g)
+}
+
+// remember adds the message id into the history file, the last entry of the message id holds its current time.
+func (tb *TradspoolBackend) remember(messageID string, t time.Time) error {
+	if err := appendLines(filepath.Join(tb.root, historyFile), []string{fmt.Sprintf("%s\t%d", messageID, t.Unix())}); err != nil {
+		return err
+	}
+	tb.history[messageID] = t
+	return nil
+}
+
+func (tb *TradspoolBackend) HasMessageID(ctx context.Context, messageID string) (bool, error) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	return tb.isKnown(messageID), nil
+}
+
+func (tb *TradspoolBackend) RememberMessageID(ctx context.Context, messageID string) error {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if _, ok := tb.history[messageID]; ok {
+		return nil
+	}
+	return tb.remember(messageID, time.Now())
+}
+
+func (tb *TradspoolBackend) PurgeHistory(ctx context.Context, before time.Time) (int, error) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	n := 0
+	var lines []string
+	for k, v := range tb.history {
+		if _, ok := tb.articles[k]; !ok && v.Before(before) {
+			delete(tb.history, k)
+			n++
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%d", k, v.Unix()))
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	sort.Strings(lines)
+	data := ""
+	if len(lines) != 0 {
+		data = strings.Join(lines, "\n") + "\n"
+	}
+	return n, writeFile(filepath.Join(tb.root, historyFile), []byte(data))
+}
@@ -0,0 +1,154 @@
+package tradspool
+
+import (
+	"context"
+	"encoding/json"
+	"net/textproto"
+	"path/filepath"
+	"testing"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/backend/backendtest"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/models"
+)
+
+func newBackend(t *testing.T, dir string) *TradspoolBackend {
+	t.Helper()
+	tb, err := NewTradspoolBackend(config.TradspoolBackendConfig{
+		Path:   filepath.Join(dir, "spool"),
+		DBPath: filepath.Join(dir, "yans.db"),
+	}, "example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tb
+}
+
+func TestConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) backend.StorageBackend {
+		return newBackend(t, t.TempDir())
+	})
+}
+
+func saveArticle(t *testing.T, tb *TradspoolBackend, messageID, group string) {
+	t.Helper()
+	header := textproto.MIMEHeader{}
+	header.Set("Message-ID", messageID)
+	header.Set("Subject", messageID)
+	headerJson, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tb.SaveArticle(context.Background(), models.Article{HeaderRaw: string(headerJson), Body: "body\n"}, []string{group}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHighWaterMarkAfterReload(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	tb := newBackend(t, dir)
+	if err := tb.CreateGroup(ctx, models.Group{GroupName: "test.group"}); err != nil {
+		t.Fatal(err)
+	}
+	saveArticle(t, tb, "<1@example.org>", "test.group")
+	saveArticle(t, tb, "<2@example.org>", "test.group")
+	if err := tb.DeleteArticle(ctx, "<2@example.org>"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the number of the removed article isn't given out again once the spool is loaded anew
+	tb = newBackend(t, dir)
+	g, err := tb.GetGroup(ctx, "test.group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.HighWaterMark != 2 {
+		t.Errorf("got high water mark %d, want 2", g.HighWaterMark)
+	}
+	saveArticle(t, tb, "<3@example.org>", "test.group")
+	numbers, err := tb.GetArticleNumbers(ctx, &g, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(numbers) != 2 || numbers[0] != 1 || numbers[1] != 3 {
+		t.Errorf("got numbers %v, want [1 3]", numbers)
+	}
+}
+
+func TestSaveArticleConcurrently(t *testing.T) {
+	ctx := context.Background()
+	tb := newBackend(t, t.TempDir())
+	if err := tb.CreateGroup(ctx, models.Group{GroupName: "test.group"}); err != nil {
+		t.Fatal(err)
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Message-ID", "<1@example.org>")
+	headerJson, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			errs <- tb.SaveArticle(ctx, models.Article{HeaderRaw: string(headerJson), Body: "body\n"}, []string{"test.group"})
+		}()
+	}
+	saved := 0
+	for i := 0; i < 8; i++ {
+		if err := <-errs; err == nil {
+			saved++
+		} else if err != backend.ErrDuplicate {
+			t.Fatal(err)
+		}
+	}
+	if saved != 1 {
+		t.Errorf("the article has been saved %d times", saved)
+	}
+}
+
+func TestSaveArticleIntoRenamedGroup(t *testing.T) {
+	ctx := context.Background()
+	tb := newBackend(t, t.TempDir())
+	if err := tb.CreateGroup(ctx, models.Group{GroupName: "test.group"}); err != nil {
+		t.Fatal(err)
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Message-ID", "<1@example.org>")
+	a := models.Article{Header: header, Body: "body\n"}
+	links, paths, err := tb.numberArticle(ctx, header, []string{"test.group"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := formatArticle(a)
+	if err := writeFiles(paths, data); err != nil {
+		t.Fatal(err)
+	}
+
+	// the group is renamed after the file is written, but before the article is indexed
+	g, err := tb.GetGroup(ctx, "test.group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.GroupName = "test.renamed"
+	if err := tb.UpdateGroup(ctx, g); err != nil {
+		t.Fatal(err)
+	}
+	tb.mu.Lock()
+	err = tb.indexArticle(a, links, paths, len(data))
+	tb.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := tb.GetArticleByNumber(ctx, &g, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Header.Get("Message-ID") != "<1@example.org>" {
+		t.Errorf("got article %q", got.Header.Get("Message-ID"))
+	}
+}
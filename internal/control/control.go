@@ -0,0 +1,209 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+	"strings"
+
+	"github.com/ChronosX88/yans/internal/admin"
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+const (
+	Cancel      = "cancel"
+	NewGroup    = "newgroup"
+	RmGroup     = "rmgroup"
+	CheckGroups = "checkgroups"
+)
+
+// Origin tells who has submitted the article. The sender headers of articles can be forged, so they are believed
+// only when the article comes from a trusted peer or the address is the one of the posting user.
+type Origin struct {
+	User string // the user the posting client has authenticated as
+	Peer string // the peer which has relayed the article: the user it has authenticated as or the name of the upstream
+}
+
+// Processor executes control messages (RFC 5537) and Supersedes headers of incoming articles.
+type Processor struct {
+	backend        backend.StorageBackend
+	uploadPath     string
+	domain         string
+	trustedSenders map[string]bool
+	trustedPeers   map[string]bool
+	keyring        openpgp.EntityList
+
+	checkGroupsRemove bool
+}
+
+func NewProcessor(b backend.StorageBackend, cfg config.Config) (*Processor, error) {
+	p := &Processor{
+		backend:        b,
+		uploadPath:     cfg.UploadPath,
+		domain:         strings.ToLower(cfg.Domain),
+		trustedSenders: map[string]bool{},
+		trustedPeers:   map[string]bool{},
+
+		checkGroupsRemove: cfg.Control.CheckGroupsRemove,
+	}
+	for _, v := range cfg.Control.TrustedSenders {
+		p.trustedSenders[strings.ToLower(v)] = true
+	}
+	for _, v := range cfg.Control.TrustedPeers {
+		p.trustedPeers[v] = true
+	}
+	if cfg.Control.KeyringFile != "" {
+		f, err := os.Open(cfg.Control.KeyringFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if p.keyring, err = openpgp.ReadArmoredKeyRing(f); err != nil {
+			return nil, fmt.Errorf("failed to read control keyring: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// Process executes the control message of the article which is about to be stored into groups.
+// It returns the groups the article should be filed into, control messages are filed into control.* groups
+// if the server carries them and aren't stored otherwise. Unauthorized control messages are filed, but not executed.
+func (p *Processor) Process(ctx context.Context, a *models.Article, groups []string, origin Origin) ([]string, error) {
+	control := strings.Fields(a.Header.Get("Control"))
+	if len(control) == 0 {
+		return groups, nil
+	}
+
+	verb := strings.ToLower(control[0])
+	args := control[1:]
+	var err error
+	switch verb {
+	case Cancel:
+		if len(args) != 1 {
+			return nil, fmt.Errorf("malformed cancel control message")
+		}
+		err = p.cancel(ctx, a, args[0], origin)
+	case NewGroup:
+		err = p.newGroup(ctx, a, args, origin)
+	case RmGroup:
+		err = p.rmGroup(ctx, a, args, origin)
+	case CheckGroups:
+		err = p.checkGroups(ctx, a, args, origin)
+	default:
+		log.Printf("control: ignoring unsupported control message %s from %s", verb, a.Header.Get("Message-ID"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return p.controlGroups(ctx, verb)
+}
+
+// controlGroups returns the group which control messages of the type are filed into.
+func (p *Processor) controlGroups(ctx context.Context, verb string) ([]string, error) {
+	for _, v := range []string{"control." + verb, "control"} {
+		if _, err := p.backend.GetGroup(ctx, v); err != nil {
+			if err == backend.ErrNoSuchGroup {
+				continue
+			}
+			return nil, err
+		}
+		return []string{v}, nil
+	}
+	return nil, nil
+}
+
+// Supersede removes the article which is replaced by the stored article, if the sender of the article
+// is authorized to do it. It must be called only once the article has been stored.
+func (p *Processor) Supersede(ctx context.Context, a *models.Article, origin Origin) error {
+	target := a.Header.Get("Supersedes")
+	if target == "" {
+		return nil
+	}
+	return p.cancel(ctx, a, target, origin)
+}
+
+// cancel removes the target article if the sender of the article is authorized to do it.
+func (p *Processor) cancel(ctx context.Context, a *models.Article, target string, origin Origin) error {
+	sender := senderAddress(a.Header)
+	t, err := p.backend.GetArticle(ctx, target)
+	if err != nil {
+		if err != backend.ErrNoSuchArticle {
+			return err
+		}
+		// the target may arrive later, it must not be accepted then. Without the target
+		// it can't be told whether it belongs to the sender, so only trusted cancels are kept.
+		if !p.isTrusted(a, origin) {
+			log.Printf("control: %s isn't authorized to cancel %s which isn't here", sender, target)
+			return nil
+		}
+		return p.backend.RememberMessageID(ctx, target)
+	}
+
+	if !p.mayCancel(a, &t, origin) {
+		log.Printf("control: %s isn't authorized to cancel %s", sender, target)
+		return nil
+	}
+
+	if _, err := admin.RemoveArticle(ctx, p.backend, p.uploadPath, target); err != nil {
+		return err
+	}
+	log.Printf("control: %s has been cancelled by %s", target, sender)
+	return nil
+}
+
+// mayCancel reports whether the article may cancel the target one, besides trusted senders the sender
+// of the target may do it.
+func (p *Processor) mayCancel(a, target *models.Article, origin Origin) bool {
+	if p.isTrusted(a, origin) {
+		return true
+	}
+	sender := senderAddress(a.Header)
+	return p.believesSender(a, origin) && sender != "" && sender == senderAddress(target.Header)
+}
+
+// isTrusted reports whether the article may manage groups and cancel any article. It has to be signed
+// with a key from the keyring, or come from a trusted sender whose address is believed.
+func (p *Processor) isTrusted(a *models.Article, origin Origin) bool {
+	if p.believesSender(a, origin) && p.trustedSenders[senderAddress(a.Header)] {
+		return true
+	}
+	if p.keyring == nil || a.Header.Get("X-PGP-Sig") == "" {
+		return false
+	}
+	if err := verifySignature(p.keyring, a); err != nil {
+		log.Printf("control: bad signature of %s: %v", a.Header.Get("Message-ID"), err)
+		return false
+	}
+	return true
+}
+
+// believesSender reports whether the sender headers of the article can be believed: it has been relayed
+// by a trusted peer, or posted by an authenticated client whose sender address is <username>@<domain>.
+func (p *Processor) believesSender(a *models.Article, origin Origin) bool {
+	if origin.User != "" {
+		return senderAddress(a.Header) == strings.ToLower(origin.User+"@"+p.domain)
+	}
+	return p.trustedPeers[origin.Peer]
+}
+
+// senderAddress returns the lower-cased address from Sender header or From one if there is no Sender.
+func senderAddress(h map[string][]string) string {
+	value := ""
+	for _, k := range []string{"Sender", "From"} {
+		if v, ok := h[k]; ok && len(v) != 0 && v[0] != "" {
+			value = v[0]
+			break
+		}
+	}
+	addr, err := mail.ParseAddress(value)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(addr.Address)
+}
@@ -0,0 +1,200 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ChronosX88/yans/internal/admin"
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/utils"
+)
+
+const moderatedSuffix = "(Moderated)"
+
+type groupInfo struct {
+	name        string
+	description string
+	moderated   bool
+}
+
+// parseGroupLine parses a line of newsgroups file: name, tab and description with optional "(Moderated)" at the end.
+func parseGroupLine(line string) (groupInfo, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || !utils.IsValidGroupName(fields[0]) {
+		return groupInfo{}, false
+	}
+	gi := groupInfo{name: fields[0]}
+	gi.description = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), fields[0]))
+	if strings.HasSuffix(gi.description, moderatedSuffix) {
+		gi.moderated = true
+		gi.description = strings.TrimSpace(strings.TrimSuffix(gi.description, moderatedSuffix))
+	}
+	return gi, true
+}
+
+// newGroup handles "newgroup name [moderated]", the description is taken from the body line
+// which follows "For your newsgroups file:".
+func (p *Processor) newGroup(ctx context.Context, a *models.Article, args []string, origin Origin) error {
+	if len(args) == 0 || !utils.IsValidGroupName(args[0]) {
+		return fmt.Errorf("malformed newgroup control message")
+	}
+	if !p.isTrusted(a, origin) {
+		log.Printf("control: %s isn't authorized to create %s", senderAddress(a.Header), args[0])
+		return nil
+	}
+
+	gi := groupInfo{name: args[0], moderated: len(args) > 1 && strings.ToLower(args[1]) == "moderated"}
+	sc := bufio.NewScanner(strings.NewReader(a.Body))
+	for sc.Scan() {
+		if strings.TrimSpace(sc.Text()) != "For your newsgroups file:" {
+			continue
+		}
+		for sc.Scan() {
+			if v, ok := parseGroupLine(sc.Text()); ok && v.name == gi.name {
+				gi.description = v.description
+				break
+			}
+		}
+		break
+	}
+
+	return p.saveGroup(ctx, gi, senderAddress(a.Header))
+}
+
+func (p *Processor) rmGroup(ctx context.Context, a *models.Article, args []string, origin Origin) error {
+	if len(args) != 1 {
+		return fmt.Errorf("malformed rmgroup control message")
+	}
+	if !p.isTrusted(a, origin) {
+		log.Printf("control: %s isn't authorized to remove %s", senderAddress(a.Header), args[0])
+		return nil
+	}
+
+	g, err := p.backend.GetGroup(ctx, args[0])
+	if err != nil {
+		if err == backend.ErrNoSuchGroup {
+			return nil
+		}
+		return err
+	}
+	return p.removeGroup(ctx, &g)
+}
+
+// checkGroups handles "checkgroups [scope] [#serial]" with the body listing all groups of the hierarchies
+// in scope. Missing groups are created and descriptions are updated. Groups which aren't listed are removed
+// only if the scope is given explicitly and the removal is enabled in the config, otherwise they are logged.
+func (p *Processor) checkGroups(ctx context.Context, a *models.Article, args []string, origin Origin) error {
+	if !p.isTrusted(a, origin) {
+		log.Printf("control: %s isn't authorized to send checkgroups", senderAddress(a.Header))
+		return nil
+	}
+
+	var scope []string
+	for _, v := range args {
+		if !strings.HasPrefix(v, "#") {
+			scope = append(scope, v)
+		}
+	}
+
+	listed := map[string]groupInfo{}
+	sc := bufio.NewScanner(strings.NewReader(a.Body))
+	for sc.Scan() {
+		gi, ok := parseGroupLine(sc.Text())
+		if !ok {
+			continue
+		}
+		listed[gi.name] = gi
+	}
+	if len(listed) == 0 {
+		return fmt.Errorf("checkgroups without groups")
+	}
+	remove := p.checkGroupsRemove && len(scope) != 0
+	if len(scope) == 0 {
+		// without explicit scope the hierarchies are the ones of the listed groups
+		for name := range listed {
+			scope = appendUnique(scope, strings.Split(name, ".")[0])
+		}
+	}
+
+	for _, v := range listed {
+		if err := p.saveGroup(ctx, v, senderAddress(a.Header)); err != nil {
+			return err
+		}
+	}
+
+	groups, err := p.backend.ListGroups(ctx)
+	if err != nil {
+		return err
+	}
+	w, err := utils.ParseWildmat(scopeWildmat(scope))
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if _, ok := listed[g.GroupName]; ok || !w.Match(g.GroupName) {
+			continue
+		}
+		if !remove {
+			log.Printf("control: group %s isn't listed by checkgroups %s, it is kept", g.GroupName, a.Header.Get("Message-ID"))
+			continue
+		}
+		if err := p.removeGroup(ctx, &g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// scopeWildmat makes a wildmat matching the groups of the hierarchies, "!" marks excluded sub-hierarchies.
+func scopeWildmat(scope []string) string {
+	var patterns []string
+	for _, v := range scope {
+		patterns = append(patterns, v, v+".*")
+	}
+	return strings.Join(patterns, ",")
+}
+
+// saveGroup creates the group on behalf of the creator or updates its description and moderation status.
+func (p *Processor) saveGroup(ctx context.Context, gi groupInfo, creator string) error {
+	var description *string
+	if gi.description != "" {
+		description = &gi.description
+	}
+
+	g, err := p.backend.GetGroup(ctx, gi.name)
+	if err != nil {
+		if err != backend.ErrNoSuchGroup {
+			return err
+		}
+		log.Printf("control: creating group %s", gi.name)
+		return p.backend.CreateGroup(ctx, models.Group{GroupName: gi.name, Description: description, Moderated: gi.moderated, Creator: creator})
+	}
+
+	if g.Moderated == gi.moderated && (description == nil || (g.Description != nil && *g.Description == *description)) {
+		return nil
+	}
+	g.Moderated = gi.moderated
+	if description != nil {
+		g.Description = description
+	}
+	log.Printf("control: updating group %s", gi.name)
+	return p.backend.UpdateGroup(ctx, g)
+}
+
+func (p *Processor) removeGroup(ctx context.Context, g *models.Group) error {
+	log.Printf("control: removing group %s", g.GroupName)
+	return admin.RemoveGroup(ctx, p.backend, p.uploadPath, g)
+}
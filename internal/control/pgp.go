@@ -0,0 +1,38 @@
+package control
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// verifySignature checks X-PGP-Sig header of the article in the format of pgpverify:
+// "X-PGP-Sig: version signed-headers" followed by the lines of the armored signature.
+func verifySignature(keyring openpgp.EntityList, a *models.Article) error {
+	// folded header lines are joined with spaces, base64 lines contain none
+	fields := strings.Fields(a.Header.Get("X-PGP-Sig"))
+	if len(fields) < 3 {
+		return fmt.Errorf("malformed X-PGP-Sig header")
+	}
+	version, signedHeaders, sigLines := fields[0], fields[1], fields[2:]
+
+	sb := strings.Builder{}
+	sb.WriteString("X-Signed-Headers: " + signedHeaders + "\n")
+	for _, v := range strings.Split(signedHeaders, ",") {
+		sb.WriteString(fmt.Sprintf("%s: %s\n", v, a.Header.Get(v)))
+	}
+	sb.WriteString("\n")
+	for _, v := range strings.Split(strings.TrimRight(a.Body, "\r\n"), "\n") {
+		sb.WriteString(strings.TrimRight(v, "\r") + "\n")
+	}
+
+	signature := "-----BEGIN PGP SIGNATURE-----\n" +
+		"Version: " + version + "\n\n" +
+		strings.Join(sigLines, "\n") + "\n" +
+		"-----END PGP SIGNATURE-----\n"
+
+	_, err := openpgp.CheckArmoredDetachedSignature(keyring, strings.NewReader(sb.String()), strings.NewReader(signature), nil)
+	return err
+}
@@ -0,0 +1,187 @@
+package expire
+
+import (
+	"context"
+	"log"
+	"net/mail"
+	"time"
+
+	"github.com/ChronosX88/yans/internal/admin"
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/utils"
+)
+
+const interval = time.Hour
+
+type retentionPolicy struct {
+	groups      *utils.Wildmat
+	maxAge      time.Duration
+	maxArticles int
+	maxSize     int
+}
+
+// Report describes what has been removed by the expiry run.
+type Report struct {
+	Articles    int
+	Attachments int
+	Groups      map[string]int // number of expired articles per group
+}
+
+// Expirer periodically removes outdated data from the storage.
+type Expirer struct {
+	backend      backend.StorageBackend
+	uploadPath   string
+	historyTTL   time.Duration
+	honorExpires bool
+	policies     []retentionPolicy
+}
+
+func NewExpirer(b backend.StorageBackend, cfg config.Config) (*Expirer, error) {
+	e := &Expirer{
+		backend:      b,
+		uploadPath:   cfg.UploadPath,
+		historyTTL:   time.Duration(cfg.History.RememberDays) * 24 * time.Hour,
+		honorExpires: cfg.Expire.HonorExpires,
+	}
+	for _, v := range cfg.Expire.Retention {
+		w, err := utils.ParseWildmat(v.Groups)
+		if err != nil {
+			return nil, err
+		}
+		e.policies = append(e.policies, retentionPolicy{
+			groups:      w,
+			maxAge:      time.Duration(v.MaxAgeDays) * 24 * time.Hour,
+			maxArticles: v.MaxArticles,
+			maxSize:     v.MaxSize,
+		})
+	}
+	return e, nil
+}
+
+func (e *Expirer) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			e.run(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (e *Expirer) run(ctx context.Context) {
+	r, err := e.ExpireArticles(ctx)
+	if err != nil {
+		log.Printf("expire: failed to expire articles: %v", err)
+	}
+	if r.Articles != 0 {
+		for g, n := range r.Groups {
+			log.Printf("expire: %s: %d articles expired", g, n)
+		}
+		log.Printf("expire: removed %d articles and %d attachments", r.Articles, r.Attachments)
+	}
+
+	if e.historyTTL > 0 {
+		n, err := e.backend.PurgeHistory(ctx, time.Now().Add(-e.historyTTL))
+		if err != nil {
+			log.Printf("expire: failed to purge history: %v", err)
+		} else if n != 0 {
+			log.Printf("expire: forgot %d message ids", n)
+		}
+	}
+}
+
+// ExpireArticles removes articles which have expired in all groups they are posted to.
+func (e *Expirer) ExpireArticles(ctx context.Context) (Report, error) {
+	r := Report{Groups: map[string]int{}}
+	now := time.Now()
+
+	groups, err := e.backend.ListGroups(ctx)
+	if err != nil {
+		return r, err
+	}
+
+	// crossposted articles are kept until every group they are in lets them go
+	marks := map[string]int{}
+	var expired []models.ArticleInfo
+	expiredIn := map[string][]string{}
+	for _, g := range groups {
+		info, err := e.backend.GetGroupArticleInfo(ctx, &g)
+		if err != nil {
+			return r, err
+		}
+		for _, v := range e.expiredArticles(g.GroupName, info, now) {
+			marks[v.MessageID]++
+			expiredIn[v.MessageID] = append(expiredIn[v.MessageID], g.GroupName)
+			if marks[v.MessageID] == v.Groups {
+				expired = append(expired, v)
+			}
+		}
+	}
+
+	for _, v := range expired {
+		a, err := admin.RemoveArticle(ctx, e.backend, e.uploadPath, v.MessageID)
+		if err != nil {
+			return r, err
+		}
+		r.Articles++
+		r.Attachments += len(a.Attachments)
+		for _, g := range expiredIn[v.MessageID] {
+			r.Groups[g]++
+		}
+	}
+	return r, nil
+}
+
+// expiredArticles returns the articles of the group which are out of its retention policy.
+// The info is expected to be sorted by article number.
+func (e *Expirer) expiredArticles(group string, info []models.ArticleInfo, now time.Time) []models.ArticleInfo {
+	var policy *retentionPolicy
+	for i := range e.policies {
+		if e.policies[i].groups.Match(group) {
+			policy = &e.policies[i]
+			break
+		}
+	}
+
+	var expired []models.ArticleInfo
+	size := 0
+	// go from the newest articles to the oldest ones, so the limits keep the latest articles
+	for i := len(info) - 1; i >= 0; i-- {
+		v := info[i]
+		size += v.Size
+		if e.isExpired(v, policy, len(info)-i, size, now) {
+			expired = append(expired, v)
+		}
+	}
+	return expired
+}
+
+// isExpired checks the article, which is the n-th newest in its group with total size of the newer articles
+// including itself, against the policy.
+func (e *Expirer) isExpired(a models.ArticleInfo, policy *retentionPolicy, n, size int, now time.Time) bool {
+	if e.honorExpires && a.Expires != "" {
+		if t, err := mail.ParseDate(a.Expires); err == nil && t.Before(now) {
+			return true
+		}
+	}
+	if policy == nil {
+		return false
+	}
+	if policy.maxAge > 0 && a.CreatedAt.Before(now.Add(-policy.maxAge)) {
+		return true
+	}
+	if policy.maxArticles > 0 && n > policy.maxArticles {
+		return true
+	}
+	if policy.maxSize > 0 && size > policy.maxSize {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package feed
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+const (
+	dialTimeout = 30 * time.Second
+	// ioTimeout is how long a peer may keep us waiting for any data
+	ioTimeout = 2 * time.Minute
+)
+
+// peerConn is a connection to a peer which is dropped when the peer stops responding
+// or the context of the feed is cancelled.
+type peerConn struct {
+	net.Conn
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (c *peerConn) Read(b []byte) (int, error) {
+	c.Conn.SetReadDeadline(time.Now().Add(ioTimeout))
+	return c.Conn.Read(b)
+}
+
+func (c *peerConn) Write(b []byte) (int, error) {
+	c.Conn.SetWriteDeadline(time.Now().Add(ioTimeout))
+	return c.Conn.Write(b)
+}
+
+func (c *peerConn) Close() error {
+	c.stopOnce.Do(func() { close(c.stop) })
+	return c.Conn.Close()
+}
+
+// dial connects to the server and authenticates if the username is set.
+func dial(ctx context.Context, address, username, password string) (*textproto.Conn, error) {
+	d := net.Dialer{Timeout: dialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn := &peerConn{Conn: nc, stop: make(chan struct{})}
+	go func() {
+		// a blocked exchange returns at once on shutdown
+		select {
+		case <-ctx.Done():
+			nc.Close()
+		case <-conn.stop:
+		}
+	}()
+	c := textproto.NewConn(conn)
+
+	if _, _, err := c.ReadCodeLine(2); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if username != "" {
+		if err := authenticate(c, username, password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func quit(c *textproto.Conn) {
+	c.PrintfLine("QUIT")
+	c.Close()
+}
+
+func command(c *textproto.Conn, expectCode int, format string, args ...interface{}) (int, error) {
+	id, err := c.Cmd(format, args...)
+	if err != nil {
+		return 0, err
+	}
+	c.StartResponse(id)
+	defer c.EndResponse(id)
+	code, _, err := c.ReadCodeLine(expectCode)
+	return code, err
+}
+
+func authenticate(c *textproto.Conn, username, password string) error {
+	code, err := command(c, 3, "AUTHINFO USER %s", username)
+	if code == 281 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = command(c, 281, "AUTHINFO PASS %s", password)
+	return err
+}
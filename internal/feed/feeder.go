@@ -0,0 +1,333 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/utils"
+)
+
+const (
+	cursorStateKey = "feed.cursor"
+	batchSize      = 100
+	maxAttempts    = 20
+	maxBackoff     = time.Hour
+)
+
+type peer struct {
+	cfg    config.PeerConfig
+	groups *utils.Wildmat
+
+	failures int
+	retryAt  time.Time
+}
+
+// Feeder pushes new articles to the configured peers.
+type Feeder struct {
+	backend    backend.StorageBackend
+	uploadPath string
+	interval   time.Duration
+	peers      []*peer
+}
+
+func NewFeeder(b backend.StorageBackend, cfg config.Config) (*Feeder, error) {
+	f := &Feeder{
+		backend:    b,
+		uploadPath: cfg.UploadPath,
+		interval:   time.Duration(cfg.Feed.Interval) * time.Second,
+	}
+	if f.interval <= 0 {
+		return nil, fmt.Errorf("feed interval must be positive")
+	}
+	for _, v := range cfg.Feed.Peers {
+		if v.Name == "" || v.Address == "" {
+			return nil, fmt.Errorf("feed peer must have name and address")
+		}
+		switch v.Mode {
+		case "":
+			v.Mode = config.IHaveFeedMode
+		case config.IHaveFeedMode, config.StreamFeedMode:
+		default:
+			return nil, fmt.Errorf("invalid feed mode of peer %s, supported modes: %s, %s", v.Name, config.IHaveFeedMode, config.StreamFeedMode)
+		}
+		groups := v.Groups
+		if groups == "" {
+			groups = "*"
+		}
+		w, err := utils.ParseWildmat(groups)
+		if err != nil {
+			return nil, err
+		}
+		f.peers = append(f.peers, &peer{cfg: v, groups: w})
+	}
+	return f, nil
+}
+
+func (f *Feeder) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+		for {
+			f.run(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (f *Feeder) run(ctx context.Context) {
+	if err := f.scan(ctx); err != nil {
+		log.Printf("feed: failed to enqueue new articles: %v", err)
+	}
+	now := time.Now()
+	for _, p := range f.peers {
+		if now.Before(p.retryAt) {
+			continue
+		}
+		if err := f.push(ctx, p); err != nil {
+			p.failures++
+			p.retryAt = now.Add(backoff(f.interval, p.failures))
+			log.Printf("feed: failed to send articles to %s: %v", p.cfg.Name, err)
+			continue
+		}
+		p.failures = 0
+	}
+}
+
+// scan puts articles which arrived since the last scan into the queues of the peers
+// which take their groups and haven't seen them yet.
+func (f *Feeder) scan(ctx context.Context) error {
+	cursor := 0
+	value, err := f.backend.GetState(ctx, cursorStateKey)
+	if err != nil && !errors.Is(err, backend.ErrNotFound) {
+		return err
+	}
+	if value != "" {
+		if cursor, err = strconv.Atoi(value); err != nil {
+			return err
+		}
+	}
+
+	for {
+		articles, err := f.backend.GetArticlesSinceID(ctx, cursor, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(articles) == 0 {
+			return nil
+		}
+		for _, a := range articles {
+			for _, p := range f.peers {
+				if !p.wants(a) {
+					continue
+				}
+				if err := f.backend.EnqueueFeedArticle(ctx, p.cfg.Name, a.MessageID); err != nil {
+					return err
+				}
+			}
+			cursor = a.ID
+		}
+		if err := f.backend.SetState(ctx, cursorStateKey, strconv.Itoa(cursor)); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *peer) wants(a models.Article) bool {
+	for _, v := range strings.Split(a.Header.Get("Path"), "!") {
+		if strings.TrimSpace(v) == p.cfg.Name {
+			return false
+		}
+	}
+	for _, v := range strings.Split(a.Header.Get("Newsgroups"), ",") {
+		if p.groups.Match(strings.TrimSpace(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Feeder) push(ctx context.Context, p *peer) error {
+	items, err := f.backend.GetFeedQueue(ctx, p.cfg.Name, batchSize)
+	if err != nil || len(items) == 0 {
+		return err
+	}
+
+	c, err := dial(ctx, p.cfg.Address, p.cfg.Username, p.cfg.Password)
+	if err != nil {
+		return err
+	}
+	defer quit(c)
+
+	if p.cfg.Mode == config.StreamFeedMode {
+		if _, err := command(c, 203, "MODE STREAM"); err == nil {
+			return f.pushStream(ctx, c, items)
+		} else if _, ok := err.(*textproto.Error); !ok {
+			return err
+		}
+		log.Printf("feed: peer %s doesn't support streaming, falling back to IHAVE", p.cfg.Name)
+	}
+	return f.pushIHave(ctx, c, items)
+}
+
+func (f *Feeder) pushIHave(ctx context.Context, c *textproto.Conn, items []models.FeedQueueItem) error {
+	for _, item := range items {
+		a, ok, err := f.getArticle(ctx, item)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		code, err := command(c, 3, "IHAVE %s", item.MessageID)
+		if err != nil && code == 0 {
+			return err
+		}
+		if code == 335 {
+			if err := f.writeArticle(c, &a); err != nil {
+				return err
+			}
+			code, _, err = c.ReadCodeLine(0)
+			if err != nil && code == 0 {
+				return err
+			}
+		}
+
+		switch code {
+		case 235, 435, 437:
+			err = f.backend.DeleteFeedQueueItem(ctx, item.Peer, item.MessageID)
+		default:
+			err = f.retry(ctx, item)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Feeder) pushStream(ctx context.Context, c *textproto.Conn, items []models.FeedQueueItem) error {
+	var articles []models.Article
+	pending := map[string]models.FeedQueueItem{}
+	for _, item := range items {
+		a, ok, err := f.getArticle(ctx, item)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		articles = append(articles, a)
+		pending[item.MessageID] = item
+	}
+
+	// TAKETHIS commands are pipelined, so responses are read while articles are still being sent
+	writeErr := make(chan error, 1)
+	go func() {
+		for i := range articles {
+			if err := c.PrintfLine("TAKETHIS %s", articles[i].MessageID); err != nil {
+				writeErr <- err
+				return
+			}
+			if err := f.writeArticle(c, &articles[i]); err != nil {
+				writeErr <- err
+				return
+			}
+		}
+		writeErr <- nil
+	}()
+
+	if err := f.readStreamResponses(ctx, c, len(articles), pending); err != nil {
+		// the writer still uses the connection, closing it makes the writer stop before the connection is released
+		c.Close()
+		<-writeErr
+		return err
+	}
+	return <-writeErr
+}
+
+// readStreamResponses reads the responses to n TAKETHIS commands and updates the queue items of their articles.
+func (f *Feeder) readStreamResponses(ctx context.Context, c *textproto.Conn, n int, pending map[string]models.FeedQueueItem) error {
+	for i := 0; i < n; i++ {
+		code, msg, err := c.ReadCodeLine(0)
+		if err != nil && code == 0 {
+			return err
+		}
+		messageID := strings.SplitN(msg, " ", 2)[0]
+		item, ok := pending[messageID]
+		if !ok {
+			return fmt.Errorf("unexpected response: %d %s", code, msg)
+		}
+		delete(pending, item.MessageID)
+
+		switch code {
+		case 239, 439:
+			err = f.backend.DeleteFeedQueueItem(ctx, item.Peer, item.MessageID)
+		default:
+			err = f.retry(ctx, item)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getArticle returns the queued article, items of articles which are gone from the storage are dropped.
+func (f *Feeder) getArticle(ctx context.Context, item models.FeedQueueItem) (models.Article, bool, error) {
+	a, err := f.backend.GetArticle(ctx, item.MessageID)
+	if err != nil {
+		if errors.Is(err, backend.ErrNoSuchArticle) {
+			return a, false, f.backend.DeleteFeedQueueItem(ctx, item.Peer, item.MessageID)
+		}
+		return a, false, err
+	}
+	return a, true, nil
+}
+
+func (f *Feeder) writeArticle(c *textproto.Conn, a *models.Article) error {
+	p, err := utils.BuildArticle(a, f.uploadPath)
+	if err != nil {
+		return err
+	}
+	dw := c.DotWriter()
+	if err := p.Encode(dw); err != nil {
+		return err
+	}
+	return dw.Close()
+}
+
+func (f *Feeder) retry(ctx context.Context, item models.FeedQueueItem) error {
+	item.Attempts++
+	if item.Attempts >= maxAttempts {
+		log.Printf("feed: giving up sending %s to %s after %d attempts", item.MessageID, item.Peer, item.Attempts)
+		return f.backend.DeleteFeedQueueItem(ctx, item.Peer, item.MessageID)
+	}
+	item.NextAttemptAt = time.Now().Add(backoff(f.interval, item.Attempts))
+	return f.backend.UpdateFeedQueueItem(ctx, item)
+}
+
+// backoff returns the delay before the next attempt, it doubles with every failed attempt.
+func backoff(interval time.Duration, attempts int) time.Duration {
+	d := interval
+	for i := 0; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
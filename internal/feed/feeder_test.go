@@ -0,0 +1,77 @@
+package feed
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/ChronosX88/yans/internal/backend/memory"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/models"
+)
+
+// TestPushStreamUnexpectedResponse checks that the feeder stops sending articles before it drops the connection
+// of a peer which has given a bogus response in the middle of streaming.
+func TestPushStreamUnexpectedResponse(t *testing.T) {
+	ctx := context.Background()
+	b := memory.NewMemoryBackend()
+	if err := b.CreateGroup(ctx, models.Group{GroupName: "misc.test"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		a := models.Article{Header: textproto.MIMEHeader{}, Body: strings.Repeat("line\r\n", 10000)}
+		a.Header.Set("Message-ID", fmt.Sprintf("<%d@test>", i))
+		a.Header.Set("Newsgroups", "misc.test")
+		headerJson, err := json.Marshal(a.Header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.HeaderRaw = string(headerJson)
+		if err := b.SaveArticle(ctx, a, []string{"misc.test"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.EnqueueFeedArticle(ctx, "peer", a.Header.Get("Message-ID")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "200 ready\r\n")
+		r.ReadString('\n') // MODE STREAM
+		fmt.Fprint(conn, "203 streaming\r\n")
+		r.ReadString('\n') // the first TAKETHIS
+		fmt.Fprint(conn, "239 <bogus@test>\r\n")
+		io.Copy(io.Discard, r)
+	}()
+
+	f, err := NewFeeder(b, config.Config{
+		UploadPath: t.TempDir(),
+		Feed: config.FeedConfig{
+			Interval: 60,
+			Peers:    []config.PeerConfig{{Name: "peer", Address: ln.Addr().String(), Mode: config.StreamFeedMode}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.push(ctx, f.peers[0]); err == nil || !strings.Contains(err.Error(), "unexpected response") {
+		t.Errorf("push: got %v, want unexpected response error", err)
+	}
+}
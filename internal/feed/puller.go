@@ -0,0 +1,306 @@
+package feed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/utils"
+	"github.com/jhillyerd/enmime"
+)
+
+// pullBatchSize is the maximum number of articles fetched from a group in one run.
+const pullBatchSize = 1000
+
+type upstream struct {
+	cfg    config.UpstreamConfig
+	groups *utils.Wildmat
+
+	failures int
+	retryAt  time.Time
+}
+
+type overviewItem struct {
+	number    int
+	messageID string
+}
+
+// ErrRejected is wrapped by errors of ingest for articles which won't be accepted if they are fetched again,
+// e.g. duplicates or articles refused by the server policy. Such articles are skipped, while other errors
+// stop the pull, so the articles are fetched again on the next run.
+var ErrRejected = errors.New("article rejected")
+
+// Puller mirrors groups from the configured upstream servers.
+type Puller struct {
+	backend   backend.StorageBackend
+	ingest    func(ctx context.Context, upstream string, envelope *enmime.Envelope) error
+	interval  time.Duration
+	upstreams []*upstream
+}
+
+// NewPuller creates a puller which passes fetched articles with the name of their upstream to ingest.
+func NewPuller(b backend.StorageBackend, cfg config.Config, ingest func(ctx context.Context, upstream string, envelope *enmime.Envelope) error) (*Puller, error) {
+	p := &Puller{
+		backend:  b,
+		ingest:   ingest,
+		interval: time.Duration(cfg.Feed.Interval) * time.Second,
+	}
+	if p.interval <= 0 {
+		return nil, fmt.Errorf("feed interval must be positive")
+	}
+	for _, v := range cfg.Feed.Upstreams {
+		if v.Name == "" || v.Address == "" {
+			return nil, fmt.Errorf("feed upstream must have name and address")
+		}
+		groups := v.Groups
+		if groups == "" {
+			groups = "*"
+		}
+		w, err := utils.ParseWildmat(groups)
+		if err != nil {
+			return nil, err
+		}
+		p.upstreams = append(p.upstreams, &upstream{cfg: v, groups: w})
+	}
+	return p, nil
+}
+
+func (p *Puller) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			p.run(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (p *Puller) run(ctx context.Context) {
+	now := time.Now()
+	for _, u := range p.upstreams {
+		if now.Before(u.retryAt) {
+			continue
+		}
+		if err := p.pull(ctx, u); err != nil {
+			u.failures++
+			u.retryAt = now.Add(backoff(p.interval, u.failures))
+			log.Printf("feed: failed to pull articles from %s: %v", u.cfg.Name, err)
+			continue
+		}
+		u.failures = 0
+	}
+}
+
+// pull fetches new articles of the local groups which match the upstream wildmat.
+func (p *Puller) pull(ctx context.Context, u *upstream) error {
+	groups, err := p.backend.ListGroups(ctx)
+	if err != nil {
+		return err
+	}
+	var wanted []models.Group
+	for _, v := range groups {
+		if u.groups.Match(v.GroupName) {
+			wanted = append(wanted, v)
+		}
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	c, err := dial(ctx, u.cfg.Address, u.cfg.Username, u.cfg.Password)
+	if err != nil {
+		return err
+	}
+	defer quit(c)
+
+	for _, g := range wanted {
+		if err := p.pullGroup(ctx, c, u, g.GroupName); err != nil {
+			if _, ok := err.(*textproto.Error); !ok {
+				return err
+			}
+			log.Printf("feed: failed to pull group %s from %s: %v", g.GroupName, u.cfg.Name, err)
+		}
+	}
+	return nil
+}
+
+// PullStateKey returns the state key which holds the number of the last article pulled from the upstream group.
+func PullStateKey(upstream, group string) string {
+	return fmt.Sprintf("pull:%s:%s", upstream, group)
+}
+
+func (p *Puller) pullGroup(ctx context.Context, c *textproto.Conn, u *upstream, group string) error {
+	key := PullStateKey(u.cfg.Name, group)
+	hwm := 0
+	value, err := p.backend.GetState(ctx, key)
+	if err != nil && !errors.Is(err, backend.ErrNotFound) {
+		return err
+	}
+	if value != "" {
+		if hwm, err = strconv.Atoi(value); err != nil {
+			return err
+		}
+	}
+
+	id, err := c.Cmd("GROUP %s", group)
+	if err != nil {
+		return err
+	}
+	c.StartResponse(id)
+	_, msg, err := c.ReadCodeLine(211)
+	c.EndResponse(id)
+	if err != nil {
+		return err
+	}
+	// 211 number low high group
+	fields := strings.Fields(msg)
+	if len(fields) < 3 {
+		return fmt.Errorf("malformed GROUP response: %s", msg)
+	}
+	low, _ := strconv.Atoi(fields[1])
+	high, _ := strconv.Atoi(fields[2])
+
+	start := hwm + 1
+	if start < low {
+		start = low
+	}
+	if start > high {
+		return nil
+	}
+	if high-start >= pullBatchSize {
+		high = start + pullBatchSize - 1
+	}
+
+	items, err := p.overview(c, start, high)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range items {
+		exists, err := p.backend.HasMessageID(ctx, v.messageID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if err := p.fetch(ctx, c, u, v.messageID); err != nil {
+				if _, ok := err.(*textproto.Error); !ok {
+					return err
+				}
+				log.Printf("feed: failed to fetch %s from %s: %v", v.messageID, u.cfg.Name, err)
+			}
+		}
+		if err := p.backend.SetState(ctx, key, strconv.Itoa(v.number)); err != nil {
+			return err
+		}
+	}
+	return p.backend.SetState(ctx, key, strconv.Itoa(high))
+}
+
+// overview returns the numbers and message ids of the articles in the range of the current group.
+// If the server doesn't support OVER, the articles are enumerated with STAT.
+func (p *Puller) overview(c *textproto.Conn, low, high int) ([]overviewItem, error) {
+	var items []overviewItem
+
+	id, err := c.Cmd("OVER %d-%d", low, high)
+	if err != nil {
+		return nil, err
+	}
+	c.StartResponse(id)
+	code, _, err := c.ReadCodeLine(224)
+	if err == nil {
+		lines, err := c.ReadDotLines()
+		c.EndResponse(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range lines {
+			fields := strings.Split(v, "\t")
+			if len(fields) < 5 {
+				continue
+			}
+			num, err := strconv.Atoi(fields[0])
+			if err != nil {
+				continue
+			}
+			items = append(items, overviewItem{number: num, messageID: fields[4]})
+		}
+		return items, nil
+	}
+	c.EndResponse(id)
+	if code == 423 {
+		// no articles in the range
+		return nil, nil
+	}
+	if code/100 != 5 {
+		return nil, err
+	}
+
+	for i := low; i <= high; i++ {
+		id, err := c.Cmd("STAT %d", i)
+		if err != nil {
+			return nil, err
+		}
+		c.StartResponse(id)
+		code, msg, err := c.ReadCodeLine(223)
+		c.EndResponse(id)
+		if err != nil {
+			if code == 423 {
+				continue
+			}
+			return nil, err
+		}
+		// 223 number message-id
+		fields := strings.Fields(msg)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("malformed STAT response: %s", msg)
+		}
+		items = append(items, overviewItem{number: i, messageID: fields[1]})
+	}
+	return items, nil
+}
+
+// fetch retrieves the article and passes it to ingest, malformed and rejected articles are skipped.
+func (p *Puller) fetch(ctx context.Context, c *textproto.Conn, u *upstream, messageID string) error {
+	id, err := c.Cmd("ARTICLE %s", messageID)
+	if err != nil {
+		return err
+	}
+	c.StartResponse(id)
+	defer c.EndResponse(id)
+
+	if _, _, err := c.ReadCodeLine(220); err != nil {
+		return err
+	}
+	raw, err := ioutil.ReadAll(c.DotReader())
+	if err != nil {
+		return err
+	}
+
+	envelope, err := enmime.ReadEnvelope(bytes.NewReader(raw))
+	if err != nil {
+		log.Printf("feed: skipping malformed article %s: %v", messageID, err)
+		return nil
+	}
+	if err := p.ingest(ctx, u.cfg.Name, envelope); err != nil {
+		if !errors.Is(err, ErrRejected) {
+			return err
+		}
+		log.Printf("feed: skipping article %s: %v", messageID, err)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package models
+
+const (
+	// ACLAnonymous is the username of ACL entries applied to clients which haven't authenticated.
+	ACLAnonymous = ""
+	// ACLAuthenticated is the username of ACL entries applied to authenticated users
+	// which have no entry of their own.
+	ACLAuthenticated = "*"
+)
+
+type ACLEntry struct {
+	GroupID     int    `db:"group_id"`
+	Username    string `db:"username"`
+	CanRead     bool   `db:"can_read"`
+	CanPost     bool   `db:"can_post"`
+	CanModerate bool   `db:"can_moderate"`
+}
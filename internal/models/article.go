@@ -12,7 +12,9 @@ type Article struct {
 	CreatedAt time.Time      `db:"created_at"`
 	HeaderRaw string         `db:"header"`
 	Body      string         `db:"body"`
-	Thread    sql.NullString `db:"thread"`
+	Thread    sql.NullString `db:"thread"` // message id of the root of the thread
+	Parent    sql.NullString `db:"parent"` // message id of the article this one replies to
+	MessageID string         `db:"message_id"`
 
 	Header        textproto.MIMEHeader `db:"-"`
 	Envelope      *enmime.Envelope     `db:"-"`
@@ -20,6 +22,25 @@ type Article struct {
 	Attachments   []Attachment
 }
 
+// SetThread sets the message id of the root of the thread.
+func (a *Article) SetThread(messageID string) {
+	a.Thread = sql.NullString{String: messageID, Valid: true}
+}
+
+// SetParent sets the message id of the article this one replies to.
+func (a *Article) SetParent(messageID string) {
+	a.Parent = sql.NullString{String: messageID, Valid: true}
+}
+
+// ThreadRoot returns the message id of the root of the thread of the article, which is the article itself
+// if it starts the thread.
+func (a *Article) ThreadRoot() string {
+	if a.Thread.Valid {
+		return a.Thread.String
+	}
+	return a.MessageID
+}
+
 type Attachment struct {
 	ContentType string `db:"content_type"`
 	FileName    string `db:"attachment_id"`
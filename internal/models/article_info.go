@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ArticleInfo is a summary of an article in a group which retention policies are checked against.
+type ArticleInfo struct {
+	Number    int       `db:"article_number"`
+	MessageID string    `db:"message_id"`
+	CreatedAt time.Time `db:"created_at"`
+	Size      int       `db:"size"`
+	Expires   string    `db:"expires"` // value of Expires header
+	Groups    int       `db:"groups"`  // number of groups the article is posted to
+}
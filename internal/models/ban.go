@@ -0,0 +1,32 @@
+package models
+
+import (
+	"net"
+	"time"
+)
+
+const (
+	// BanTypeAddress bans connections from an IP address or a network in CIDR notation.
+	BanTypeAddress = "address"
+	// BanTypeUser bans authentication as the user.
+	BanTypeUser = "user"
+)
+
+type Ban struct {
+	ID        int       `db:"id"`
+	Type      string    `db:"type"`
+	Value     string    `db:"value"`
+	Reason    string    `db:"reason"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// MatchesAddress reports whether the address ban covers the IP address.
+func (b Ban) MatchesAddress(ip net.IP) bool {
+	if b.Type != BanTypeAddress || ip == nil {
+		return false
+	}
+	if _, network, err := net.ParseCIDR(b.Value); err == nil {
+		return network.Contains(ip)
+	}
+	return ip.Equal(net.ParseIP(b.Value))
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// FeedQueueItem is an article waiting to be sent to a peer.
+type FeedQueueItem struct {
+	Peer          string    `db:"peer"`
+	MessageID     string    `db:"message_id"`
+	Attempts      int       `db:"attempts"`
+	NextAttemptAt time.Time `db:"next_attempt_at"`
+	CreatedAt     time.Time `db:"created_at"`
+}
@@ -7,4 +7,8 @@ type Group struct {
 	GroupName   string    `db:"group_name"`
 	Description *string   `db:"description"`
 	CreatedAt   time.Time `db:"created_at"`
+	Moderated   bool      `db:"moderated"`
+	Creator     string    `db:"creator"` // address of whoever has created the group, empty if it isn't known
+
+	HighWaterMark int `db:"high_water_mark"` // the number of the last article ever posted to the group
 }
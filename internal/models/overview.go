@@ -0,0 +1,13 @@
+package models
+
+// Overview is the overview (NOV) record of an article in a group, it holds the fields returned by OVER.
+type Overview struct {
+	Number     int    `db:"article_number"`
+	Subject    string `db:"subject"`
+	From       string `db:"from_header"`
+	Date       string `db:"date"`
+	MessageID  string `db:"message_id"`
+	References string `db:"references_header"`
+	Bytes      int    `db:"bytes"`
+	Lines      int    `db:"lines"`
+}
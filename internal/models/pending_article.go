@@ -0,0 +1,35 @@
+package models
+
+import (
+	"database/sql"
+	"net/textproto"
+	"time"
+)
+
+// PendingArticle is an article posted to a moderated group which awaits approval of the group moderators.
+type PendingArticle struct {
+	ID             int            `db:"id"`
+	GroupID        int            `db:"group_id"`
+	CreatedAt      time.Time      `db:"created_at"`
+	HeaderRaw      string         `db:"header"`
+	Body           string         `db:"body"`
+	Thread         sql.NullString `db:"thread"`
+	Parent         sql.NullString `db:"parent"`
+	AttachmentsRaw string         `db:"attachments"`
+	Submitter      string         `db:"submitter"`
+
+	Header      textproto.MIMEHeader `db:"-"`
+	Attachments []Attachment         `db:"-"`
+}
+
+// Article returns the article which is going to be published once the pending article is approved.
+func (pa PendingArticle) Article() Article {
+	return Article{
+		HeaderRaw:   pa.HeaderRaw,
+		Body:        pa.Body,
+		Thread:      pa.Thread,
+		Parent:      pa.Parent,
+		Header:      pa.Header,
+		Attachments: pa.Attachments,
+	}
+}
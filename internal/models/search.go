@@ -0,0 +1,8 @@
+package models
+
+// SearchResult is an article found by the full-text search in one of the groups it is posted to.
+type SearchResult struct {
+	MessageID     string `db:"message_id"`
+	GroupName     string `db:"group_name"`
+	ArticleNumber int    `db:"article_number"`
+}
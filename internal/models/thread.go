@@ -0,0 +1,21 @@
+package models
+
+import "database/sql"
+
+// ThreadOrder is the order in which threads are listed.
+type ThreadOrder int
+
+const (
+	ThreadOrderCreated   ThreadOrder = iota // the newest threads first
+	ThreadOrderLastReply                    // the threads with the newest replies first
+)
+
+// ThreadNode is an article in the reply tree of a thread.
+type ThreadNode struct {
+	Number    int            `db:"article_number"`
+	MessageID string         `db:"message_id"`
+	ParentID  sql.NullString `db:"parent"` // message id of the parent article
+
+	Parent int `db:"-"` // number of the parent in the group, 0 for the root
+	Depth  int `db:"-"` // 0 for the root
+}
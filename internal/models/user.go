@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type User struct {
+	ID           int       `db:"id"`
+	Username     string    `db:"username"`
+	PasswordHash string    `db:"password_hash"`
+	CreatedAt    time.Time `db:"created_at"`
+
+	// SCRAM-SHA-256 credentials, base64 encoded
+	ScramSalt       string `db:"scram_salt"`
+	ScramIterations int    `db:"scram_iterations"`
+	ScramStoredKey  string `db:"scram_stored_key"`
+	ScramServerKey  string `db:"scram_server_key"`
+}
@@ -0,0 +1,90 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/utils"
+)
+
+// Approve publishes the pending article with the Approved header set to approver and removes it from
+// the moderation queue. The article is posted to the group it has been approved for and to the unmoderated
+// groups from Newsgroups, the other moderated groups are left to their own moderators. If an article with
+// its message id has arrived meanwhile, the pending article is dropped and ErrDuplicate is returned.
+func Approve(ctx context.Context, b backend.StorageBackend, uploadPath string, id int, approver string) (models.Article, error) {
+	pa, err := b.GetPendingArticle(ctx, id)
+	if err != nil {
+		return models.Article{}, err
+	}
+	groups, err := approvedGroups(ctx, b, &pa)
+	if err != nil {
+		return models.Article{}, err
+	}
+
+	a := pa.Article()
+	a.Header.Set("Approved", approver)
+	headerJson, err := json.Marshal(a.Header)
+	if err != nil {
+		return a, err
+	}
+	a.HeaderRaw = string(headerJson)
+
+	// the article leaves the queue only once it is saved, so it can't be lost or published twice
+	if err := b.PublishPendingArticle(ctx, id, a, groups); err != nil {
+		if err == backend.ErrDuplicate {
+			if _, rerr := discard(ctx, b, uploadPath, id); rerr != nil && rerr != backend.ErrNotFound {
+				return a, rerr
+			}
+		}
+		return a, err
+	}
+	return a, nil
+}
+
+// approvedGroups returns the names of the groups the pending article is published to.
+func approvedGroups(ctx context.Context, b backend.StorageBackend, pa *models.PendingArticle) ([]string, error) {
+	var groups []string
+	for _, v := range strings.Split(pa.Header.Get("Newsgroups"), ",") {
+		g, err := b.GetGroup(ctx, strings.TrimSpace(v))
+		if err != nil {
+			if err == backend.ErrNoSuchGroup {
+				continue
+			}
+			return nil, err
+		}
+		if g.ID == pa.GroupID || !g.Moderated {
+			groups = append(groups, g.GroupName)
+		}
+	}
+	if len(groups) == 0 {
+		return nil, backend.ErrNoSuchGroup
+	}
+	return groups, nil
+}
+
+// Reject removes the pending article from the moderation queue together with its attachments. Its message id
+// is remembered, so the article isn't accepted again when it is resent.
+func Reject(ctx context.Context, b backend.StorageBackend, uploadPath string, id int) (models.PendingArticle, error) {
+	pa, err := discard(ctx, b, uploadPath, id)
+	if err != nil {
+		return pa, err
+	}
+	return pa, b.RememberMessageID(ctx, pa.Header.Get("Message-ID"))
+}
+
+// discard removes the pending article together with its attachments.
+func discard(ctx context.Context, b backend.StorageBackend, uploadPath string, id int) (models.PendingArticle, error) {
+	pa, err := b.GetPendingArticle(ctx, id)
+	if err != nil {
+		return pa, err
+	}
+
+	if err := b.DeletePendingArticle(ctx, id); err != nil {
+		return pa, err
+	}
+
+	return pa, utils.RemoveAttachments(pa.Attachments, uploadPath)
+}
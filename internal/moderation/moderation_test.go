@@ -0,0 +1,106 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/backend/memory"
+	"github.com/ChronosX88/yans/internal/models"
+)
+
+var ctx = context.Background()
+
+// queue puts the article with an attachment file into the moderation queue of the group.
+func queue(t *testing.T, b backend.StorageBackend, uploadPath, messageID string) (int, string) {
+	t.Helper()
+	g, err := b.GetGroup(ctx, "misc.moderated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := models.Article{Header: textproto.MIMEHeader{}, Body: "body\n"}
+	a.Header.Set("Message-ID", messageID)
+	a.Header.Set("Newsgroups", "misc.moderated")
+	headerJson, err := json.Marshal(a.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.HeaderRaw = string(headerJson)
+	a.Attachments = []models.Attachment{{ContentType: "image/png", FileName: messageID[1:2] + ".png"}}
+	file := filepath.Join(uploadPath, a.Attachments[0].FileName)
+	if err := os.WriteFile(file, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	id, err := b.SavePendingArticle(ctx, a, &g, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id, file
+}
+
+func newBackend(t *testing.T) backend.StorageBackend {
+	b := memory.NewMemoryBackend()
+	if err := b.CreateGroup(ctx, models.Group{GroupName: "misc.moderated", Moderated: true}); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRejectRemembersMessageID(t *testing.T) {
+	b, uploadPath := newBackend(t), t.TempDir()
+	id, file := queue(t, b, uploadPath, "<1@test>")
+
+	if _, err := Reject(ctx, b, uploadPath, id); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := b.HasMessageID(ctx, "<1@test>"); err != nil || !exists {
+		t.Errorf("HasMessageID of rejected article: got %v, %v, want true", exists, err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("attachment of rejected article is left: %v", err)
+	}
+}
+
+func TestApproveDuplicate(t *testing.T) {
+	b, uploadPath := newBackend(t), t.TempDir()
+	id, file := queue(t, b, uploadPath, "<2@test>")
+	if err := b.RememberMessageID(ctx, "<2@test>"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Approve(ctx, b, uploadPath, id, "moderator@example.org"); err != backend.ErrDuplicate {
+		t.Fatalf("Approve of duplicate: got %v, want %v", err, backend.ErrDuplicate)
+	}
+	if _, err := b.GetPendingArticle(ctx, id); err != backend.ErrNotFound {
+		t.Errorf("GetPendingArticle of duplicate: got %v, want %v", err, backend.ErrNotFound)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("attachment of duplicate is left: %v", err)
+	}
+}
+
+func TestApprove(t *testing.T) {
+	b, uploadPath := newBackend(t), t.TempDir()
+	id, file := queue(t, b, uploadPath, "<3@test>")
+
+	a, err := Approve(ctx, b, uploadPath, id, "moderator@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Header.Get("Approved") != "moderator@example.org" {
+		t.Errorf("Approve: got Approved %q", a.Header.Get("Approved"))
+	}
+	if _, err := b.GetArticle(ctx, "<3@test>"); err != nil {
+		t.Errorf("GetArticle of approved article: %v", err)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("attachment of approved article: %v", err)
+	}
+	if _, err := Approve(ctx, b, uploadPath, id, "moderator@example.org"); err != backend.ErrNotFound {
+		t.Errorf("second Approve: got %v, want %v", err, backend.ErrNotFound)
+	}
+}
@@ -18,6 +18,11 @@ const (
 	ListCapability
 	ImplementationCapability
 	ModeReaderCapability
+	AuthInfoCapability
+	SASLCapability
+	StartTLSCapability
+	StreamingCapability
+	SearchCapability
 )
 
 func (ct CapabilityType) String() string {
@@ -42,6 +47,16 @@ func (ct CapabilityType) String() string {
 		return CapabilityNameImplementation
 	case ModeReaderCapability:
 		return CapabilityNameModeReader
+	case AuthInfoCapability:
+		return CapabilityNameAuthInfo
+	case SASLCapability:
+		return CapabilityNameSASL
+	case StartTLSCapability:
+		return CapabilityNameStartTLS
+	case StreamingCapability:
+		return CapabilityNameStreaming
+	case SearchCapability:
+		return CapabilityNameSearch
 	default:
 		return ""
 	}
@@ -66,7 +66,13 @@ const (
 	CommandNext         = "NEXT"
 	CommandOver         = "OVER"
 	CommandXover        = "XOVER"
+	CommandHdr          = "HDR"
+	CommandXhdr         = "XHDR"
 	CommandIHave        = "IHAVE"
+	CommandAuthInfo     = "AUTHINFO"
+	CommandStartTLS     = "STARTTLS"
+	CommandCheck        = "CHECK"
+	CommandTakeThis     = "TAKETHIS"
 )
 
 const (
@@ -80,4 +86,9 @@ const (
 	CapabilityNameList           = "LIST"
 	CapabilityNameImplementation = "IMPLEMENTATION"
 	CapabilityNameModeReader     = "MODE-READER"
+	CapabilityNameAuthInfo       = "AUTHINFO"
+	CapabilityNameSASL           = "SASL"
+	CapabilityNameStartTLS       = "STARTTLS"
+	CapabilityNameStreaming      = "STREAMING"
+	CapabilityNameSearch         = "SEARCH" // project-specific full-text search extension
 )
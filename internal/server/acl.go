@@ -0,0 +1,123 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/protocol"
+)
+
+// defaultRights returns the rights of the session client on groups which have no ACL entries for it.
+func (h *Handler) defaultRights(s *Session) models.ACLEntry {
+	if s.authenticatedUser != "" {
+		return models.ACLEntry{
+			Username: s.authenticatedUser,
+			CanRead:  h.aclConfig.AuthenticatedRead,
+			CanPost:  h.aclConfig.AuthenticatedPost,
+		}
+	}
+	return models.ACLEntry{
+		Username: models.ACLAnonymous,
+		CanRead:  h.aclConfig.AnonymousRead,
+		CanPost:  h.aclConfig.AnonymousPost,
+	}
+}
+
+// groupRights resolves the rights of the session client on the group. The entry of the user itself
+// takes precedence over the entry for all authenticated users, then the configured defaults apply.
+func (h *Handler) groupRights(s *Session, g *models.Group) (models.ACLEntry, error) {
+	entries, err := h.backend.GetGroupACL(s.ctx, g)
+	if err != nil {
+		return models.ACLEntry{}, err
+	}
+
+	byUser := map[string]models.ACLEntry{}
+	for _, v := range entries {
+		byUser[v.Username] = v
+	}
+
+	if s.authenticatedUser != "" {
+		if e, ok := byUser[s.authenticatedUser]; ok {
+			return e, nil
+		}
+		if e, ok := byUser[models.ACLAuthenticated]; ok {
+			return e, nil
+		}
+	} else if e, ok := byUser[models.ACLAnonymous]; ok {
+		return e, nil
+	}
+
+	rights := h.defaultRights(s)
+	rights.GroupID = g.ID
+	return rights, nil
+}
+
+// postingStatus returns the status field of the group for LIST ACTIVE and NEWGROUPS responses.
+func postingStatus(g *models.Group, rights models.ACLEntry) string {
+	if !rights.CanPost {
+		return "n"
+	}
+	if g.Moderated {
+		return "m"
+	}
+	return "y"
+}
+
+// canReadArticle reports whether the session client may read at least one of the groups the article
+// is filed into. The rights on groups are kept in cache when it isn't nil, so they are resolved once for many articles.
+func (h *Handler) canReadArticle(s *Session, messageID string, cache map[int]bool) (bool, error) {
+	groups, err := h.backend.GetArticleGroups(s.ctx, messageID)
+	if err != nil {
+		return false, err
+	}
+	for _, g := range groups {
+		readable, ok := cache[g.ID]
+		if !ok {
+			rights, err := h.groupRights(s, &g)
+			if err != nil {
+				return false, err
+			}
+			readable = rights.CanRead
+			if cache != nil {
+				cache[g.ID] = readable
+			}
+		}
+		if readable {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkPostingRights returns the name of the first group the session client may not post to.
+// Groups which don't exist are skipped, they are reported when the article is being saved.
+func (h *Handler) checkPostingRights(s *Session, groups []string) (string, error) {
+	for _, v := range groups {
+		v = strings.TrimSpace(v)
+		g, err := h.backend.GetGroup(s.ctx, v)
+		if err != nil {
+			if err == backend.ErrNoSuchGroup {
+				continue
+			}
+			return "", err
+		}
+		rights, err := h.groupRights(s, &g)
+		if err != nil {
+			return "", err
+		}
+		if !rights.CanPost {
+			return v, nil
+		}
+	}
+	return "", nil
+}
+
+// groupAccessDenied returns the response for a client which isn't allowed to read the group.
+// Anonymous clients are asked to authenticate, for others the group doesn't exist.
+func (h *Handler) groupAccessDenied(s *Session) protocol.NNTPResponse {
+	if s.authenticatedUser == "" && h.authProvider != nil {
+		return protocol.NNTPResponse{Code: 480, Message: "Authentication required"}
+	}
+	return protocol.NNTPResponse{Code: 411, Message: "No such newsgroup"}
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"context"
+	"net"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/models"
+)
+
+// isAddressBanned checks the remote address ("host:port") of a client against the address bans.
+func isAddressBanned(ctx context.Context, b backend.StorageBackend, remoteAddr string) (bool, error) {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false, nil
+	}
+
+	bans, err := b.ListBans(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range bans {
+		if v.MatchesAddress(ip) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func isUserBanned(ctx context.Context, b backend.StorageBackend, username string) (bool, error) {
+	bans, err := b.ListBans(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range bans {
+		if v.Type == models.BanTypeUser && v.Value == username {
+			return true, nil
+		}
+	}
+	return false, nil
+}
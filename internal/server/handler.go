@@ -2,19 +2,25 @@ package server
 
 import (
 	"bufio"
-	"bytes"
-	"database/sql"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
-	"net/mail"
+	"net/textproto"
 	"path"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/ChronosX88/yans/internal/auth"
+	"github.com/ChronosX88/yans/internal/auth/sasl"
 	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/control"
 	"github.com/ChronosX88/yans/internal/models"
 	"github.com/ChronosX88/yans/internal/protocol"
 	"github.com/ChronosX88/yans/internal/utils"
@@ -27,9 +33,15 @@ type Handler struct {
 	backend      backend.StorageBackend
 	serverDomain string
 	uploadPath   string
+	authProvider auth.CredentialProvider
+	authRequired map[string]bool
+	tlsConfig    *tls.Config
+	aclConfig    config.ACLConfig
+	listConfig   config.ListConfig
+	control      *control.Processor
 }
 
-func NewHandler(b backend.StorageBackend, serverDomain, uploadPath string) *Handler {
+func NewHandler(b backend.StorageBackend, cfg config.Config, authProvider auth.CredentialProvider, tlsConfig *tls.Config, cp *control.Processor) *Handler {
 	h := &Handler{}
 	h.backend = b
 	h.handlers = map[string]func(s *Session, command string, arguments []string, id uint) error{
@@ -37,7 +49,7 @@ func NewHandler(b backend.StorageBackend, serverDomain, uploadPath string) *Hand
 		protocol.CommandDate:         h.handleDate,
 		protocol.CommandQuit:         h.handleQuit,
 		protocol.CommandList:         h.handleList,
-		protocol.CommandMode:         h.handleModeReader,
+		protocol.CommandMode:         h.handleMode,
 		protocol.CommandGroup:        h.handleGroup,
 		protocol.CommandNewGroups:    h.handleNewGroups,
 		protocol.CommandPost:         h.handlePost,
@@ -52,17 +64,75 @@ func NewHandler(b backend.StorageBackend, serverDomain, uploadPath string) *Hand
 		protocol.CommandNext:         h.handleNext,
 		protocol.CommandOver:         h.handleOver,
 		protocol.CommandXover:        h.handleOver,
+		protocol.CommandHdr:          h.handleHdr,
+		protocol.CommandXhdr:         h.handleHdr,
 		protocol.CommandIHave:        h.handleIHave,
+		protocol.CommandAuthInfo:     h.handleAuthInfo,
+		protocol.CommandStartTLS:     h.handleStartTLS,
+		protocol.CommandCheck:        h.handleCheck,
+		protocol.CommandTakeThis:     h.handleTakeThis,
 
 		// project-specific extensions
 		"NEWTHREADS": h.handleNewThreads,
 		"THREAD":     h.handleThread,
+		"PENDING":    h.handlePending,
+		"APPROVE":    h.handleApprove,
+		"REJECT":     h.handleReject,
+		"SEARCH":     h.handleSearch,
+	}
+	h.serverDomain = cfg.Domain
+	h.uploadPath = cfg.UploadPath
+	h.listConfig = cfg.List
+	h.authProvider = authProvider
+	h.tlsConfig = tlsConfig
+	h.aclConfig = cfg.ACL
+	h.control = cp
+	h.authRequired = map[string]bool{}
+	for _, v := range cfg.Auth.RequiredFor {
+		h.authRequired[strings.ToUpper(v)] = true
 	}
-	h.serverDomain = serverDomain
-	h.uploadPath = uploadPath
 	return h
 }
 
+// defaultCapabilities returns the capability list which is advertised to a freshly connected client.
+func (h *Handler) defaultCapabilities(tlsActive bool) protocol.Capabilities {
+	caps := make(protocol.Capabilities, len(Capabilities))
+	copy(caps, Capabilities)
+	if h.tlsConfig != nil && !tlsActive {
+		caps.Add(protocol.Capability{Type: protocol.StartTLSCapability})
+	}
+	if h.authProvider != nil {
+		var params, mechanisms []string
+		if h.cleartextAuthAllowed(tlsActive) {
+			params = append(params, "USER")
+		}
+		for _, v := range sasl.Mechanisms(h.authProvider) {
+			if !cleartextMechanisms[v] || h.cleartextAuthAllowed(tlsActive) {
+				mechanisms = append(mechanisms, v)
+			}
+		}
+		if len(mechanisms) != 0 {
+			params = append(params, "SASL")
+		}
+		if len(params) != 0 {
+			caps.Add(protocol.Capability{Type: protocol.AuthInfoCapability, Params: strings.Join(params, " ")})
+		}
+		if len(mechanisms) != 0 {
+			caps.Add(protocol.Capability{Type: protocol.SASLCapability, Params: strings.Join(mechanisms, " ")})
+		}
+	}
+	return caps
+}
+
+// cleartextMechanisms are the SASL mechanisms which send the password as is
+var cleartextMechanisms = map[string]bool{"PLAIN": true}
+
+// cleartextAuthAllowed reports whether passwords may be sent as is, they may not on unencrypted connections
+// when the client can switch to TLS (RFC 4643, section 2.2).
+func (h *Handler) cleartextAuthAllowed(tlsActive bool) bool {
+	return tlsActive || h.tlsConfig == nil
+}
+
 func (h *Handler) handleCapabilities(s *Session, command string, arguments []string, id uint) error {
 	s.tconn.StartResponse(id)
 	defer s.tconn.EndResponse(id)
@@ -95,55 +165,40 @@ func (h *Handler) handleList(s *Session, command string, arguments []string, id
 		fallthrough
 	case "ACTIVE":
 		{
-			dw := s.tconn.DotWriter()
-			var groups []models.Group
-			var err error
-			if len(arguments) == 2 {
-				groups, err = h.backend.ListGroupsByPattern(arguments[1])
-			} else {
-				groups, err = h.backend.ListGroups()
-			}
-
+			groups, rights, err := h.readableGroups(s, listWildmat(arguments))
 			if err != nil {
 				return err
 			}
+
+			dw := s.tconn.DotWriter()
 			dw.Write([]byte(protocol.NNTPResponse{Code: 215, Message: "list of newsgroups follows"}.String() + protocol.CRLF))
-			for _, v := range groups {
-				// TODO set actual post permission status
-				c, err := h.backend.GetArticlesCount(&v)
+			for i, v := range groups {
+				high, low, _, err := h.waterMarks(s, &v)
 				if err != nil {
 					return err
 				}
-				if c > 0 {
-					highWaterMark, err := h.backend.GetGroupHighWaterMark(&v)
-					if err != nil {
-						return err
-					}
-					lowWaterMark, err := h.backend.GetGroupLowWaterMark(&v)
-					if err != nil {
-						return err
-					}
-					dw.Write([]byte(fmt.Sprintf("%s %d %d y"+protocol.CRLF, v.GroupName, highWaterMark, lowWaterMark)))
-				} else {
-					dw.Write([]byte(fmt.Sprintf("%s 0 1 y"+protocol.CRLF, v.GroupName)))
-				}
+				dw.Write([]byte(fmt.Sprintf("%s %d %d %s"+protocol.CRLF, v.GroupName, high, low, postingStatus(&v, rights[i]))))
 			}
 			return dw.Close()
 		}
+	case "ACTIVE.TIMES":
+		return h.listActiveTimes(s, arguments)
+	case "COUNTS":
+		return h.listCounts(s, arguments)
+	case "DISTRIB.PATS":
+		return h.listDistribPats(s, arguments)
+	case "MOTD":
+		return h.listMOTD(s, arguments)
+	case "SUBSCRIPTIONS":
+		return h.listSubscriptions(s, arguments)
 	case "NEWSGROUPS":
 		{
-			dw := s.tconn.DotWriter()
-			var groups []models.Group
-			var err error
-			if len(arguments) == 2 {
-				groups, err = h.backend.ListGroupsByPattern(arguments[1])
-			} else {
-				groups, err = h.backend.ListGroups()
-			}
+			groups, _, err := h.readableGroups(s, listWildmat(arguments))
 			if err != nil {
 				return err
 			}
 
+			dw := s.tconn.DotWriter()
 			dw.Write([]byte(protocol.NNTPResponse{Code: 215, Message: "list of newsgroups follows"}.String() + protocol.CRLF))
 			for _, v := range groups {
 				desc := ""
@@ -156,6 +211,19 @@ func (h *Handler) handleList(s *Session, command string, arguments []string, id
 			}
 			return dw.Close()
 		}
+	case "HEADERS":
+		{
+			if len(arguments) > 2 || (len(arguments) == 2 && arguments[1] != "MSGID" && arguments[1] != "RANGE") {
+				return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+			}
+			// any header can be retrieved either way, so both forms have the same list
+			dw := s.tconn.DotWriter()
+			dw.Write([]byte(protocol.NNTPResponse{Code: 215, Message: "Field list follows"}.String() + protocol.CRLF))
+			dw.Write([]byte(":" + protocol.CRLF))
+			dw.Write([]byte(":bytes" + protocol.CRLF))
+			dw.Write([]byte(":lines" + protocol.CRLF))
+			return dw.Close()
+		}
 	case "OVERVIEW.FMT":
 		{
 			dw := s.tconn.DotWriter()
@@ -178,21 +246,38 @@ func (h *Handler) handleList(s *Session, command string, arguments []string, id
 	}
 }
 
-func (h *Handler) handleModeReader(s *Session, command string, arguments []string, id uint) error {
+func (h *Handler) handleMode(s *Session, command string, arguments []string, id uint) error {
 	s.tconn.StartResponse(id)
 	defer s.tconn.EndResponse(id)
 
-	if len(arguments) == 0 || arguments[0] != "READER" {
+	if len(arguments) != 1 {
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
-	(&s.capabilities).Remove(protocol.ModeReaderCapability)
-	(&s.capabilities).Remove(protocol.ListCapability)
-	(&s.capabilities).Add(protocol.Capability{Type: protocol.ReaderCapability})
-	(&s.capabilities).Add(protocol.Capability{Type: protocol.ListCapability, Params: "ACTIVE NEWSGROUPS OVERVIEW.FMT"})
-	s.mode = SessionModeReader
-
-	return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 201, Message: "Reader mode, posting prohibited"}.String()) // TODO vary on auth status
+	switch strings.ToUpper(arguments[0]) {
+	case "READER":
+		{
+			(&s.capabilities).Remove(protocol.ModeReaderCapability)
+			(&s.capabilities).Remove(protocol.ListCapability)
+			(&s.capabilities).Add(protocol.Capability{Type: protocol.ReaderCapability})
+			(&s.capabilities).Add(protocol.Capability{Type: protocol.ListCapability, Params: h.listVariants()})
+			s.mode = SessionModeReader
+
+			if h.defaultRights(s).CanPost {
+				(&s.capabilities).Add(protocol.Capability{Type: protocol.PostCapability})
+				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 200, Message: "Reader mode, posting permitted"}.String())
+			}
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 201, Message: "Reader mode, posting prohibited"}.String())
+		}
+	case "STREAM":
+		{
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 203, Message: "Streaming permitted"}.String())
+		}
+	default:
+		{
+			return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+		}
+	}
 }
 
 func (h *Handler) handleGroup(s *Session, command string, arguments []string, id uint) error {
@@ -203,31 +288,38 @@ func (h *Handler) handleGroup(s *Session, command string, arguments []string, id
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
-	g, err := h.backend.GetGroup(arguments[0])
+	g, err := h.backend.GetGroup(s.ctx, arguments[0])
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == backend.ErrNoSuchGroup {
 			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 411, Message: "No such newsgroup"}.String())
 		} else {
 			return err
 		}
 	}
-	highWaterMark, err := h.backend.GetGroupHighWaterMark(&g)
-	if err != nil && err != sql.ErrNoRows {
+	rights, err := h.groupRights(s, &g)
+	if err != nil {
 		return err
 	}
-	lowWaterMark, err := h.backend.GetGroupLowWaterMark(&g)
-	if err != nil && err != sql.ErrNoRows {
+	if !rights.CanRead {
+		return s.tconn.PrintfLine(h.groupAccessDenied(s).String())
+	}
+	highWaterMark, err := h.backend.GetGroupHighWaterMark(s.ctx, &g)
+	if err != nil {
 		return err
 	}
-	articlesCount, err := h.backend.GetArticlesCount(&g)
-	if err != nil && err != sql.ErrNoRows {
+	lowWaterMark, err := h.backend.GetGroupLowWaterMark(s.ctx, &g)
+	if err != nil {
+		return err
+	}
+	articlesCount, err := h.backend.GetArticlesCount(s.ctx, &g)
+	if err != nil {
 		return err
 	}
 
-	s.currentGroup = &g
+	s.setGroup(&g)
 
-	if lowWaterMark != 0 {
-		a, err := h.backend.GetArticleByNumber(&g, lowWaterMark)
+	if articlesCount != 0 {
+		a, err := h.backend.GetArticleByNumber(s.ctx, &g, lowWaterMark)
 		if err != nil {
 			return err
 		}
@@ -272,7 +364,7 @@ func (h *Handler) handleNewGroups(s *Session, command string, arguments []string
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
-	g, err := h.backend.GetNewGroupsSince(date.Unix())
+	g, err := h.backend.GetNewGroupsSince(s.ctx, date.Unix())
 	if err != nil {
 		return err
 	}
@@ -280,23 +372,30 @@ func (h *Handler) handleNewGroups(s *Session, command string, arguments []string
 	dw := s.tconn.DotWriter()
 	dw.Write([]byte(protocol.NNTPResponse{Code: 231, Message: "list of new newsgroups follows"}.String() + protocol.CRLF))
 	for _, v := range g {
-		// TODO set actual post permission status
-		c, err := h.backend.GetArticlesCount(&v)
+		rights, err := h.groupRights(s, &v)
+		if err != nil {
+			return err
+		}
+		if !rights.CanRead {
+			continue
+		}
+		c, err := h.backend.GetArticlesCount(s.ctx, &v)
 		if err != nil {
 			return err
 		}
 		if c > 0 {
-			highWaterMark, err := h.backend.GetGroupHighWaterMark(&v)
+			highWaterMark, err := h.backend.GetGroupHighWaterMark(s.ctx, &v)
 			if err != nil {
 				return err
 			}
-			lowWaterMark, err := h.backend.GetGroupLowWaterMark(&v)
+			lowWaterMark, err := h.backend.GetGroupLowWaterMark(s.ctx, &v)
 			if err != nil {
 				return err
 			}
-			dw.Write([]byte(fmt.Sprintf("%s %d %d n"+protocol.CRLF, v.GroupName, highWaterMark, lowWaterMark)))
+			dw.Write([]byte(fmt.Sprintf("%s %d %d %s"+protocol.CRLF, v.GroupName, highWaterMark, lowWaterMark, postingStatus(&v, rights))))
 		} else {
-			dw.Write([]byte(fmt.Sprintf("%s 0 1 n"+protocol.CRLF, v.GroupName)))
+			// an empty group has low water mark greater than high one
+			dw.Write([]byte(fmt.Sprintf("%s %d %d %s"+protocol.CRLF, v.GroupName, v.HighWaterMark, v.HighWaterMark+1, postingStatus(&v, rights))))
 		}
 	}
 
@@ -322,20 +421,118 @@ func (h *Handler) handlePost(s *Session, command string, arguments []string, id
 		return err
 	}
 
-	h.saveArticle(envelope, true)
+	denied, err := h.checkPostingRights(s, strings.Split(envelope.GetHeader("Newsgroups"), ","))
+	if err != nil {
+		return err
+	}
+	if denied != "" {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 441, Message: fmt.Sprintf("Posting to %s is not permitted", denied)}.String())
+	}
+
+	queued, err := h.saveArticle(s.ctx, envelope, s, "")
 	if err != nil {
-		if err.Error() == "no such message you are replying to" {
-			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 441, Message: "no such message you are replying to"}.String())
-		} else if err.Error() == "disallowed attachment type" {
-			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 441, Message: "disallowed attachment type"}.String())
-		}
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 441, Message: err.Error()}.String())
 	}
+	if queued {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 240, Message: "Article received OK, awaiting moderator approval"}.String())
+	}
 
 	return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 240, Message: "Article received OK"}.String())
 }
 
-func (h *Handler) saveArticle(envelope *enmime.Envelope, generateHeaders bool) error {
+// saveArticle stores the article posted by the client of the poster session, or relayed by the peer when poster
+// is nil, the peer is the user it has authenticated as or the name of the upstream. An unapproved article
+// to a moderated group is queued for the moderators if it has been posted, and refused if it has been relayed.
+// Either the article is stored completely or nothing of it is, attachment files written for it are removed
+// on failure.
+func (h *Handler) saveArticle(ctx context.Context, envelope *enmime.Envelope, poster *Session, peer string) (queued bool, err error) {
+	generateHeaders := poster != nil
+	origin := control.Origin{Peer: peer}
+	if poster != nil {
+		origin = control.Origin{User: poster.authenticatedUser}
+	}
+	groups := strings.Split(envelope.GetHeader("Newsgroups"), ",")
+	if !generateHeaders {
+		exists, err := h.backend.HasMessageID(ctx, envelope.GetHeader("Message-ID"))
+		if err != nil {
+			return false, err
+		}
+		if exists {
+			return false, backend.ErrDuplicate
+		}
+
+		// articles from other servers may be crossposted to groups we don't carry
+		groups, err = h.carriedGroups(ctx, groups)
+		if err != nil {
+			return false, err
+		}
+		if len(groups) == 0 {
+			return false, backend.ErrNoSuchGroup
+		}
+	}
+
+	a, err := h.buildArticle(ctx, envelope, generateHeaders)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			utils.RemoveAttachments(a.Attachments, h.uploadPath)
+		}
+	}()
+
+	g, err := h.unapprovedGroup(ctx, poster, a.Header.Get("Approved"), groups)
+	if err != nil {
+		return false, err
+	}
+	if g != nil {
+		if poster == nil {
+			return false, fmt.Errorf("%w %s", errUnapproved, g.GroupName)
+		}
+		_, err = h.backend.SavePendingArticle(ctx, a, g, poster.authenticatedUser)
+		return err == nil, err
+	}
+
+	groups, err = h.control.Process(ctx, &a, groups, origin)
+	if err != nil {
+		return false, err
+	}
+	if len(groups) == 0 {
+		// there is no group to file the control message into, but it must not be accepted again
+		if err := utils.RemoveAttachments(a.Attachments, h.uploadPath); err != nil {
+			return false, err
+		}
+		return false, h.backend.RememberMessageID(ctx, a.Header.Get("Message-ID"))
+	}
+
+	if err := h.backend.SaveArticle(ctx, a, groups); err != nil {
+		return false, err
+	}
+	// the replaced article is removed only once its replacement is stored
+	if err := h.control.Supersede(ctx, &a, origin); err != nil {
+		log.Printf("Failed to remove the article superseded by %s: %v", a.Header.Get("Message-ID"), err)
+	}
+	return false, nil
+}
+
+// carriedGroups returns the groups which exist on this server.
+func (h *Handler) carriedGroups(ctx context.Context, groups []string) ([]string, error) {
+	var carried []string
+	for _, v := range groups {
+		v = strings.TrimSpace(v)
+		if _, err := h.backend.GetGroup(ctx, v); err != nil {
+			if err == backend.ErrNoSuchGroup {
+				continue
+			}
+			return nil, err
+		}
+		carried = append(carried, v)
+	}
+	return carried, nil
+}
+
+// buildArticle makes an article from the received envelope and stores its attachments.
+func (h *Handler) buildArticle(ctx context.Context, envelope *enmime.Envelope, generateHeaders bool) (models.Article, error) {
 	if generateHeaders {
 		// generate message id
 		messageID := fmt.Sprintf("<%s@%s>", uuid.New().String(), h.serverDomain)
@@ -346,72 +543,103 @@ func (h *Handler) saveArticle(envelope *enmime.Envelope, generateHeaders bool) e
 
 		// set date header
 		envelope.AddHeader("Date", time.Now().UTC().Format(time.RFC1123Z))
+	} else {
+		// prepend ourselves to the path, so the article won't be sent back to us
+		if p := envelope.GetHeader("Path"); p != "" {
+			envelope.SetHeader("Path", []string{fmt.Sprintf("%s!%s", h.serverDomain, p)})
+		} else {
+			envelope.SetHeader("Path", []string{h.serverDomain})
+		}
 	}
 
+	a := models.Article{}
 	headerJson, err := json.Marshal(envelope.Root.Header)
 	if err != nil {
-		return err
+		return a, err
 	}
 
-	a := models.Article{}
 	a.HeaderRaw = string(headerJson)
 	a.Header = envelope.Root.Header
 	a.Envelope = envelope
+	a.Body = envelope.Text
 
-	if err != nil {
-		return err
+	// set thread properties
+	if err := h.setThread(ctx, &a, envelope); err != nil {
+		return a, err
 	}
-	a.Body = envelope.Text
 
-	// set thread property
-	if envelope.GetHeader("In-Reply-To") != "" {
-		parentMessage, err := h.backend.GetArticle(envelope.GetHeader("In-Reply-To"))
+	if len(envelope.Attachments) > 0 {
+		a.Attachments, err = h.saveAttachments(envelope)
 		if err != nil {
-			return err
-			if err == sql.ErrNoRows {
-				return fmt.Errorf("no such message you are replying to")
-			} else {
-				return err
-			}
-		}
-		if !parentMessage.Thread.Valid {
-			var parentHeader mail.Header
-			err = json.Unmarshal([]byte(parentMessage.HeaderRaw), &parentHeader)
-			parentMessageID := parentHeader.Get("Message-ID")
-			a.Thread = sql.NullString{String: parentMessageID, Valid: true}
-		} else {
-			a.Thread = parentMessage.Thread
+			return a, err
 		}
 	}
 
-	if len(envelope.Attachments) > 0 {
-		// save attachments
-		for _, v := range envelope.Attachments {
-			if v.ContentType != "image/jpeg" && v.ContentType != "image/png" && v.ContentType != "image/gif" {
-				return fmt.Errorf("disallowed attachment type")
-			}
-			ext_ := strings.Split(v.FileName, ".")
-			ext := ext_[len(ext_)-1]
-			fileName := uuid.New().String() + "." + ext
-			err = ioutil.WriteFile(path.Join(h.uploadPath, fileName), v.Content, 0644)
-			if err != nil {
-				return err
-			}
-			a.Attachments = append(a.Attachments, models.Attachment{
-				ContentType: v.ContentType,
-				FileName:    fileName,
-			})
+	return a, nil
+}
+
+// setThread sets the thread and the parent of the article. The parent is the last message-id from References,
+// or the one from In-Reply-To. The article joins the thread of its nearest ancestor which we have, when there
+// is none (e.g. it has expired or hasn't arrived from a peer yet) the oldest ancestor stands for the thread root
+// until it arrives. An article without ancestors starts a thread.
+func (h *Handler) setThread(ctx context.Context, a *models.Article, envelope *enmime.Envelope) error {
+	// an article can't be its own ancestor
+	self := envelope.GetHeader("Message-ID")
+	var ancestors []string
+	for _, v := range strings.Fields(envelope.GetHeader("References")) {
+		if v != self {
+			ancestors = append(ancestors, v)
 		}
 	}
-
-	err = h.backend.SaveArticle(a, strings.Split(a.Header.Get("Newsgroups"), ","))
-	if err != nil {
-		return err
+	if v := strings.TrimSpace(envelope.GetHeader("In-Reply-To")); len(ancestors) == 0 && v != "" && v != self {
+		ancestors = []string{v}
+	}
+	if len(ancestors) == 0 {
+		return nil
 	}
 
+	a.SetParent(ancestors[len(ancestors)-1])
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		ancestor, err := h.backend.GetArticle(ctx, ancestors[i])
+		if err == nil {
+			a.SetThread(ancestor.ThreadRoot())
+			return nil
+		}
+		if err != backend.ErrNoSuchArticle {
+			return err
+		}
+	}
+	a.SetThread(ancestors[0])
 	return nil
 }
 
+// errDisallowedAttachment is returned for an article with an attachment of a type which isn't accepted.
+var errDisallowedAttachment = errors.New("disallowed attachment type")
+
+// saveAttachments writes the attachments of the envelope into the upload directory. The files are staged
+// until the article is stored, the caller removes them if it fails. Nothing is left behind on error.
+func (h *Handler) saveAttachments(envelope *enmime.Envelope) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	for _, v := range envelope.Attachments {
+		if v.ContentType != "image/jpeg" && v.ContentType != "image/png" && v.ContentType != "image/gif" {
+			utils.RemoveAttachments(attachments, h.uploadPath)
+			return nil, errDisallowedAttachment
+		}
+		ext_ := strings.Split(v.FileName, ".")
+		ext := ext_[len(ext_)-1]
+		fileName := uuid.New().String() + "." + ext
+		if err := ioutil.WriteFile(path.Join(h.uploadPath, fileName), v.Content, 0644); err != nil {
+			utils.RemoveAttachments(append(attachments, models.Attachment{FileName: fileName}), h.uploadPath)
+			return nil, err
+		}
+		attachments = append(attachments, models.Attachment{
+			ContentType: v.ContentType,
+			FileName:    fileName,
+		})
+	}
+	return attachments, nil
+}
+
 func (h *Handler) handleListgroup(s *Session, command string, arguments []string, id uint) error {
 	s.tconn.StartResponse(id)
 	defer s.tconn.EndResponse(id)
@@ -419,13 +647,13 @@ func (h *Handler) handleListgroup(s *Session, command string, arguments []string
 	currentGroup := s.currentGroup
 	var low, high int64
 	if len(arguments) == 1 {
-		g, err := h.backend.GetGroup(arguments[0])
+		g, err := h.backend.GetGroup(s.ctx, arguments[0])
 		if err != nil {
 			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 411, Message: "No such newsgroup"}.String())
 		}
 		currentGroup = &g
 	} else if len(arguments) == 2 {
-		g, err := h.backend.GetGroup(arguments[0])
+		g, err := h.backend.GetGroup(s.ctx, arguments[0])
 		if err != nil {
 			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 411, Message: "No such newsgroup"}.String())
 		}
@@ -446,21 +674,29 @@ func (h *Handler) handleListgroup(s *Session, command string, arguments []string
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 412, Message: "No newsgroup selected"}.String())
 	}
 
-	highWaterMark, err := h.backend.GetGroupHighWaterMark(currentGroup)
-	if err != nil && err != sql.ErrNoRows {
+	rights, err := h.groupRights(s, currentGroup)
+	if err != nil {
+		return err
+	}
+	if !rights.CanRead {
+		return s.tconn.PrintfLine(h.groupAccessDenied(s).String())
+	}
+
+	highWaterMark, err := h.backend.GetGroupHighWaterMark(s.ctx, currentGroup)
+	if err != nil {
 		return err
 	}
-	lowWaterMark, err := h.backend.GetGroupLowWaterMark(currentGroup)
-	if err != nil && err != sql.ErrNoRows {
+	lowWaterMark, err := h.backend.GetGroupLowWaterMark(s.ctx, currentGroup)
+	if err != nil {
 		return err
 	}
-	articlesCount, err := h.backend.GetArticlesCount(currentGroup)
-	if err != nil && err != sql.ErrNoRows {
+	articlesCount, err := h.backend.GetArticlesCount(s.ctx, currentGroup)
+	if err != nil {
 		return err
 	}
 
-	nums, err := h.backend.GetArticleNumbers(currentGroup, low, high)
-	if err != nil && err != sql.ErrNoRows {
+	nums, err := h.backend.GetArticleNumbers(s.ctx, currentGroup, low, high)
+	if err != nil {
 		return err
 	}
 
@@ -504,9 +740,9 @@ func (h *Handler) handleArticle(s *Session, command string, arguments []string,
 	var a *models.Article
 
 	if getByArticleNum {
-		article, err := h.backend.GetArticleByNumber(s.currentGroup, num)
+		article, err := h.backend.GetArticleByNumber(s.ctx, s.currentGroup, num)
 		if err != nil {
-			if err == sql.ErrNoRows {
+			if err == backend.ErrNoSuchArticle {
 				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "No article with that number"}.String())
 			} else {
 				return err
@@ -515,14 +751,21 @@ func (h *Handler) handleArticle(s *Session, command string, arguments []string,
 		a = &article
 		s.currentArticle = &article
 	} else if len(arguments) > 0 {
-		article, err := h.backend.GetArticle(arguments[0])
+		article, err := h.backend.GetArticle(s.ctx, arguments[0])
 		if err != nil {
-			if err == sql.ErrNoRows {
+			if err == backend.ErrNoSuchArticle {
 				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 430, Message: "No Such Article Found"}.String())
 			} else {
 				return err
 			}
 		}
+		readable, err := h.canReadArticle(s, arguments[0], nil)
+		if err != nil {
+			return err
+		}
+		if !readable {
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 430, Message: "No Such Article Found"}.String())
+		}
 		a = &article
 		s.currentArticle = &article
 	} else {
@@ -534,18 +777,8 @@ func (h *Handler) handleArticle(s *Session, command string, arguments []string,
 	case protocol.CommandArticle:
 		{
 			dw := s.tconn.DotWriter()
-			builder := utils.Builder()
 			_, err = dw.Write([]byte(protocol.NNTPResponse{Code: 220, Message: fmt.Sprintf("%d %s article", num, a.Header.Get("Message-ID"))}.String() + protocol.CRLF))
-			for k, v := range a.Header {
-				for _, j := range v {
-					builder = builder.Header(k, j)
-				}
-			}
-			builder = builder.Text([]byte(a.Body))
-			for _, v := range a.Attachments {
-				builder = builder.AddFileAttachment(path.Join(h.uploadPath, v.FileName))
-			}
-			p, err := builder.Build()
+			p, err := utils.BuildArticle(a, h.uploadPath)
 			if err != nil {
 				return err
 			}
@@ -620,20 +853,28 @@ func (h *Handler) handleHelp(s *Session, command string, arguments []string, id
 		"  ARTICLE [message-ID|number]\r\n" +
 			"  BODY [message-ID|number]\r\n" +
 			"  CAPABILITIES [keyword]\r\n" +
+			"  CHECK message-ID\r\n" +
 			"  DATE\r\n" +
 			"  GROUP newsgroup\r\n" +
 			"  HEAD [message-ID|number]\r\n" +
 			"  HELP\r\n" +
+			"  IHAVE message-ID\r\n" +
 			"  LAST\r\n" +
-			"  LIST [ACTIVE [wildmat]|NEWSGROUPS [wildmat]]\r\n" +
+			"  HDR field [message-ID|range]\r\n" +
+			"  LIST [ACTIVE [wildmat]|ACTIVE.TIMES [wildmat]|COUNTS [wildmat]|DISTRIB.PATS|HEADERS [MSGID|RANGE]|\r\n" +
+			"        MOTD|NEWSGROUPS [wildmat]|OVERVIEW.FMT|SUBSCRIPTIONS]\r\n" +
 			"  LISTGROUP [newsgroup [range]]\r\n" +
 			"  MODE READER\r\n" +
+			"  MODE STREAM\r\n" +
 			"  NEWGROUPS [yy]yymmdd hhmmss [GMT]\r\n" +
 			"  NEWNEWS [yy]yymmdd hhmmss [GMT]\r\n" +
 			"  NEXT\r\n" +
 			"  POST\r\n" +
 			"  QUIT\r\n" +
-			"  STAT [message-ID|number]\r\n"
+			"  STARTTLS\r\n" +
+			"  STAT [message-ID|number]\r\n" +
+			"  TAKETHIS message-ID\r\n" +
+			"  XHDR field [message-ID|range]\r\n"
 
 	dw := s.tconn.DotWriter()
 	w := bufio.NewWriter(dw)
@@ -683,10 +924,22 @@ func (h *Handler) handleNewNews(s *Session, command string, arguments []string,
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
-	a, err := h.backend.GetNewArticlesSince(date.Unix())
+	messageIDs, err := h.backend.GetNewArticlesSince(s.ctx, date.Unix())
 	if err != nil {
 		return err
 	}
+	// only the articles from groups the client can read are listed
+	var a []string
+	rights := map[int]bool{}
+	for _, v := range messageIDs {
+		readable, err := h.canReadArticle(s, v, rights)
+		if err != nil {
+			return err
+		}
+		if readable {
+			a = append(a, v)
+		}
+	}
 
 	dw := s.tconn.DotWriter()
 	_, err = dw.Write([]byte(protocol.NNTPResponse{Code: 230, Message: "list of new articles by message-id follows"}.String() + protocol.CRLF))
@@ -719,7 +972,7 @@ func (h *Handler) handleLast(s *Session, command string, arguments []string, id
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 420, Message: "No current article selected"}.String())
 	}
 
-	low, err := h.backend.GetGroupLowWaterMark(s.currentGroup)
+	low, err := h.backend.GetGroupLowWaterMark(s.ctx, s.currentGroup)
 	if err != nil {
 		return err
 	}
@@ -728,9 +981,9 @@ func (h *Handler) handleLast(s *Session, command string, arguments []string, id
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 422, Message: "No previous article to retrieve"}.String())
 	}
 
-	a, err := h.backend.GetLastArticleByNum(s.currentGroup, s.currentArticle)
+	a, err := h.backend.GetLastArticleByNum(s.ctx, s.currentGroup, s.currentArticle)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == backend.ErrNoSuchArticle {
 			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 422, Message: "No previous article to retrieve"}.String())
 		}
 		return err
@@ -757,7 +1010,7 @@ func (h *Handler) handleNext(s *Session, command string, arguments []string, id
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 420, Message: "No current article selected"}.String())
 	}
 
-	high, err := h.backend.GetGroupHighWaterMark(s.currentGroup)
+	high, err := h.backend.GetGroupHighWaterMark(s.ctx, s.currentGroup)
 	if err != nil {
 		return err
 	}
@@ -766,9 +1019,9 @@ func (h *Handler) handleNext(s *Session, command string, arguments []string, id
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 421, Message: "No next article to retrieve"}.String())
 	}
 
-	a, err := h.backend.GetNextArticleByNum(s.currentGroup, s.currentArticle)
+	a, err := h.backend.GetNextArticleByNum(s.ctx, s.currentGroup, s.currentArticle)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == backend.ErrNoSuchArticle {
 			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 421, Message: "No next article to retrieve"}.String())
 		}
 		return err
@@ -783,111 +1036,114 @@ func (h *Handler) handleOver(s *Session, command string, arguments []string, id
 	s.tconn.StartResponse(id)
 	defer s.tconn.EndResponse(id)
 
+	if len(arguments) > 1 {
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
 	if len(arguments) == 0 && s.currentArticle == nil {
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 420, Message: "No current article selected"}.String())
 	}
 
-	byRange := false
-	byNum := false
-	byMsgID := false
-	curArticle := false
-
 	if len(arguments) == 1 {
-		if _, _, err := utils.ParseRange(arguments[0]); err == nil {
-			byRange = true
-		} else if strings.ContainsAny(arguments[0], "<>") {
-			byMsgID = true
-		} else if _, err := strconv.Atoi(arguments[0]); err == nil {
-			byNum = true
-		}
-	} else if len(arguments) == 0 {
-		curArticle = true
-	} else {
-		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
-	}
-
-	var articles []models.Article
-
-	if byRange {
-		if s.currentGroup == nil {
-			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 412, Message: "No newsgroup selected"}.String())
+		if low, high, err := utils.ParseRange(arguments[0]); err == nil {
+			return h.writeOverviewRange(s, low, high)
+		}
+		if !strings.ContainsAny(arguments[0], "<>") {
+			return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 		}
+	}
 
-		low, high, err := utils.ParseRange(arguments[0])
+	var o models.Overview
+	if len(arguments) == 1 {
+		a, err := h.backend.GetArticle(s.ctx, arguments[0])
 		if err != nil {
+			if err == backend.ErrNoSuchArticle {
+				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 430, Message: "No such article with that message-id"}.String())
+			}
 			return err
 		}
-		if low > high {
-			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "Empty range"}.String())
-		}
-		a, err := h.backend.GetArticlesByRange(s.currentGroup, low, high)
+		readable, err := h.canReadArticle(s, arguments[0], nil)
 		if err != nil {
-			if err == sql.ErrNoRows {
-				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "No articles in that range"}.String())
-			}
 			return err
 		}
-		articles = append(articles, a...)
-	} else if byMsgID {
-		a, err := h.backend.GetArticle(arguments[0])
-		if err != nil {
-			if err == sql.ErrNoRows {
-				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 430, Message: "No such article with that message-id"}.String())
-			}
+		if !readable {
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 430, Message: "No such article with that message-id"}.String())
+		}
+		if o, err = utils.NewOverview(&a, 0); err != nil {
 			return err
 		}
-		a.ArticleNumber = 0
-		articles = append(articles, a)
-	} else if byNum {
-		num, _ := strconv.Atoi(arguments[0])
-		a, err := h.backend.GetArticleByNumber(s.currentGroup, num)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "No such article in this group"}.String())
-			}
+	} else {
+		var err error
+		if o, err = utils.NewOverview(s.currentArticle, s.currentArticle.ArticleNumber); err != nil {
 			return err
 		}
-		articles = append(articles, a)
-	} else if curArticle {
-		articles = append(articles, *s.currentArticle)
 	}
 
 	dw := s.tconn.DotWriter()
 	dw.Write([]byte(protocol.NNTPResponse{Code: 224, Message: "Overview information follows" + protocol.CRLF}.String()))
-	for _, v := range articles {
-		dw.Write([]byte(strconv.Itoa(v.ArticleNumber) + "	"))
-		dw.Write([]byte(v.Header.Get("Subject") + "	"))
-		dw.Write([]byte(v.Header.Get("From") + "	"))
-		dw.Write([]byte(v.Header.Get("Date") + "	"))
-		dw.Write([]byte(v.Header.Get("Message-ID") + "	"))
-		dw.Write([]byte(v.Header.Get("References") + "	"))
-
-		// count bytes for message
-		builder := utils.Builder()
-		for k, v := range v.Header {
-			for _, j := range v {
-				builder = builder.Header(k, j)
+	writeOverview(dw, o)
+	return dw.Close()
+}
+
+// writeOverviewRange streams the overview records of the current group in the range given by ParseRange.
+func (h *Handler) writeOverviewRange(s *Session, low, high int64) error {
+	if s.currentGroup == nil {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 412, Message: "No newsgroup selected"}.String())
+	}
+
+	single := low == -1
+	low, high, err := h.resolveRange(s, low, high)
+	if err != nil {
+		return err
+	}
+	if low > high {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "Empty range"}.String())
+	}
+
+	var dw io.WriteCloser
+	err = h.backend.GetOverview(s.ctx, s.currentGroup, low, high, func(o models.Overview) error {
+		if dw == nil {
+			dw = s.tconn.DotWriter()
+			if _, err := dw.Write([]byte(protocol.NNTPResponse{Code: 224, Message: "Overview information follows" + protocol.CRLF}.String())); err != nil {
+				return err
 			}
 		}
-		builder = builder.Text([]byte(v.Body)) // FIXME currently only plain text is supported
-		b := bytes.NewBuffer([]byte{})
-		p, err := builder.Build()
+		return writeOverview(dw, o)
+	})
+	if dw == nil {
 		if err != nil {
 			return err
 		}
-		err = p.Encode(b)
-		if err != nil {
-			return err
+		if single {
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "No such article in this group"}.String())
 		}
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "No articles in that range"}.String())
+	}
+	if err != nil {
+		// the response has been started already, so the only option is to drop the connection
+		dw.Close()
+		return err
+	}
+	return dw.Close()
+}
 
-		bytesMetadata := b.Len()
-		linesMetadata := strings.Count(v.Body, "\n")
-
-		dw.Write([]byte(strconv.Itoa(bytesMetadata) + "	"))
-		dw.Write([]byte(strconv.Itoa(linesMetadata) + protocol.CRLF))
+// resolveRange turns the bounds returned by ParseRange into the inclusive ones within the current group.
+func (h *Handler) resolveRange(s *Session, low, high int64) (int64, int64, error) {
+	if low == -1 {
+		return high, high, nil
 	}
+	if high == -1 {
+		hwm, err := h.backend.GetGroupHighWaterMark(s.ctx, s.currentGroup)
+		if err != nil {
+			return 0, 0, err
+		}
+		high = int64(hwm)
+	}
+	return low, high, nil
+}
 
-	return dw.Close()
+func writeOverview(w io.Writer, o models.Overview) error {
+	_, err := fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%d"+protocol.CRLF, o.Number, o.Subject, o.From, o.Date, o.MessageID, o.References, o.Bytes, o.Lines)
+	return err
 }
 
 func (h *Handler) handleNewThreads(s *Session, command string, arguments []string, id uint) error {
@@ -898,7 +1154,7 @@ func (h *Handler) handleNewThreads(s *Session, command string, arguments []strin
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 412, Message: "no newsgroup selected"}.String())
 	}
 
-	if len(arguments) == 0 {
+	if len(arguments) < 2 || len(arguments) > 3 {
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
@@ -910,12 +1166,17 @@ func (h *Handler) handleNewThreads(s *Session, command string, arguments []strin
 	if err != nil {
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
+	order := models.ThreadOrderCreated
+	if len(arguments) == 3 {
+		if strings.ToUpper(arguments[2]) != "LASTREPLY" {
+			return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+		}
+		order = models.ThreadOrderLastReply
+	}
 
-	threadNums, err := h.backend.GetNewThreads(s.currentGroup, perPage, pageNum)
+	threadNums, err := h.backend.GetNewThreads(s.ctx, s.currentGroup, perPage, pageNum, order)
 	if err != nil {
-		if err != sql.ErrNoRows {
-			return err
-		}
+		return err
 	}
 
 	dw := s.tconn.DotWriter()
@@ -934,7 +1195,7 @@ func (h *Handler) handleThread(s *Session, command string, arguments []string, i
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 412, Message: "no newsgroup selected"}.String())
 	}
 
-	if len(arguments) == 0 {
+	if len(arguments) == 0 || len(arguments) > 2 {
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
@@ -942,12 +1203,16 @@ func (h *Handler) handleThread(s *Session, command string, arguments []string, i
 	if err != nil {
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
+	if len(arguments) == 2 {
+		if strings.ToUpper(arguments[1]) != "TREE" {
+			return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+		}
+		return h.writeThreadTree(s, threadNumber)
+	}
 
-	threadNums, err := h.backend.GetThread(s.currentGroup, threadNumber)
+	threadNums, err := h.backend.GetThread(s.ctx, s.currentGroup, threadNumber)
 	if err != nil {
-		if err != sql.ErrNoRows {
-			return err
-		}
+		return err
 	}
 
 	dw := s.tconn.DotWriter()
@@ -958,6 +1223,25 @@ func (h *Handler) handleThread(s *Session, command string, arguments []string, i
 	return dw.Close()
 }
 
+// writeThreadTree lists the articles of the thread depth-first as "number parent depth" lines,
+// the parent of the root is 0.
+func (h *Handler) writeThreadTree(s *Session, threadNumber int) error {
+	nodes, err := h.backend.GetThreadTree(s.ctx, s.currentGroup, threadNumber)
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "No such article in this group"}.String())
+	}
+
+	dw := s.tconn.DotWriter()
+	dw.Write([]byte(protocol.NNTPResponse{Code: 226, Message: "Thread tree follows" + protocol.CRLF}.String()))
+	for _, v := range nodes {
+		dw.Write([]byte(fmt.Sprintf("%d %d %d"+protocol.CRLF, v.Number, v.Parent, v.Depth)))
+	}
+	return dw.Close()
+}
+
 func (h *Handler) handleIHave(s *Session, command string, arguments []string, id uint) error {
 	s.tconn.StartResponse(id)
 	defer s.tconn.EndResponse(id)
@@ -966,10 +1250,12 @@ func (h *Handler) handleIHave(s *Session, command string, arguments []string, id
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
-	if _, err := h.backend.GetArticle(arguments[0]); err == nil {
+	exists, err := h.backend.HasMessageID(s.ctx, arguments[0])
+	if err != nil {
+		return err
+	}
+	if exists {
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 435, Message: "Duplicate"}.String())
-	} else {
-		log.Print(err.Error())
 	}
 
 	if err := s.tconn.PrintfLine(protocol.NNTPResponse{Code: 335, Message: "Send it; end with <CR-LF>.<CR-LF>"}.String()); err != nil {
@@ -977,26 +1263,135 @@ func (h *Handler) handleIHave(s *Session, command string, arguments []string, id
 	}
 	// TODO restrict sending the same article from other users
 
-	dr := s.tconn.DotReader()
-
-	envelope, err := enmime.ReadEnvelope(dr)
+	err = h.receiveArticle(s, arguments[0])
 	if err != nil {
-		return err
+		te, ok := err.(*transferError)
+		if !ok {
+			return err
+		}
+		if te.retry {
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 436, Message: fmt.Sprintf("Transfer failed: %s", te.reason)}.String())
+		}
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 437, Message: fmt.Sprintf("Article rejected: %s", te.reason)}.String())
+	}
+
+	return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 235, Message: "Article transferred OK"}.String())
+}
+
+func (h *Handler) handleAuthInfo(s *Session, command string, arguments []string, id uint) error {
+	s.tconn.StartResponse(id)
+	defer s.tconn.EndResponse(id)
+
+	if len(arguments) < 2 {
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
-	msgID := envelope.GetHeader("Message-ID")
-	if msgID == "" {
-		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 436, Message: "Transfer failed"}.String())
+	if h.authProvider == nil {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 503, Message: "Authentication is not supported"}.String())
 	}
-	// TODO also check whether message id in the article is the same as was previously
 
-	err = h.saveArticle(envelope, false)
-	if err != nil {
-		// TODO add proper error handling
-		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 436, Message: fmt.Sprintf("Transfer failed: %s", err.Error())}.String())
+	if s.authenticatedUser != "" {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 502, Message: "Already authenticated"}.String())
 	}
 
-	return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 235, Message: "Article transferred OK"}.String())
+	// user names and passwords may contain spaces
+	value := strings.Join(arguments[1:], " ")
+
+	subcommand := strings.ToUpper(arguments[0])
+	cleartext := subcommand == "USER" || subcommand == "PASS" || (subcommand == "SASL" && cleartextMechanisms[strings.ToUpper(arguments[1])])
+	if cleartext && !h.cleartextAuthAllowed(s.isTLS()) {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 483, Message: "Encryption required, use STARTTLS first"}.String())
+	}
+
+	switch subcommand {
+	case "USER":
+		{
+			s.pendingUsername = value
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 381, Message: "Password required"}.String())
+		}
+	case "PASS":
+		{
+			if s.pendingUsername == "" {
+				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 482, Message: "Authentication commands issued out of sequence"}.String())
+			}
+			username := s.pendingUsername
+			s.pendingUsername = ""
+
+			ok, err := h.authProvider.Authenticate(s.ctx, username, value)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				log.Printf("Client %s has failed to authenticate as %s", s.remoteAddr, username)
+				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 481, Message: "Authentication failed/rejected"}.String())
+			}
+			banned, err := isUserBanned(s.ctx, h.backend, username)
+			if err != nil {
+				return err
+			}
+			if banned {
+				log.Printf("Client %s has tried to authenticate as banned user %s", s.remoteAddr, username)
+				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 481, Message: "Authentication failed/rejected"}.String())
+			}
+
+			s.setAuthenticated(username)
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 281, Message: "Authentication accepted"}.String())
+		}
+	case "SASL":
+		{
+			return h.startSASL(s, arguments[1:])
+		}
+	default:
+		{
+			return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+		}
+	}
+}
+
+func (h *Handler) handleStartTLS(s *Session, command string, arguments []string, id uint) error {
+	s.tconn.StartResponse(id)
+	defer s.tconn.EndResponse(id)
+
+	if len(arguments) != 0 {
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+
+	if s.isTLS() || s.authenticatedUser != "" {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 502, Message: "Command unavailable"}.String())
+	}
+
+	if h.tlsConfig == nil {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 580, Message: "Can not initiate TLS negotiation"}.String())
+	}
+
+	if n := s.tconn.R.Buffered(); n != 0 {
+		// the commands sent along with STARTTLS could have been injected by a man in the middle,
+		// they mustn't be run either before or after the negotiation (RFC 4642, section 2.2.2)
+		s.tconn.R.Discard(n)
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 580, Message: "Can not initiate TLS negotiation, data has been sent after STARTTLS"}.String())
+	}
+
+	if err := s.tconn.PrintfLine(protocol.NNTPResponse{Code: 382, Message: "Continue with TLS negotiation"}.String()); err != nil {
+		return err
+	}
+
+	tlsConn := tls.Server(s.conn, h.tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+
+	// the client must not rely on anything it has learnt before the negotiation and vice versa
+	s.mu.Lock()
+	s.conn = tlsConn
+	s.currentGroup = nil
+	s.mu.Unlock()
+	s.tconn = textproto.NewConn(tlsConn)
+	s.capabilities = h.defaultCapabilities(true)
+	s.mode = SessionModeTransit
+	s.currentArticle = nil
+	s.pendingUsername = ""
+
+	return nil
 }
 
 func (h *Handler) Handle(s *Session, message string, id uint) error {
@@ -1011,5 +1406,10 @@ func (h *Handler) Handle(s *Session, message string, id uint) error {
 		defer s.tconn.EndResponse(id)
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 500, Message: "Unknown command"}.String())
 	}
+	if h.authRequired[cmdName] && s.authenticatedUser == "" {
+		s.tconn.StartResponse(id)
+		defer s.tconn.EndResponse(id)
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 480, Message: "Authentication required"}.String())
+	}
 	return handler(s, cmdName, splittedMessage[1:], id)
 }
@@ -0,0 +1,453 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/ChronosX88/yans/internal/auth"
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/backend/memory"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/control"
+	"github.com/ChronosX88/yans/internal/models"
+)
+
+var ctx = context.Background()
+
+// testClient talks to a session of the handler over an in-memory connection.
+type testClient struct {
+	t *testing.T
+	*textproto.Conn
+}
+
+func testConfig(t *testing.T) config.Config {
+	return config.Config{
+		Domain:     "example.org",
+		UploadPath: t.TempDir(),
+		ACL: config.ACLConfig{
+			AnonymousRead:     true,
+			AnonymousPost:     true,
+			AuthenticatedRead: true,
+			AuthenticatedPost: true,
+		},
+	}
+}
+
+func newTestClient(t *testing.T, b backend.StorageBackend, cfg config.Config, authProvider auth.CredentialProvider) *testClient {
+	t.Helper()
+	cp, err := control.NewProcessor(b, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(b, cfg, authProvider, nil, cp)
+
+	serverConn, clientConn := net.Pipe()
+	closed := make(chan bool)
+	if _, err := NewSession(ctx, serverConn, "pipe", h.defaultCapabilities(false), "test", closed, h); err != nil {
+		t.Fatal(err)
+	}
+	c := &testClient{t: t, Conn: textproto.NewConn(clientConn)}
+	t.Cleanup(func() {
+		c.Close()
+		<-closed
+	})
+
+	if _, _, err := c.ReadCodeLine(2); err != nil {
+		t.Fatalf("greeting: %v", err)
+	}
+	return c
+}
+
+// cmd sends the command and returns the message of the response, which must have the expected code.
+func (c *testClient) cmd(expectCode int, format string, args ...interface{}) string {
+	c.t.Helper()
+	if err := c.PrintfLine(format, args...); err != nil {
+		c.t.Fatal(err)
+	}
+	_, msg, err := c.ReadCodeLine(expectCode)
+	if err != nil {
+		c.t.Fatalf("%s: %v", strings.SplitN(format, " ", 2)[0], err)
+	}
+	return msg
+}
+
+// lines reads the multi-line block which follows the response.
+func (c *testClient) lines() []string {
+	c.t.Helper()
+	lines, err := c.ReadDotLines()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return lines
+}
+
+func (c *testClient) post(lines ...string) {
+	c.t.Helper()
+	c.cmd(340, "POST")
+	dw := c.DotWriter()
+	dw.Write([]byte(strings.Join(lines, "\r\n") + "\r\n"))
+	if err := dw.Close(); err != nil {
+		c.t.Fatal(err)
+	}
+	if _, _, err := c.ReadCodeLine(240); err != nil {
+		c.t.Fatalf("POST: %v", err)
+	}
+}
+
+func createGroup(t *testing.T, b backend.StorageBackend, name string) models.Group {
+	t.Helper()
+	if err := b.CreateGroup(ctx, models.Group{GroupName: name}); err != nil {
+		t.Fatal(err)
+	}
+	g, err := b.GetGroup(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestGroup(t *testing.T) {
+	b := memory.NewMemoryBackend()
+	createGroup(t, b, "misc.test")
+	c := newTestClient(t, b, testConfig(t), nil)
+
+	c.cmd(411, "GROUP misc.nonexistent")
+	c.cmd(501, "GROUP")
+	c.cmd(412, "ARTICLE 1")
+
+	c.post("From: poster@example.org", "Newsgroups: misc.test", "Subject: first", "", "body")
+	c.post("From: poster@example.org", "Newsgroups: misc.test", "Subject: second", "", "body")
+	if msg := c.cmd(211, "GROUP misc.test"); msg != "2 1 2 misc.test" {
+		t.Errorf("GROUP: got %q, want %q", msg, "2 1 2 misc.test")
+	}
+}
+
+func TestPostAndArticle(t *testing.T) {
+	b := memory.NewMemoryBackend()
+	createGroup(t, b, "misc.test")
+	c := newTestClient(t, b, testConfig(t), nil)
+
+	c.post("From: poster@example.org", "Newsgroups: misc.test", "Subject: hello", "", "first line", "second line")
+	c.cmd(211, "GROUP misc.test")
+
+	msg := c.cmd(220, "ARTICLE 1")
+	fields := strings.Fields(msg)
+	if len(fields) < 2 || fields[0] != "1" || !strings.HasSuffix(fields[1], "@example.org>") {
+		t.Fatalf("ARTICLE: got %q, want the number and the generated message id", msg)
+	}
+	messageID := fields[1]
+	lines := c.lines()
+	header, body := lines, []string(nil)
+	for i, v := range lines {
+		if v == "" {
+			header, body = lines[:i], lines[i+1:]
+			break
+		}
+	}
+	if headerValue(header, "Subject") != "hello" || headerValue(header, "Message-ID") != messageID {
+		t.Errorf("ARTICLE: header %q lacks Subject or Message-ID", header)
+	}
+	if strings.Join(body, "\n") != "first line\nsecond line" {
+		t.Errorf("ARTICLE: got body %q", body)
+	}
+
+	c.cmd(223, "STAT %s", messageID)
+	c.cmd(423, "STAT 2")
+	c.cmd(430, "ARTICLE <nonexistent@example.org>")
+}
+
+func TestPostRefused(t *testing.T) {
+	b := memory.NewMemoryBackend()
+	g := createGroup(t, b, "misc.test")
+	cfg := testConfig(t)
+	cfg.ACL.AnonymousPost = false
+	c := newTestClient(t, b, cfg, nil)
+
+	c.cmd(340, "POST")
+	dw := c.DotWriter()
+	dw.Write([]byte("From: poster@example.org\r\nNewsgroups: misc.test\r\nSubject: s\r\n\r\nbody\r\n"))
+	if err := dw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.ReadCodeLine(441); err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	if n, err := b.GetArticlesCount(ctx, &g); err != nil || n != 0 {
+		t.Errorf("GetArticlesCount: got %d, %v, want 0", n, err)
+	}
+}
+
+func TestPostDisallowedAttachment(t *testing.T) {
+	b := memory.NewMemoryBackend()
+	g := createGroup(t, b, "misc.test")
+	c := newTestClient(t, b, testConfig(t), nil)
+
+	c.cmd(340, "POST")
+	dw := c.DotWriter()
+	dw.Write([]byte(strings.Join([]string{
+		"From: poster@example.org",
+		"Newsgroups: misc.test",
+		"Subject: attachment",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/mixed; boundary="b"`,
+		"",
+		"--b",
+		"Content-Type: text/plain",
+		"",
+		"body",
+		"--b",
+		"Content-Type: application/octet-stream",
+		`Content-Disposition: attachment; filename="run.exe"`,
+		"",
+		"data",
+		"--b--",
+	}, "\r\n") + "\r\n"))
+	if err := dw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, msg, err := c.ReadCodeLine(441); err != nil || msg != errDisallowedAttachment.Error() {
+		t.Fatalf("POST: got %q, %v, want 441 %s", msg, err, errDisallowedAttachment)
+	}
+	if n, err := b.GetArticlesCount(ctx, &g); err != nil || n != 0 {
+		t.Errorf("GetArticlesCount: got %d, %v, want 0", n, err)
+	}
+}
+
+func TestArticleAfterRename(t *testing.T) {
+	b := memory.NewMemoryBackend()
+	g := createGroup(t, b, "misc.test")
+	c := newTestClient(t, b, testConfig(t), nil)
+
+	c.post("From: poster@example.org", "Newsgroups: misc.test", "Subject: hello", "", "body")
+	c.cmd(211, "GROUP misc.test")
+	messageID := strings.Fields(c.cmd(223, "STAT 1"))[1]
+
+	// the Newsgroups header keeps the old name
+	g.GroupName = "misc.renamed"
+	if err := b.UpdateGroup(ctx, g); err != nil {
+		t.Fatal(err)
+	}
+	c.cmd(220, "ARTICLE %s", messageID)
+	c.lines()
+	c.cmd(223, "STAT %s", messageID)
+	c.cmd(230, "NEWNEWS 19700101 000000")
+	if lines := c.lines(); len(lines) != 1 || lines[0] != messageID {
+		t.Errorf("NEWNEWS: got %q, want %s", lines, messageID)
+	}
+}
+
+func TestOver(t *testing.T) {
+	b := memory.NewMemoryBackend()
+	createGroup(t, b, "misc.test")
+	c := newTestClient(t, b, testConfig(t), nil)
+
+	c.cmd(412, "OVER 1-2")
+	for _, v := range []string{"first", "second", "third"} {
+		c.post("From: poster@example.org", "Newsgroups: misc.test", "Subject: "+v, "", "body")
+	}
+	c.cmd(211, "GROUP misc.test")
+
+	c.cmd(224, "OVER 2-")
+	lines := c.lines()
+	if len(lines) != 2 {
+		t.Fatalf("OVER 2-: got %d lines, want 2", len(lines))
+	}
+	for i, v := range lines {
+		fields := strings.Split(v, "\t")
+		if len(fields) < 8 {
+			t.Fatalf("OVER 2-: malformed line %q", v)
+		}
+		if want := []string{"2", "3"}[i]; fields[0] != want {
+			t.Errorf("OVER 2-: line %d has number %s, want %s", i, fields[0], want)
+		}
+		if want := []string{"second", "third"}[i]; fields[1] != want {
+			t.Errorf("OVER 2-: line %d has subject %s, want %s", i, fields[1], want)
+		}
+	}
+
+	c.cmd(423, "OVER 10-20")
+	c.cmd(501, "OVER 1 2")
+}
+
+func TestAuthInfo(t *testing.T) {
+	b := memory.NewMemoryBackend()
+	u, err := auth.NewUser("alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SaveUser(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, b, testConfig(t), auth.NewBackendProvider(b))
+
+	c.cmd(482, "AUTHINFO PASS secret")
+	c.cmd(381, "AUTHINFO USER alice")
+	c.cmd(481, "AUTHINFO PASS wrong")
+	c.cmd(381, "AUTHINFO USER nobody")
+	c.cmd(481, "AUTHINFO PASS secret")
+	c.cmd(381, "AUTHINFO USER alice")
+	c.cmd(281, "AUTHINFO PASS secret")
+	c.cmd(502, "AUTHINFO USER alice")
+}
+
+func TestAuthInfoUnsupported(t *testing.T) {
+	c := newTestClient(t, memory.NewMemoryBackend(), testConfig(t), nil)
+	c.cmd(503, "AUTHINFO USER alice")
+}
+
+func TestGroupACL(t *testing.T) {
+	b := memory.NewMemoryBackend()
+	g := createGroup(t, b, "private.test")
+	for _, v := range []models.ACLEntry{
+		{GroupID: g.ID, Username: models.ACLAnonymous},
+		{GroupID: g.ID, Username: "alice", CanRead: true},
+	} {
+		if err := b.SaveACLEntry(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	u, err := auth.NewUser("alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SaveUser(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, b, testConfig(t), auth.NewBackendProvider(b))
+
+	// anonymous clients are asked to authenticate
+	c.cmd(480, "GROUP private.test")
+	c.cmd(381, "AUTHINFO USER alice")
+	c.cmd(281, "AUTHINFO PASS secret")
+	c.cmd(211, "GROUP private.test")
+}
+
+func TestListActiveTimes(t *testing.T) {
+	b := memory.NewMemoryBackend()
+	createGroup(t, b, "misc.test")
+	if err := b.CreateGroup(ctx, models.Group{GroupName: "misc.created", Creator: "admin@example.org"}); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, b, testConfig(t), nil)
+
+	c.cmd(215, "LIST ACTIVE.TIMES misc.*")
+	creators := map[string]string{}
+	for _, v := range c.lines() {
+		if fields := strings.Fields(v); len(fields) == 3 {
+			creators[fields[0]] = fields[2]
+		}
+	}
+	for group, want := range map[string]string{"misc.test": "news@example.org", "misc.created": "admin@example.org"} {
+		if creators[group] != want {
+			t.Errorf("LIST ACTIVE.TIMES: got creator %q of %s, want %q", creators[group], group, want)
+		}
+	}
+}
+
+// loggedInClient returns a client authenticated as the user, other users may be added to the backend.
+func loggedInClient(t *testing.T, b backend.StorageBackend, cfg config.Config, username string, others ...string) *testClient {
+	t.Helper()
+	for _, v := range append([]string{username}, others...) {
+		u, err := auth.NewUser(v, "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.SaveUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := newTestClient(t, b, cfg, auth.NewBackendProvider(b))
+	c.cmd(381, "AUTHINFO USER %s", username)
+	c.cmd(281, "AUTHINFO PASS secret")
+	return c
+}
+
+func TestControlForgedSender(t *testing.T) {
+	b := memory.NewMemoryBackend()
+	cfg := testConfig(t)
+	cfg.Control.TrustedSenders = []string{"admin@example.org"}
+
+	// alice types in the address of the trusted sender
+	c := loggedInClient(t, b, cfg, "alice", "admin")
+	c.post("From: admin@example.org", "Newsgroups: misc.new", "Subject: cmsg newgroup misc.new", "Control: newgroup misc.new", "", "newgroup")
+	if _, err := b.GetGroup(ctx, "misc.new"); err != backend.ErrNoSuchGroup {
+		t.Errorf("GetGroup of the group created by forged sender: got %v, want %v", err, backend.ErrNoSuchGroup)
+	}
+
+	admin := loggedInClient(t, b, cfg, "admin")
+	admin.post("From: Admin <Admin@example.org>", "Newsgroups: misc.new", "Subject: cmsg newgroup misc.new", "Control: newgroup misc.new", "", "newgroup")
+	if _, err := b.GetGroup(ctx, "misc.new"); err != nil {
+		t.Errorf("GetGroup of the group created by trusted sender: %v", err)
+	}
+}
+
+func TestCancelForgedSender(t *testing.T) {
+	b := memory.NewMemoryBackend()
+	createGroup(t, b, "misc.test")
+	cfg := testConfig(t)
+
+	bob := loggedInClient(t, b, cfg, "bob", "alice")
+	bob.post("From: bob@example.org", "Newsgroups: misc.test", "Subject: mine", "", "body")
+	bob.cmd(211, "GROUP misc.test")
+	target := strings.Fields(bob.cmd(223, "STAT 1"))[1]
+
+	// alice copies the sender of the target
+	alice := loggedInClient(t, b, cfg, "alice")
+	alice.post("From: bob@example.org", "Newsgroups: misc.test", "Subject: cmsg cancel "+target, "Control: cancel "+target, "", "cancel")
+	if _, err := b.GetArticle(ctx, target); err != nil {
+		t.Errorf("GetArticle of the article cancelled by forged sender: %v", err)
+	}
+
+	bob.post("From: bob@example.org", "Newsgroups: misc.test", "Subject: cmsg cancel "+target, "Control: cancel "+target, "", "cancel")
+	if _, err := b.GetArticle(ctx, target); err != backend.ErrNoSuchArticle {
+		t.Errorf("GetArticle of the article cancelled by its sender: got %v, want %v", err, backend.ErrNoSuchArticle)
+	}
+}
+
+func TestCheckGroupsKeepsUnlisted(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		remove  bool
+		control string
+		kept    bool
+	}{
+		{"implicit scope", true, "checkgroups", true},
+		{"removal disabled", false, "checkgroups comp", true},
+		{"explicit scope", true, "checkgroups comp #1", false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			b := memory.NewMemoryBackend()
+			createGroup(t, b, "comp.lang.go")
+			createGroup(t, b, "comp.lang.c")
+			cfg := testConfig(t)
+			cfg.Control.TrustedSenders = []string{"admin@example.org"}
+			cfg.Control.CheckGroupsRemove = c.remove
+
+			admin := loggedInClient(t, b, cfg, "admin")
+			admin.post("From: admin@example.org", "Newsgroups: comp.lang.go", "Subject: cmsg "+c.control, "Control: "+c.control, "",
+				"comp.lang.go\tThe Go language")
+			_, err := b.GetGroup(ctx, "comp.lang.c")
+			if c.kept && err != nil {
+				t.Errorf("GetGroup of unlisted group: %v", err)
+			} else if !c.kept && err != backend.ErrNoSuchGroup {
+				t.Errorf("GetGroup of unlisted group: got %v, want %v", err, backend.ErrNoSuchGroup)
+			}
+			if g, err := b.GetGroup(ctx, "comp.lang.go"); err != nil || g.Description == nil || *g.Description != "The Go language" {
+				t.Errorf("GetGroup of listed group: got %+v, %v", g, err)
+			}
+		})
+	}
+}
+
+// headerValue returns the value of the field from the header lines, field names are case-insensitive.
+func headerValue(lines []string, field string) string {
+	for _, v := range lines {
+		if kv := strings.SplitN(v, ": ", 2); len(kv) == 2 && strings.EqualFold(kv[0], field) {
+			return kv[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/protocol"
+	"github.com/ChronosX88/yans/internal/utils"
+)
+
+// hdrWriter writes the response of HDR or XHDR, the initial line is sent along with the first field.
+type hdrWriter struct {
+	s        *Session
+	response protocol.NNTPResponse
+	dw       io.WriteCloser
+}
+
+func (w *hdrWriter) write(key, value string) error {
+	if w.dw == nil {
+		w.dw = w.s.tconn.DotWriter()
+		if _, err := w.dw.Write([]byte(w.response.String() + protocol.CRLF)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w.dw, "%s %s"+protocol.CRLF, key, value)
+	return err
+}
+
+// articleField returns the value of the header or the metadata item of the article.
+func articleField(a *models.Article, field string) (string, error) {
+	if _, ok := utils.OverviewField(models.Overview{}, field); ok {
+		o, err := utils.NewOverview(a, a.ArticleNumber)
+		if err != nil {
+			return "", err
+		}
+		v, _ := utils.OverviewField(o, field)
+		return v, nil
+	}
+	return utils.SanitizeField(a.Header.Get(field)), nil
+}
+
+func (h *Handler) handleHdr(s *Session, command string, arguments []string, id uint) error {
+	s.tconn.StartResponse(id)
+	defer s.tconn.EndResponse(id)
+
+	if len(arguments) == 0 || len(arguments) > 2 {
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+	field := arguments[0]
+	if _, ok := utils.OverviewField(models.Overview{}, field); !ok && strings.HasPrefix(field, ":") {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 503, Message: "Unsupported metadata item"}.String())
+	}
+
+	xhdr := command == protocol.CommandXhdr
+	w := &hdrWriter{s: s, response: protocol.NNTPResponse{Code: 225, Message: "Headers follow"}}
+	if xhdr {
+		w.response = protocol.NNTPResponse{Code: 221, Message: fmt.Sprintf("%s fields follow", field)}
+	}
+
+	if len(arguments) == 2 {
+		if low, high, err := utils.ParseRange(arguments[1]); err == nil {
+			return h.writeHdrRange(s, w, field, low, high)
+		}
+		if !strings.ContainsAny(arguments[1], "<>") {
+			return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+		}
+
+		a, err := h.backend.GetArticle(s.ctx, arguments[1])
+		if err != nil {
+			if err == backend.ErrNoSuchArticle {
+				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 430, Message: "No such article with that message-id"}.String())
+			}
+			return err
+		}
+		readable, err := h.canReadArticle(s, arguments[1], nil)
+		if err != nil {
+			return err
+		}
+		if !readable {
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 430, Message: "No such article with that message-id"}.String())
+		}
+		v, err := articleField(&a, field)
+		if err != nil {
+			return err
+		}
+		// XHDR (RFC 2980) identifies the article by its message-id, HDR uses 0 instead
+		key := "0"
+		if xhdr {
+			key = arguments[1]
+		}
+		if err := w.write(key, v); err != nil {
+			return err
+		}
+		return w.dw.Close()
+	}
+
+	if s.currentArticle == nil {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 420, Message: "No current article selected"}.String())
+	}
+	v, err := articleField(s.currentArticle, field)
+	if err != nil {
+		return err
+	}
+	if err := w.write(strconv.Itoa(s.currentArticle.ArticleNumber), v); err != nil {
+		return err
+	}
+	return w.dw.Close()
+}
+
+// writeHdrRange writes the field of the articles of the current group in the range given by ParseRange. The overview
+// fields are taken from the overview records, the others need the articles themselves.
+func (h *Handler) writeHdrRange(s *Session, w *hdrWriter, field string, low, high int64) error {
+	if s.currentGroup == nil {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 412, Message: "No newsgroup selected"}.String())
+	}
+
+	single := low == -1
+	low, high, err := h.resolveRange(s, low, high)
+	if err != nil {
+		return err
+	}
+	if low > high {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "Empty range"}.String())
+	}
+
+	if _, ok := utils.OverviewField(models.Overview{}, field); ok {
+		err = h.backend.GetOverview(s.ctx, s.currentGroup, low, high, func(o models.Overview) error {
+			v, _ := utils.OverviewField(o, field)
+			return w.write(strconv.Itoa(o.Number), v)
+		})
+	} else {
+		var articles []models.Article
+		articles, err = h.backend.GetArticlesByRange(s.ctx, s.currentGroup, low, high)
+		for _, v := range articles {
+			if err = w.write(strconv.Itoa(v.ArticleNumber), utils.SanitizeField(v.Header.Get(field))); err != nil {
+				break
+			}
+		}
+	}
+
+	if w.dw == nil {
+		if err != nil {
+			return err
+		}
+		if single {
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "No such article in this group"}.String())
+		}
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "No articles in that range"}.String())
+	}
+	if err != nil {
+		w.dw.Close()
+		return err
+	}
+	return w.dw.Close()
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/protocol"
+)
+
+// listVariants returns the LIST keywords advertised in the capabilities.
+func (h *Handler) listVariants() string {
+	variants := []string{"ACTIVE", "ACTIVE.TIMES", "COUNTS", "DISTRIB.PATS", "HEADERS"}
+	if h.listConfig.MOTDFile != "" {
+		variants = append(variants, "MOTD")
+	}
+	variants = append(variants, "NEWSGROUPS", "OVERVIEW.FMT", "SUBSCRIPTIONS")
+	return strings.Join(variants, " ")
+}
+
+// listWildmat returns the optional wildmat argument of LIST.
+func listWildmat(arguments []string) string {
+	if len(arguments) == 2 {
+		return arguments[1]
+	}
+	return ""
+}
+
+// readableGroups returns the groups matching the wildmat (all of them if it is empty) which the session client
+// can read along with its rights on them.
+func (h *Handler) readableGroups(s *Session, wildmat string) ([]models.Group, []models.ACLEntry, error) {
+	var groups []models.Group
+	var err error
+	if wildmat != "" {
+		groups, err = h.backend.ListGroupsByPattern(s.ctx, wildmat)
+	} else {
+		groups, err = h.backend.ListGroups(s.ctx)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var readable []models.Group
+	var rights []models.ACLEntry
+	for _, v := range groups {
+		r, err := h.groupRights(s, &v)
+		if err != nil {
+			return nil, nil, err
+		}
+		if r.CanRead {
+			readable = append(readable, v)
+			rights = append(rights, r)
+		}
+	}
+	return readable, rights, nil
+}
+
+// waterMarks returns the high and low water marks and the number of articles of the group as they are
+// reported by LIST ACTIVE and LIST COUNTS.
+func (h *Handler) waterMarks(s *Session, g *models.Group) (high, low, count int, err error) {
+	count, err = h.backend.GetArticlesCount(s.ctx, g)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if count == 0 {
+		// an empty group has low water mark greater than high one
+		return g.HighWaterMark, g.HighWaterMark + 1, 0, nil
+	}
+	if high, err = h.backend.GetGroupHighWaterMark(s.ctx, g); err != nil {
+		return 0, 0, 0, err
+	}
+	if low, err = h.backend.GetGroupLowWaterMark(s.ctx, g); err != nil {
+		return 0, 0, 0, err
+	}
+	return high, low, count, nil
+}
+
+func (h *Handler) listActiveTimes(s *Session, arguments []string) error {
+	groups, _, err := h.readableGroups(s, listWildmat(arguments))
+	if err != nil {
+		return err
+	}
+
+	dw := s.tconn.DotWriter()
+	dw.Write([]byte(protocol.NNTPResponse{Code: 215, Message: "information follows"}.String() + protocol.CRLF))
+	for _, v := range groups {
+		creator := v.Creator
+		if creator == "" {
+			// the creator of the group isn't known, so the server is named as the one
+			creator = "news@" + h.serverDomain
+		}
+		dw.Write([]byte(fmt.Sprintf("%s %d %s"+protocol.CRLF, v.GroupName, v.CreatedAt.Unix(), creator)))
+	}
+	return dw.Close()
+}
+
+func (h *Handler) listCounts(s *Session, arguments []string) error {
+	groups, rights, err := h.readableGroups(s, listWildmat(arguments))
+	if err != nil {
+		return err
+	}
+
+	dw := s.tconn.DotWriter()
+	dw.Write([]byte(protocol.NNTPResponse{Code: 215, Message: "list of newsgroups follows"}.String() + protocol.CRLF))
+	for i, v := range groups {
+		high, low, count, err := h.waterMarks(s, &v)
+		if err != nil {
+			return err
+		}
+		dw.Write([]byte(fmt.Sprintf("%s %d %d %d %s"+protocol.CRLF, v.GroupName, high, low, count, postingStatus(&v, rights[i]))))
+	}
+	return dw.Close()
+}
+
+func (h *Handler) listDistribPats(s *Session, arguments []string) error {
+	if len(arguments) != 1 {
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+
+	dw := s.tconn.DotWriter()
+	dw.Write([]byte(protocol.NNTPResponse{Code: 215, Message: "information follows"}.String() + protocol.CRLF))
+	for _, v := range h.listConfig.DistribPats {
+		dw.Write([]byte(fmt.Sprintf("%d:%s:%s"+protocol.CRLF, v.Weight, v.Groups, v.Distribution)))
+	}
+	return dw.Close()
+}
+
+func (h *Handler) listMOTD(s *Session, arguments []string) error {
+	if len(arguments) != 1 {
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+	if h.listConfig.MOTDFile == "" {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 503, Message: "No message of the day"}.String())
+	}
+	data, err := os.ReadFile(h.listConfig.MOTDFile)
+	if err != nil {
+		log.Printf("failed to read message of the day: %v", err)
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 503, Message: "No message of the day"}.String())
+	}
+
+	dw := s.tconn.DotWriter()
+	dw.Write([]byte(protocol.NNTPResponse{Code: 215, Message: "Message of the day follows"}.String() + protocol.CRLF))
+	for _, v := range strings.Split(strings.TrimRight(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n"), "\n") {
+		dw.Write([]byte(v + protocol.CRLF))
+	}
+	return dw.Close()
+}
+
+func (h *Handler) listSubscriptions(s *Session, arguments []string) error {
+	if len(arguments) != 1 {
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+
+	dw := s.tconn.DotWriter()
+	dw.Write([]byte(protocol.NNTPResponse{Code: 215, Message: "list of recommended newsgroups follows"}.String() + protocol.CRLF))
+	for _, v := range h.listConfig.Subscriptions {
+		dw.Write([]byte(v + protocol.CRLF))
+	}
+	return dw.Close()
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/moderation"
+	"github.com/ChronosX88/yans/internal/protocol"
+)
+
+// moderatedGroups returns the existing moderated groups among the given group names.
+func (h *Handler) moderatedGroups(ctx context.Context, groups []string) ([]models.Group, error) {
+	var res []models.Group
+	for _, v := range groups {
+		g, err := h.backend.GetGroup(ctx, strings.TrimSpace(v))
+		if err != nil {
+			if err == backend.ErrNoSuchGroup {
+				continue
+			}
+			return nil, err
+		}
+		if g.Moderated {
+			res = append(res, g)
+		}
+	}
+	return res, nil
+}
+
+func (h *Handler) canModerateAll(s *Session, groups []models.Group) (bool, error) {
+	for _, v := range groups {
+		rights, err := h.groupRights(s, &v)
+		if err != nil {
+			return false, err
+		}
+		if !rights.CanModerate {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// errUnapproved is returned for an article relayed by a peer to a moderated group without approval.
+var errUnapproved = errors.New("unapproved article to moderated group")
+
+// unapprovedGroup returns the moderated group the article has to be approved in before it is published,
+// or nil if it may be published now. The Approved header of articles relayed by peers is trusted, a posting
+// client has to be a moderator of all the moderated groups for the header to count.
+func (h *Handler) unapprovedGroup(ctx context.Context, poster *Session, approved string, groups []string) (*models.Group, error) {
+	moderated, err := h.moderatedGroups(ctx, groups)
+	if err != nil || len(moderated) == 0 {
+		return nil, err
+	}
+	if approved != "" {
+		if poster == nil {
+			return nil, nil
+		}
+		ok, err := h.canModerateAll(poster, moderated)
+		if err != nil || ok {
+			return nil, err
+		}
+	}
+	// the article goes to the moderators of the first moderated group
+	return &moderated[0], nil
+}
+
+// approverAddress returns the value of the Approved header for articles approved by the session client.
+func (h *Handler) approverAddress(s *Session) string {
+	if strings.Contains(s.authenticatedUser, "@") {
+		return s.authenticatedUser
+	}
+	if s.authenticatedUser == "" {
+		return "moderator@" + h.serverDomain
+	}
+	return s.authenticatedUser + "@" + h.serverDomain
+}
+
+// checkModerator writes an error response and returns false if the session client can't moderate the current group.
+func (h *Handler) checkModerator(s *Session) (bool, error) {
+	if s.currentGroup == nil {
+		return false, s.tconn.PrintfLine(protocol.NNTPResponse{Code: 412, Message: "no newsgroup selected"}.String())
+	}
+	rights, err := h.groupRights(s, s.currentGroup)
+	if err != nil {
+		return false, err
+	}
+	if !rights.CanModerate {
+		if s.authenticatedUser == "" && h.authProvider != nil {
+			return false, s.tconn.PrintfLine(protocol.NNTPResponse{Code: 480, Message: "Authentication required"}.String())
+		}
+		return false, s.tconn.PrintfLine(protocol.NNTPResponse{Code: 502, Message: "Permission denied"}.String())
+	}
+	return true, nil
+}
+
+// getPendingArticle looks up the pending article of the current group by the id argument. It writes an error
+// response and returns nil if there is no such article.
+func (h *Handler) getPendingArticle(s *Session, arguments []string) (*models.PendingArticle, error) {
+	if len(arguments) != 1 {
+		return nil, s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+	pendingID, err := strconv.Atoi(arguments[0])
+	if err != nil {
+		return nil, s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+
+	pa, err := h.backend.GetPendingArticle(s.ctx, pendingID)
+	if err != nil {
+		if err == backend.ErrNotFound {
+			return nil, s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "No such pending article"}.String())
+		}
+		return nil, err
+	}
+	if pa.GroupID != s.currentGroup.ID {
+		return nil, s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "No such pending article"}.String())
+	}
+	return &pa, nil
+}
+
+func (h *Handler) handlePending(s *Session, command string, arguments []string, id uint) error {
+	s.tconn.StartResponse(id)
+	defer s.tconn.EndResponse(id)
+
+	if ok, err := h.checkModerator(s); !ok {
+		return err
+	}
+
+	articles, err := h.backend.GetPendingArticles(s.ctx, s.currentGroup)
+	if err != nil {
+		return err
+	}
+
+	dw := s.tconn.DotWriter()
+	dw.Write([]byte(protocol.NNTPResponse{Code: 227, Message: "Pending articles follow" + protocol.CRLF}.String()))
+	for _, v := range articles {
+		dw.Write([]byte(fmt.Sprintf("%d	%s	%s	%s	%s"+protocol.CRLF, v.ID, v.Header.Get("Subject"), v.Header.Get("From"), v.Header.Get("Date"), v.Submitter)))
+	}
+	return dw.Close()
+}
+
+func (h *Handler) handleApprove(s *Session, command string, arguments []string, id uint) error {
+	s.tconn.StartResponse(id)
+	defer s.tconn.EndResponse(id)
+
+	if ok, err := h.checkModerator(s); !ok {
+		return err
+	}
+	pa, err := h.getPendingArticle(s, arguments)
+	if pa == nil {
+		return err
+	}
+
+	a, err := moderation.Approve(s.ctx, h.backend, h.uploadPath, pa.ID, h.approverAddress(s))
+	if err != nil {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 441, Message: err.Error()}.String())
+	}
+
+	return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 228, Message: fmt.Sprintf("%s approved", a.Header.Get("Message-ID"))}.String())
+}
+
+func (h *Handler) handleReject(s *Session, command string, arguments []string, id uint) error {
+	s.tconn.StartResponse(id)
+	defer s.tconn.EndResponse(id)
+
+	if ok, err := h.checkModerator(s); !ok {
+		return err
+	}
+	pa, err := h.getPendingArticle(s, arguments)
+	if pa == nil {
+		return err
+	}
+
+	if _, err := moderation.Reject(s.ctx, h.backend, h.uploadPath, pa.ID); err != nil {
+		return err
+	}
+
+	return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 229, Message: fmt.Sprintf("%s rejected", pa.Header.Get("Message-ID"))}.String())
+}
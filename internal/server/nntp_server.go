@@ -2,17 +2,29 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"github.com/ChronosX88/yans/internal/adminapi"
+	"github.com/ChronosX88/yans/internal/auth"
 	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/backend/memory"
+	"github.com/ChronosX88/yans/internal/backend/postgres"
 	"github.com/ChronosX88/yans/internal/backend/sqlite"
+	"github.com/ChronosX88/yans/internal/backend/tradspool"
 	"github.com/ChronosX88/yans/internal/common"
 	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/control"
+	"github.com/ChronosX88/yans/internal/expire"
+	"github.com/ChronosX88/yans/internal/feed"
 	"github.com/ChronosX88/yans/internal/protocol"
 	"github.com/google/uuid"
+	"github.com/jhillyerd/enmime"
 	"log"
 	"net"
 	"net/http"
 	"nhooyr.io/websocket"
+	"sort"
 	"sync"
 )
 
@@ -20,9 +32,12 @@ var (
 	Capabilities = protocol.Capabilities{
 		{Type: protocol.VersionCapability, Params: "2"},
 		{Type: protocol.ImplementationCapability, Params: fmt.Sprintf("%s %s", common.ServerName, common.ServerVersion)},
+		{Type: protocol.HdrCapability},
 		{Type: protocol.OverCapability, Params: "MSGID"},
 		{Type: protocol.ModeReaderCapability},
 		{Type: protocol.IHaveCapability},
+		{Type: protocol.StreamingCapability},
+		{Type: protocol.SearchCapability},
 	}
 )
 
@@ -33,30 +48,58 @@ type NNTPServer struct {
 	ln  net.Listener
 	cfg config.Config
 
-	backend backend.StorageBackend
+	backend      backend.StorageBackend
+	authProvider auth.CredentialProvider
+	tlsConfig    *tls.Config
+	control      *control.Processor
 
 	sessionPool      map[string]*Session
 	sessionPoolMutex sync.Mutex
 }
 
 func NewNNTPServer(cfg config.Config) (*NNTPServer, error) {
-	b, err := initBackend(cfg)
+	b, err := NewBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ap, err := initAuthProvider(cfg, b)
+	if err != nil {
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.TLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	} else if cfg.TLS.Port != 0 {
+		return nil, fmt.Errorf("TLS port is set, but no certificate is configured")
+	}
+
+	cp, err := control.NewProcessor(b, cfg)
 	if err != nil {
 		return nil, err
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	ns := &NNTPServer{
-		ctx:         ctx,
-		cancelFunc:  cancel,
-		cfg:         cfg,
-		backend:     b,
-		sessionPool: map[string]*Session{},
+		ctx:          ctx,
+		cancelFunc:   cancel,
+		cfg:          cfg,
+		backend:      b,
+		authProvider: ap,
+		tlsConfig:    tlsConfig,
+		control:      cp,
+		sessionPool:  map[string]*Session{},
 	}
 	return ns, nil
 }
 
-func initBackend(cfg config.Config) (backend.StorageBackend, error) {
+// NewBackend opens the storage backend of the type set in the config.
+func NewBackend(cfg config.Config) (backend.StorageBackend, error) {
 	var sb backend.StorageBackend
 
 	switch cfg.BackendType {
@@ -68,6 +111,26 @@ func initBackend(cfg config.Config) (backend.StorageBackend, error) {
 			}
 			sb = sqliteBackend
 		}
+	case config.PostgresBackendType:
+		{
+			postgresBackend, err := postgres.NewPostgresBackend(cfg.Postgres)
+			if err != nil {
+				return nil, err
+			}
+			sb = postgresBackend
+		}
+	case config.MemoryBackendType:
+		{
+			sb = memory.NewMemoryBackend()
+		}
+	case config.TradspoolBackendType:
+		{
+			tradspoolBackend, err := tradspool.NewTradspoolBackend(cfg.Tradspool, cfg.Domain)
+			if err != nil {
+				return nil, err
+			}
+			sb = tradspoolBackend
+		}
 	default:
 		{
 			return nil, fmt.Errorf("invalid backend type, supported backends: %s", backend.SupportedBackendList)
@@ -76,6 +139,30 @@ func initBackend(cfg config.Config) (backend.StorageBackend, error) {
 	return sb, nil
 }
 
+func initAuthProvider(cfg config.Config, b backend.StorageBackend) (auth.CredentialProvider, error) {
+	switch cfg.Auth.Provider {
+	case "":
+		{
+			if len(cfg.Auth.RequiredFor) != 0 {
+				return nil, fmt.Errorf("authentication is required for some commands, but no auth provider is configured")
+			}
+			return nil, nil
+		}
+	case config.BackendAuthProviderType:
+		{
+			return auth.NewBackendProvider(b), nil
+		}
+	case config.FileAuthProviderType:
+		{
+			return auth.NewFileProvider(cfg.Auth.UsersFile)
+		}
+	default:
+		{
+			return nil, fmt.Errorf("invalid auth provider type, supported providers: %s, %s", config.BackendAuthProviderType, config.FileAuthProviderType)
+		}
+	}
+}
+
 func (ns *NNTPServer) Start() error {
 	address := fmt.Sprintf("%s:%d", ns.cfg.Address, ns.cfg.Port)
 	ln, err := net.Listen("tcp", address)
@@ -83,28 +170,68 @@ func (ns *NNTPServer) Start() error {
 		return err
 	}
 
+	ns.ln = ln
+
 	log.Printf("Listening on %s...", address)
 
-	go func(ctx context.Context) {
-		for {
-			select {
-			case <-ctx.Done():
-				break
-			default:
-				{
-					conn, err := ln.Accept()
-					if err != nil {
-						log.Println(err)
-					}
-					log.Printf("Client %s has connected!", conn.RemoteAddr().String())
+	go ns.serve(ns.ctx, ln)
 
-					if err := ns.handleConn(ctx, conn, conn.RemoteAddr().String()); err != nil {
-						log.Println(err)
-					}
+	if ns.cfg.TLS.Port != 0 {
+		tlsAddress := fmt.Sprintf("%s:%d", ns.cfg.Address, ns.cfg.TLS.Port)
+		tlsLn, err := tls.Listen("tcp", tlsAddress, ns.tlsConfig)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Listening on %s (TLS)...", tlsAddress)
+
+		go ns.serve(ns.ctx, tlsLn)
+	}
+
+	expirer, err := expire.NewExpirer(ns.backend, ns.cfg)
+	if err != nil {
+		return err
+	}
+	expirer.Start(ns.ctx)
+
+	if len(ns.cfg.Feed.Peers) != 0 {
+		feeder, err := feed.NewFeeder(ns.backend, ns.cfg)
+		if err != nil {
+			return err
+		}
+		feeder.Start(ns.ctx)
+	}
+
+	if len(ns.cfg.Feed.Upstreams) != 0 {
+		h := NewHandler(ns.backend, ns.cfg, ns.authProvider, ns.tlsConfig, ns.control)
+		puller, err := feed.NewPuller(ns.backend, ns.cfg, func(ctx context.Context, upstream string, envelope *enmime.Envelope) error {
+			if _, err := h.saveArticle(ctx, envelope, nil, upstream); err != nil {
+				if refused(err) {
+					return fmt.Errorf("%w: %v", feed.ErrRejected, err)
 				}
+				return err
 			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		puller.Start(ns.ctx)
+	}
+
+	if ns.cfg.AdminAPI.Port != 0 {
+		api, err := adminapi.NewServer(ns.backend, ns.cfg, ns)
+		if err != nil {
+			return err
+		}
+		api.Start(ns.ctx)
+	}
+
+	if ns.cfg.Search.Port != 0 {
+		if err := ns.serveSearch(); err != nil {
+			return err
 		}
-	}(ns.ctx)
+	}
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{InsecureSkipVerify: true})
@@ -124,10 +251,75 @@ func (ns *NNTPServer) Start() error {
 	return nil
 }
 
+// serveSearch starts the TLS listener of HTTP search endpoint.
+func (ns *NNTPServer) serveSearch() error {
+	if ns.tlsConfig == nil {
+		return fmt.Errorf("search endpoint is enabled, but no TLS certificate is configured")
+	}
+	address := fmt.Sprintf("%s:%d", ns.cfg.Search.Address, ns.cfg.Search.Port)
+	ln, err := tls.Listen("tcp", address, ns.tlsConfig)
+	if err != nil {
+		return err
+	}
+	log.Printf("Search endpoint is listening on %s (TLS)...", address)
+
+	mux := http.NewServeMux()
+	mux.Handle("/search", NewHandler(ns.backend, ns.cfg, ns.authProvider, ns.tlsConfig, ns.control).searchHandler())
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("search: %v", err)
+		}
+	}()
+	go func() {
+		<-ns.ctx.Done()
+		srv.Close()
+	}()
+	return nil
+}
+
+func (ns *NNTPServer) serve(ctx context.Context, ln net.Listener) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			{
+				conn, err := ln.Accept()
+				if err != nil {
+					if errors.Is(err, net.ErrClosed) {
+						return
+					}
+					log.Println(err)
+					continue
+				}
+				log.Printf("Client %s has connected!", conn.RemoteAddr().String())
+
+				if err := ns.handleConn(ctx, conn, conn.RemoteAddr().String()); err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}
+}
+
 func (ns *NNTPServer) handleConn(ctx context.Context, conn net.Conn, remoteAddr string) error {
+	banned, err := isAddressBanned(ctx, ns.backend, remoteAddr)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if banned {
+		log.Printf("Client %s is banned, closing the connection", remoteAddr)
+		fmt.Fprintf(conn, "%s%s", protocol.NNTPResponse{Code: 502, Message: "Access denied"}.String(), protocol.CRLF)
+		return conn.Close()
+	}
+
 	id, _ := uuid.NewUUID()
 	closed := make(chan bool)
-	session, err := NewSession(ctx, conn, remoteAddr, Capabilities, id.String(), closed, NewHandler(ns.backend, ns.cfg.Domain, ns.cfg.UploadPath))
+	handler := NewHandler(ns.backend, ns.cfg, ns.authProvider, ns.tlsConfig, ns.control)
+	_, isTLS := conn.(*tls.Conn)
+	session, err := NewSession(ctx, conn, remoteAddr, handler.defaultCapabilities(isTLS), id.String(), closed, handler)
 	if err != nil {
 		return err
 	}
@@ -155,6 +347,42 @@ func (ns *NNTPServer) handleConn(ctx context.Context, conn net.Conn, remoteAddr
 	return nil
 }
 
+// Sessions returns the sessions of connected clients ordered by connection time.
+func (ns *NNTPServer) Sessions() []adminapi.SessionInfo {
+	ns.sessionPoolMutex.Lock()
+	defer ns.sessionPoolMutex.Unlock()
+
+	var sessions []adminapi.SessionInfo
+	for _, v := range ns.sessionPool {
+		username, group, tlsActive := v.info()
+		sessions = append(sessions, adminapi.SessionInfo{
+			ID:          v.id,
+			RemoteAddr:  v.remoteAddr,
+			Username:    username,
+			Group:       group,
+			TLS:         tlsActive,
+			ConnectedAt: v.connectedAt,
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].ConnectedAt.Before(sessions[j].ConnectedAt)
+	})
+	return sessions
+}
+
+// KickSession disconnects the client of the session.
+func (ns *NNTPServer) KickSession(id string) bool {
+	ns.sessionPoolMutex.Lock()
+	s, ok := ns.sessionPool[id]
+	ns.sessionPoolMutex.Unlock()
+	if !ok {
+		return false
+	}
+	log.Printf("Client %s has been kicked", s.remoteAddr)
+	s.close()
+	return true
+}
+
 func (ns *NNTPServer) Stop() {
 	ns.cancelFunc()
 }
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/base64"
+	"log"
+	"strings"
+
+	"github.com/ChronosX88/yans/internal/auth/sasl"
+	"github.com/ChronosX88/yans/internal/protocol"
+)
+
+// startSASL handles AUTHINFO SASL mechanism [initial-response]. The response has been already
+// started by the caller.
+func (h *Handler) startSASL(s *Session, arguments []string) error {
+	if len(arguments) > 2 {
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+
+	mechanism, err := sasl.New(strings.ToUpper(arguments[0]), h.authProvider)
+	if err != nil {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 503, Message: "Mechanism not recognized"}.String())
+	}
+
+	if len(arguments) == 1 {
+		// no initial response, ask client for it with an empty challenge
+		s.saslMechanism = mechanism
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 383, Message: encodeSASL(nil)}.String())
+	}
+
+	response, err := decodeSASL(arguments[1])
+	if err != nil {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 504, Message: "Base64 encoding error"}.String())
+	}
+	return h.stepSASL(s, mechanism, response)
+}
+
+// continueSASL handles a client response line sent in the middle of SASL exchange.
+func (h *Handler) continueSASL(s *Session, message string, id uint) error {
+	s.tconn.StartResponse(id)
+	defer s.tconn.EndResponse(id)
+
+	mechanism := s.saslMechanism
+	s.saslMechanism = nil
+
+	if strings.TrimSpace(message) == "*" {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 481, Message: "Authentication aborted"}.String())
+	}
+
+	response, err := decodeSASL(strings.TrimSpace(message))
+	if err != nil {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 504, Message: "Base64 encoding error"}.String())
+	}
+	return h.stepSASL(s, mechanism, response)
+}
+
+func (h *Handler) stepSASL(s *Session, mechanism sasl.Mechanism, response []byte) error {
+	challenge, done, err := mechanism.Next(s.ctx, response)
+	if err != nil {
+		if err == sasl.ErrAuthFailed {
+			log.Printf("Client %s has failed SASL authentication", s.remoteAddr)
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 481, Message: "Authentication failed/rejected"}.String())
+		}
+		return err
+	}
+
+	if !done {
+		s.saslMechanism = mechanism
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 383, Message: encodeSASL(challenge)}.String())
+	}
+
+	banned, err := isUserBanned(s.ctx, h.backend, mechanism.Username())
+	if err != nil {
+		return err
+	}
+	if banned {
+		log.Printf("Client %s has tried to authenticate as banned user %s", s.remoteAddr, mechanism.Username())
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 481, Message: "Authentication failed/rejected"}.String())
+	}
+
+	s.setAuthenticated(mechanism.Username())
+	if len(challenge) != 0 {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 283, Message: encodeSASL(challenge)}.String())
+	}
+	return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 281, Message: "Authentication accepted"}.String())
+}
+
+// encodeSASL encodes SASL data for the wire, empty data is sent as "=" (RFC 4643, section 2.4.1).
+func encodeSASL(data []byte) string {
+	if len(data) == 0 {
+		return "="
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func decodeSASL(s string) ([]byte, error) {
+	if s == "=" {
+		return []byte{}, nil
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
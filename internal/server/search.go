@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/protocol"
+	"github.com/ChronosX88/yans/internal/utils"
+)
+
+const (
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+)
+
+// search returns the search results in the groups matching the wildmat which the session client can read.
+func (h *Handler) search(s *Session, wildmat, query string, limit int) ([]models.SearchResult, error) {
+	groups, _, err := h.readableGroups(s, wildmat)
+	if err != nil {
+		return nil, err
+	}
+	return h.backend.SearchArticles(s.ctx, groups, query, limit)
+}
+
+// handleSearch implements "SEARCH wildmat words...", the articles are listed from the newest one as
+// "message-id group:number..." lines.
+func (h *Handler) handleSearch(s *Session, command string, arguments []string, id uint) error {
+	s.tconn.StartResponse(id)
+	defer s.tconn.EndResponse(id)
+
+	if len(arguments) < 2 {
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+	if _, err := utils.ParseWildmat(arguments[0]); err != nil {
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+	query := strings.Join(arguments[1:], " ")
+	if len(utils.SearchTerms(query)) == 0 {
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+
+	results, err := h.search(s, arguments[0], query, defaultSearchLimit)
+	if err != nil {
+		return err
+	}
+
+	dw := s.tconn.DotWriter()
+	dw.Write([]byte(protocol.NNTPResponse{Code: 232, Message: "Search results follow" + protocol.CRLF}.String()))
+	for i := 0; i < len(results); {
+		// results of a crossposted article go in a row
+		line := results[i].MessageID
+		j := i
+		for ; j < len(results) && results[j].MessageID == results[i].MessageID; j++ {
+			line += fmt.Sprintf(" %s:%d", results[j].GroupName, results[j].ArticleNumber)
+		}
+		dw.Write([]byte(line + protocol.CRLF))
+		i = j
+	}
+	return dw.Close()
+}
+
+type searchResult struct {
+	MessageID string `json:"message_id"`
+	Group     string `json:"group"`
+	Number    int    `json:"number"`
+}
+
+// searchHandler serves "GET /search?q=words&groups=wildmat&limit=n" for web clients, the results are returned
+// as JSON array. Clients may authenticate with HTTP basic authentication, otherwise they have anonymous rights.
+func (h *Handler) searchHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON := func(status int, v interface{}) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(v)
+		}
+		writeError := func(status int, message string) {
+			writeJSON(status, map[string]string{"error": message})
+		}
+
+		if r.Method != http.MethodGet {
+			writeError(http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		s := &Session{ctx: r.Context()}
+		if username, password, ok := r.BasicAuth(); ok {
+			user, status, err := h.authenticateHTTP(r.Context(), username, password)
+			if err != nil {
+				log.Printf("search: %v", err)
+				writeError(http.StatusInternalServerError, "internal error")
+				return
+			}
+			if status != http.StatusOK {
+				writeError(status, "authentication failed")
+				return
+			}
+			s.authenticatedUser = user
+		}
+
+		query := r.URL.Query().Get("q")
+		if len(utils.SearchTerms(query)) == 0 {
+			writeError(http.StatusBadRequest, "no query")
+			return
+		}
+		wildmat := r.URL.Query().Get("groups")
+		if wildmat == "" {
+			wildmat = "*"
+		}
+		if _, err := utils.ParseWildmat(wildmat); err != nil {
+			writeError(http.StatusBadRequest, "invalid groups wildmat")
+			return
+		}
+		limit := defaultSearchLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				writeError(http.StatusBadRequest, "invalid limit")
+				return
+			}
+			if n > maxSearchLimit {
+				n = maxSearchLimit
+			}
+			limit = n
+		}
+
+		results, err := h.search(s, wildmat, query, limit)
+		if err != nil {
+			log.Printf("search: %v", err)
+			writeError(http.StatusInternalServerError, "internal error")
+			return
+		}
+		res := make([]searchResult, 0, len(results))
+		for _, v := range results {
+			res = append(res, searchResult{MessageID: v.MessageID, Group: v.GroupName, Number: v.ArticleNumber})
+		}
+		writeJSON(http.StatusOK, res)
+	})
+}
+
+// authenticateHTTP checks the credentials of an HTTP client, it returns the user name and http.StatusOK on success.
+func (h *Handler) authenticateHTTP(ctx context.Context, username, password string) (string, int, error) {
+	if h.authProvider == nil {
+		return "", http.StatusUnauthorized, nil
+	}
+	ok, err := h.authProvider.Authenticate(ctx, username, password)
+	if err != nil || !ok {
+		return "", http.StatusUnauthorized, err
+	}
+	banned, err := isUserBanned(ctx, h.backend, username)
+	if err != nil {
+		return "", 0, err
+	}
+	if banned {
+		return "", http.StatusForbidden, nil
+	}
+	return username, http.StatusOK, nil
+}
@@ -2,8 +2,10 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"github.com/ChronosX88/yans/internal/auth/sasl"
 	"github.com/ChronosX88/yans/internal/models"
 	"github.com/ChronosX88/yans/internal/protocol"
 	"io"
@@ -11,6 +13,8 @@ import (
 	"net"
 	"net/textproto"
 	"strings"
+	"sync"
+	"time"
 )
 
 type SessionMode int
@@ -21,7 +25,9 @@ const (
 )
 
 type Session struct {
+	// ctx is cancelled when the session ends, so backend calls made for the client are aborted
 	ctx          context.Context
+	cancel       context.CancelFunc
 	capabilities protocol.Capabilities
 	conn         net.Conn
 	tconn        *textproto.Conn
@@ -29,10 +35,19 @@ type Session struct {
 	id           string
 	closed       chan<- bool
 	h            *Handler
+	connectedAt  time.Time
+
+	// mu guards conn, currentGroup and authenticatedUser, which are read by the admin API from other goroutines.
+	// The session goroutine holds it only when it changes them.
+	mu sync.Mutex
 
 	currentGroup   *models.Group
 	currentArticle *models.Article
 	mode           SessionMode
+
+	pendingUsername   string
+	authenticatedUser string
+	saslMechanism     sasl.Mechanism // set while AUTHINFO SASL exchange is in progress
 }
 
 func NewSession(
@@ -45,8 +60,10 @@ func NewSession(
 	handler *Handler,
 ) (*Session, error) {
 	var err error
+	ctx, cancel := context.WithCancel(ctx)
 	defer func() {
 		if err != nil {
+			cancel()
 			conn.Close()
 			close(closed)
 		}
@@ -55,6 +72,7 @@ func NewSession(
 	tconn := textproto.NewConn(conn)
 	s := &Session{
 		ctx:          ctx,
+		cancel:       cancel,
 		conn:         conn,
 		tconn:        tconn,
 		remoteAddr:   remoteAddr,
@@ -63,6 +81,7 @@ func NewSession(
 		closed:       closed,
 		h:            handler,
 		mode:         SessionModeTransit,
+		connectedAt:  time.Now(),
 	}
 
 	go s.loop()
@@ -72,10 +91,15 @@ func NewSession(
 
 func (s *Session) loop() {
 	defer func() {
+		s.cancel()
 		close(s.closed)
 	}()
 
-	err := s.tconn.PrintfLine(protocol.NNTPResponse{Code: 201, Message: "YANS NNTP Service Ready, posting allowed"}.String()) // by default access mode is read-only
+	greeting := protocol.NNTPResponse{Code: 201, Message: "YANS NNTP Service Ready, posting prohibited"}
+	if s.h.defaultRights(s).CanPost {
+		greeting = protocol.NNTPResponse{Code: 200, Message: "YANS NNTP Service Ready, posting allowed"}
+	}
+	err := s.tconn.PrintfLine(greeting.String())
 	if err != nil {
 		s.conn.Close()
 		return
@@ -100,8 +124,14 @@ func (s *Session) loop() {
 					return
 				}
 				s.tconn.EndRequest(id)
-				log.Printf("Received message from %s: %s", s.remoteAddr, message) // for debugging
-				err = s.h.Handle(s, message, id)
+				if s.saslMechanism != nil {
+					// the line is a response in the middle of SASL exchange
+					log.Printf("Received SASL response from %s", s.remoteAddr)
+					err = s.h.continueSASL(s, message, id)
+				} else {
+					log.Printf("Received message from %s: %s", s.remoteAddr, maskCredentials(message)) // for debugging
+					err = s.h.Handle(s, message, id)
+				}
 				if err != nil {
 					log.Print(err)
 					s.tconn.PrintfLine(protocol.NNTPResponse{Code: 403, Message: fmt.Sprintf("Failed to process command: %s", err.Error())}.String())
@@ -113,3 +143,57 @@ func (s *Session) loop() {
 	}
 
 }
+
+// close drops the connection of the session and aborts its running command.
+func (s *Session) close() error {
+	s.cancel()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.Close()
+}
+
+func (s *Session) isTLS() bool {
+	_, ok := s.conn.(*tls.Conn)
+	return ok
+}
+
+// info returns the state of the session which is shown by the admin API, it is safe to call from other goroutines.
+func (s *Session) info() (username string, group string, tlsActive bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.currentGroup != nil {
+		group = s.currentGroup.GroupName
+	}
+	return s.authenticatedUser, group, s.isTLS()
+}
+
+func (s *Session) setGroup(g *models.Group) {
+	s.mu.Lock()
+	s.currentGroup = g
+	s.mu.Unlock()
+}
+
+func (s *Session) setAuthenticated(username string) {
+	s.mu.Lock()
+	s.authenticatedUser = username
+	s.mu.Unlock()
+	(&s.capabilities).Remove(protocol.AuthInfoCapability)
+	(&s.capabilities).Remove(protocol.SASLCapability)
+	log.Printf("Client %s has authenticated as %s", s.remoteAddr, username)
+}
+
+// maskCredentials hides the password of AUTHINFO PASS and the initial response of AUTHINFO SASL
+// commands, so they don't leak into logs.
+func maskCredentials(message string) string {
+	upper := strings.ToUpper(message)
+	if strings.HasPrefix(upper, protocol.CommandAuthInfo+" PASS") {
+		return protocol.CommandAuthInfo + " PASS ********"
+	}
+	if strings.HasPrefix(upper, protocol.CommandAuthInfo+" SASL") {
+		parts := strings.Split(message, " ")
+		if len(parts) > 3 {
+			return strings.Join(parts[:3], " ") + " ********"
+		}
+	}
+	return message
+}
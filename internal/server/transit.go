@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/protocol"
+	"github.com/jhillyerd/enmime"
+)
+
+// transferError is the reason why an article offered by a peer wasn't accepted.
+type transferError struct {
+	reason string
+	retry  bool // whether the peer may offer the article again later
+}
+
+func (e *transferError) Error() string {
+	return e.reason
+}
+
+// receiveArticle reads the article which is offered by a peer with IHAVE or TAKETHIS and stores it.
+func (h *Handler) receiveArticle(s *Session, messageID string) error {
+	raw, err := ioutil.ReadAll(s.tconn.DotReader())
+	if err != nil {
+		return err
+	}
+
+	envelope, err := enmime.ReadEnvelope(bytes.NewReader(raw))
+	if err != nil {
+		return &transferError{reason: fmt.Sprintf("malformed article: %s", err.Error())}
+	}
+
+	if envelope.GetHeader("Message-ID") != messageID {
+		return &transferError{reason: "Message-ID of the article doesn't match the offered one"}
+	}
+
+	groups := strings.Split(envelope.GetHeader("Newsgroups"), ",")
+	denied, err := h.checkPostingRights(s, groups)
+	if err != nil {
+		return err
+	}
+	if denied != "" {
+		return &transferError{reason: fmt.Sprintf("posting to %s is not permitted", denied)}
+	}
+
+	if _, err := h.saveArticle(s.ctx, envelope, nil, s.authenticatedUser); err != nil {
+		return &transferError{reason: err.Error(), retry: !refused(err)}
+	}
+	return nil
+}
+
+// refused reports whether saving the article failed because it won't be accepted whenever it is offered again,
+// e.g. it is a duplicate, it has no carried groups, it lacks approval or it has a disallowed attachment.
+func refused(err error) bool {
+	return errors.Is(err, backend.ErrDuplicate) || errors.Is(err, backend.ErrNoSuchGroup) ||
+		errors.Is(err, errUnapproved) || errors.Is(err, errDisallowedAttachment)
+}
+
+func (h *Handler) handleCheck(s *Session, command string, arguments []string, id uint) error {
+	s.tconn.StartResponse(id)
+	defer s.tconn.EndResponse(id)
+
+	if len(arguments) != 1 {
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+
+	exists, err := h.backend.HasMessageID(s.ctx, arguments[0])
+	if err != nil {
+		return err
+	}
+	if exists {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 438, Message: arguments[0]}.String())
+	}
+	return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 238, Message: arguments[0]}.String())
+}
+
+func (h *Handler) handleTakeThis(s *Session, command string, arguments []string, id uint) error {
+	s.tconn.StartResponse(id)
+	defer s.tconn.EndResponse(id)
+
+	// the article is sent right after the command, so it has to be read even if it is refused
+	if len(arguments) != 1 {
+		if _, err := io.Copy(ioutil.Discard, s.tconn.DotReader()); err != nil {
+			return err
+		}
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+	messageID := arguments[0]
+
+	exists, err := h.backend.HasMessageID(s.ctx, messageID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if _, err := io.Copy(ioutil.Discard, s.tconn.DotReader()); err != nil {
+			return err
+		}
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 439, Message: messageID + " Duplicate"}.String())
+	}
+
+	if err := h.receiveArticle(s, messageID); err != nil {
+		if te, ok := err.(*transferError); ok {
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 439, Message: fmt.Sprintf("%s %s", messageID, te.reason)}.String())
+		}
+		return err
+	}
+	return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 239, Message: messageID}.String())
+}
@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/jhillyerd/enmime"
+)
+
+// BuildArticle constructs the MIME message of the article as it is sent over the wire,
+// attachments are read from uploadPath.
+func BuildArticle(a *models.Article, uploadPath string) (*enmime.Part, error) {
+	builder := Builder()
+	for k, v := range a.Header {
+		for _, j := range v {
+			builder = builder.Header(k, j)
+		}
+	}
+	builder = builder.Text([]byte(a.Body))
+	for _, v := range a.Attachments {
+		builder = builder.AddFileAttachment(path.Join(uploadPath, v.FileName))
+	}
+	return builder.Build()
+}
+
+// RemoveAttachments deletes attachment files of the article from uploadPath.
+func RemoveAttachments(attachments []models.Attachment, uploadPath string) error {
+	for _, v := range attachments {
+		if err := os.Remove(path.Join(uploadPath, v.FileName)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewOverview makes the overview record of the article. The size is the one of the article without
+// attachments, so it can be computed when the attachments aren't at hand.
+func NewOverview(a *models.Article, number int) (models.Overview, error) {
+	builder := Builder()
+	for k, v := range a.Header {
+		for _, j := range v {
+			builder = builder.Header(k, j)
+		}
+	}
+	p, err := builder.Text([]byte(a.Body)).Build()
+	if err != nil {
+		return models.Overview{}, err
+	}
+	var w countingWriter
+	if err := p.Encode(&w); err != nil {
+		return models.Overview{}, err
+	}
+
+	return models.Overview{
+		Number:     number,
+		Subject:    SanitizeField(a.Header.Get("Subject")),
+		From:       SanitizeField(a.Header.Get("From")),
+		Date:       SanitizeField(a.Header.Get("Date")),
+		MessageID:  SanitizeField(a.Header.Get("Message-ID")),
+		References: SanitizeField(a.Header.Get("References")),
+		Bytes:      int(w),
+		Lines:      CountLines(a.Body),
+	}, nil
+}
+
+// OverviewField returns the value of the overview field named as in LIST OVERVIEW.FMT, ignoring the case,
+// ok is false if the overview doesn't contain the field.
+func OverviewField(o models.Overview, name string) (value string, ok bool) {
+	switch strings.ToLower(name) {
+	case "subject":
+		return o.Subject, true
+	case "from":
+		return o.From, true
+	case "date":
+		return o.Date, true
+	case "message-id":
+		return o.MessageID, true
+	case "references":
+		return o.References, true
+	case ":bytes":
+		return strconv.Itoa(o.Bytes), true
+	case ":lines":
+		return strconv.Itoa(o.Lines), true
+	}
+	return "", false
+}
+
+// CountLines returns the number of lines of the body.
+func CountLines(body string) int {
+	body = strings.TrimSuffix(body, "\n")
+	if body == "" {
+		return 0
+	}
+	return strings.Count(body, "\n") + 1
+}
+
+// SanitizeField replaces characters which must not appear in overview and HDR fields (RFC 3977, section 8.3.1).
+func SanitizeField(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(s)
+}
+
+type countingWriter int
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,11 @@
+package utils
+
+import "regexp"
+
+var groupNameRegexp = regexp.MustCompile(`^[a-z0-9+_-]+(\.[a-z0-9+_-]+)*$`)
+
+// IsValidGroupName reports whether the name is made of dot-separated components of lowercase letters,
+// digits, "+", "-" and "_". Groups created by control messages, the admin API and the command line are checked alike.
+func IsValidGroupName(name string) bool {
+	return groupNameRegexp.MatchString(name)
+}
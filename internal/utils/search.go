@@ -0,0 +1,27 @@
+package utils
+
+import "strings"
+
+// SearchTerms splits the search query into the words which all have to be found in an article.
+func SearchTerms(query string) []string {
+	return strings.Fields(strings.ToLower(query))
+}
+
+// MatchesSearch reports whether each of the terms occurs in the subject, the sender or the body of an article,
+// ignoring the case. It is used by the backends which have no search index.
+func MatchesSearch(subject, from, body string, terms []string) bool {
+	fields := []string{strings.ToLower(subject), strings.ToLower(from), strings.ToLower(body)}
+	for _, t := range terms {
+		found := false
+		for _, f := range fields {
+			if strings.Contains(f, t) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
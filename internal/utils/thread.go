@@ -0,0 +1,60 @@
+package utils
+
+import "github.com/ChronosX88/yans/internal/models"
+
+// BuildThreadTree sets parents and depths of the nodes of the thread with the given root and orders them
+// depth-first, replies of an article in the order of the given nodes. Replies whose parent isn't among the nodes,
+// e.g. it isn't posted to the group, are attached to the root. When the root itself is missing,
+// the first node whose parent isn't among the nodes stands for it.
+func BuildThreadTree(nodes []models.ThreadNode, root string) []models.ThreadNode {
+	if len(nodes) == 0 {
+		return nil
+	}
+	byID := map[string]int{}
+	for i, v := range nodes {
+		byID[v.MessageID] = i
+	}
+	rootIdx, ok := byID[root]
+	for i := 0; !ok && i < len(nodes); i++ {
+		if _, found := byID[nodes[i].ParentID.String]; !found {
+			rootIdx, ok = i, true
+		}
+	}
+
+	children := map[int][]int{}
+	for i, v := range nodes {
+		if i == rootIdx {
+			continue
+		}
+		parent, ok := byID[v.ParentID.String]
+		if !v.ParentID.Valid || !ok || parent == i {
+			parent = rootIdx
+		}
+		children[parent] = append(children[parent], i)
+	}
+
+	tree := make([]models.ThreadNode, 0, len(nodes))
+	visited := map[int]bool{}
+	var walk func(i, parent, depth int)
+	walk = func(i, parent, depth int) {
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		n := nodes[i]
+		n.Parent, n.Depth = parent, depth
+		tree = append(tree, n)
+		for _, c := range children[i] {
+			walk(c, n.Number, depth+1)
+		}
+	}
+	walk(rootIdx, 0, 0)
+
+	// nodes in a parent cycle aren't reachable from the root
+	for i := range nodes {
+		if !visited[i] {
+			walk(i, nodes[rootIdx].Number, 1)
+		}
+	}
+	return tree
+}
@@ -14,6 +14,7 @@ type WildmatPattern struct {
 	negated bool
 	pattern string
 	regex   *regexp2.Regexp
+	exact   *regexp2.Regexp // the same regex anchored to the whole string
 }
 
 func regexpEscape(str string) string {
@@ -33,7 +34,7 @@ func convertWildmatToRegex(pat string) (*regexp2.Regexp, error) {
 		case '?':
 			regex += "."
 		case '*':
-			regex += ".?"
+			regex += ".*"
 		default:
 			{
 				regex += string(v)
@@ -46,38 +47,56 @@ func convertWildmatToRegex(pat string) (*regexp2.Regexp, error) {
 func ParseWildmat(wildmat string) (*Wildmat, error) {
 	res := &Wildmat{}
 	for _, v := range strings.Split(wildmat, ",") {
+		p := &WildmatPattern{pattern: v}
 		if len(v) > 0 && v[0] == '!' {
-			r, err := convertWildmatToRegex(v[1:])
-			if err != nil {
-				return nil, err
-			}
-			res.patterns = append(res.patterns, &WildmatPattern{pattern: v[1:], negated: true, regex: r})
-		} else {
-			r, err := convertWildmatToRegex(v)
-			if err != nil {
-				return nil, err
-			}
-			res.patterns = append(res.patterns, &WildmatPattern{pattern: v, negated: false, regex: r})
+			p.pattern = v[1:]
+			p.negated = true
+		}
+		r, err := convertWildmatToRegex(p.pattern)
+		if err != nil {
+			return nil, err
 		}
+		p.regex = r
+		p.exact, err = regexp2.Compile(fmt.Sprintf("^(?:%s)$", r.String()), regexp2.None)
+		if err != nil {
+			return nil, err
+		}
+		res.patterns = append(res.patterns, p)
 	}
 	return res, nil
 }
 
-func (w *Wildmat) ToRegex() (*regexp2.Regexp, error) {
-	res := "(%s)%s"
-	include := ""
-	exclude := ""
+// Match reports whether s matches the wildmat. Patterns are evaluated in order and the last
+// matching one wins, so a negated pattern excludes what the preceding patterns have matched.
+func (w *Wildmat) Match(s string) bool {
+	matched := false
 	for _, v := range w.patterns {
+		if ok, _ := v.exact.MatchString(s); ok {
+			matched = !v.negated
+		}
+	}
+	return matched
+}
+
+// ToRegex returns the regex anchored to the whole string which matches the same strings as Match:
+// a string matches if it matches a pattern and none of the negated patterns following it.
+func (w *Wildmat) ToRegex() (*regexp2.Regexp, error) {
+	var alternatives []string
+	for i, v := range w.patterns {
 		if v.negated {
-			exclude += fmt.Sprintf("(?!%s)", v.regex.String())
-		} else {
-			if len(include) != 0 {
-				include += fmt.Sprintf("|(%s)", v.regex.String())
-			} else {
-				include += fmt.Sprintf("(%s)", v.regex.String())
+			continue
+		}
+		alternative := ""
+		for _, n := range w.patterns[i+1:] {
+			if n.negated {
+				alternative += fmt.Sprintf("(?!(?:%s)$)", n.regex.String())
 			}
 		}
+		alternatives = append(alternatives, fmt.Sprintf("%s(?:%s)$", alternative, v.regex.String()))
+	}
+	if len(alternatives) == 0 {
+		// group names are never empty
+		return regexp2.Compile("^$", regexp2.None)
 	}
-	res = fmt.Sprintf(res, include, exclude)
-	return regexp2.Compile(res, regexp2.None)
+	return regexp2.Compile(fmt.Sprintf("^(?:%s)", strings.Join(alternatives, "|")), regexp2.None)
 }
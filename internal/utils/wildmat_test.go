@@ -0,0 +1,59 @@
+package utils
+
+import "testing"
+
+var wildmatTests = []struct {
+	wildmat string
+	matches []string
+	misses  []string
+}{
+	{"*", []string{"comp.lang.go", "misc"}, nil},
+	{"comp.*", []string{"comp.lang.go", "comp."}, []string{"comp", "alt.comp.lang", "xcomp.lang"}},
+	{"comp.lang.?o", []string{"comp.lang.go"}, []string{"comp.lang.o", "comp.lang.goo"}},
+	{"misc.test", []string{"misc.test"}, []string{"misc.tests", "misc_test", "misc.test.x"}},
+	{"a+b.c", []string{"a+b.c"}, []string{"aab.c", "a+bxc"}},
+	{"comp.*,!comp.lang.*", []string{"comp.os.linux"}, []string{"comp.lang.go", "misc.test"}},
+	{"comp.*,!comp.lang.*,comp.lang.go", []string{"comp.os.linux", "comp.lang.go"}, []string{"comp.lang.c"}},
+	{"!comp.*", nil, []string{"comp.lang.go", "misc.test"}},
+}
+
+func TestWildmatMatch(t *testing.T) {
+	for _, tt := range wildmatTests {
+		w, err := ParseWildmat(tt.wildmat)
+		if err != nil {
+			t.Fatalf("ParseWildmat(%q): %v", tt.wildmat, err)
+		}
+		for _, s := range tt.matches {
+			if !w.Match(s) {
+				t.Errorf("%q doesn't match %q", tt.wildmat, s)
+			}
+		}
+		for _, s := range tt.misses {
+			if w.Match(s) {
+				t.Errorf("%q matches %q", tt.wildmat, s)
+			}
+		}
+	}
+}
+
+func TestWildmatToRegex(t *testing.T) {
+	for _, tt := range wildmatTests {
+		w, err := ParseWildmat(tt.wildmat)
+		if err != nil {
+			t.Fatalf("ParseWildmat(%q): %v", tt.wildmat, err)
+		}
+		r, err := w.ToRegex()
+		if err != nil {
+			t.Fatalf("ToRegex(%q): %v", tt.wildmat, err)
+		}
+		for _, s := range append(tt.matches, tt.misses...) {
+			ok, err := r.MatchString(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != w.Match(s) {
+				t.Errorf("regex %s of %q gives %v for %q, Match gives %v", r, tt.wildmat, ok, s, !ok)
+			}
+		}
+	}
+}